@@ -48,6 +48,26 @@ func main() {
 		log.Fatalf("could not register retry failed episodes task: %v", err)
 	}
 
+	// Refresh channel metadata once a day to pick up rebrands and terminations
+	refreshChannelsTask, err := tasks.NewRefreshAllChannelsTask()
+	if err != nil {
+		log.Fatalf("could not create refresh channels task: %v", err)
+	}
+	_, err = scheduler.Register("@every 24h", refreshChannelsTask)
+	if err != nil {
+		log.Fatalf("could not register refresh channels task: %v", err)
+	}
+
+	// Roll feed analytics up every hour, so today's numbers stay fresh
+	rollupAnalyticsTask, err := tasks.NewRollupAnalyticsTask()
+	if err != nil {
+		log.Fatalf("could not create rollup analytics task: %v", err)
+	}
+	_, err = scheduler.Register("@every 1h", rollupAnalyticsTask)
+	if err != nil {
+		log.Fatalf("could not register rollup analytics task: %v", err)
+	}
+
 	log.Printf("Scheduler starting (commit: %s)", CommitSHA)
 	if err := scheduler.Run(); err != nil {
 		log.Fatalf("could not run scheduler: %v", err)
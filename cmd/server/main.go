@@ -8,10 +8,13 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"yt-podcaster/internal/analytics"
 	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
 	"yt-podcaster/internal/handlers"
 	"yt-podcaster/internal/middleware"
 	"yt-podcaster/internal/test"
+	"yt-podcaster/internal/transcode"
 	"yt-podcaster/pkg/tasks"
 
 	"github.com/gorilla/mux"
@@ -82,9 +85,11 @@ func (a *App) registerHandlers() {
 	// Create handlers
 	h := handlers.New(a.templates, a.asynqClient, audioStoragePath)
 
-	// Public handlers
-	a.router.HandleFunc("/rss/{uuid}", h.GetRSSFeed).Methods("GET")
-	a.router.HandleFunc("/audio/{filename:.+}", h.ServeAudioFile).Methods("GET")
+	// Public handlers, asking for credentials only for private feeds
+	a.router.Handle("/rss/{uuid}", middleware.FeedAuthMiddleware(handlers.FeedUUID)(http.HandlerFunc(h.GetRSSFeed))).Methods("GET", "HEAD")
+	a.router.Handle("/audio/{filename}", middleware.FeedAuthMiddleware(handlers.AudioFeedUUID)(http.HandlerFunc(h.ServeAudioFile))).Methods("GET")
+	// Signed for the Mini App player only, see ServeHLS
+	a.router.Handle("/hls/{uuid}/{file}", http.HandlerFunc(h.ServeHLS)).Methods("GET")
 
 	// Create rate limiter with configurable values
 	rateLimitPerMinute := 100.0 // default
@@ -112,7 +117,32 @@ func (a *App) registerHandlers() {
 	a.router.Handle("/auth", authMiddleware(http.HandlerFunc(h.PostAuth))).Methods("POST")
 	a.router.Handle("/subscriptions", authMiddleware(http.HandlerFunc(h.GetSubscriptions))).Methods("GET")
 	a.router.Handle("/subscriptions", authMiddleware(http.HandlerFunc(h.PostSubscription))).Methods("POST")
+	a.router.Handle("/subscriptions/preview", authMiddleware(http.HandlerFunc(h.PostSubscriptionPreview))).Methods("POST")
 	a.router.Handle("/subscriptions/{id}", authMiddleware(http.HandlerFunc(h.DeleteSubscription))).Methods("DELETE")
+	a.router.Handle("/subscriptions/{id}/combined", authMiddleware(http.HandlerFunc(h.PostSubscriptionCombined))).Methods("POST")
+	a.router.Handle("/subscriptions/{id}/ondemand", authMiddleware(http.HandlerFunc(h.PostSubscriptionOnDemand))).Methods("POST")
+	a.router.Handle("/subscriptions/{id}/rotate", authMiddleware(http.HandlerFunc(h.PostSubscriptionRotate))).Methods("POST")
+	a.router.Handle("/subscriptions/{id}/feed", authMiddleware(http.HandlerFunc(h.GetSubscriptionFeedSettings))).Methods("GET")
+	a.router.Handle("/subscriptions/{id}/feed", authMiddleware(http.HandlerFunc(h.PutSubscriptionFeedSettings))).Methods("PUT")
+	a.router.Handle("/subscriptions/{id}/feed/preview", authMiddleware(http.HandlerFunc(h.PostSubscriptionFeedPreview))).Methods("POST")
+	a.router.Handle("/bundles", authMiddleware(http.HandlerFunc(h.GetBundles))).Methods("GET")
+	a.router.Handle("/bundles", authMiddleware(http.HandlerFunc(h.PostBundle))).Methods("POST")
+	a.router.Handle("/bundles/{id}", authMiddleware(http.HandlerFunc(h.PutBundle))).Methods("PUT")
+	a.router.Handle("/bundles/{id}", authMiddleware(http.HandlerFunc(h.DeleteBundle))).Methods("DELETE")
+	a.router.Handle("/smartfeeds", authMiddleware(http.HandlerFunc(h.GetSmartFeeds))).Methods("GET")
+	a.router.Handle("/smartfeeds", authMiddleware(http.HandlerFunc(h.PostSmartFeed))).Methods("POST")
+	a.router.Handle("/smartfeeds/preview", authMiddleware(http.HandlerFunc(h.PostSmartFeedPreview))).Methods("POST")
+	a.router.Handle("/smartfeeds/{id}", authMiddleware(http.HandlerFunc(h.PutSmartFeed))).Methods("PUT")
+	a.router.Handle("/smartfeeds/{id}", authMiddleware(http.HandlerFunc(h.DeleteSmartFeed))).Methods("DELETE")
+	a.router.Handle("/feeds/{uuid}/credentials", authMiddleware(http.HandlerFunc(h.GetFeedCredentials))).Methods("GET")
+	a.router.Handle("/feeds/{uuid}/credentials", authMiddleware(http.HandlerFunc(h.PostFeedCredentials))).Methods("POST")
+	a.router.Handle("/feeds/{uuid}/credentials", authMiddleware(http.HandlerFunc(h.DeleteFeedCredentials))).Methods("DELETE")
+	a.router.Handle("/feeds/{uuid}/audio", authMiddleware(http.HandlerFunc(h.GetFeedAudio))).Methods("GET")
+	a.router.Handle("/feeds/{uuid}/audio", authMiddleware(http.HandlerFunc(h.PutFeedAudio))).Methods("PUT")
+	a.router.Handle("/feeds/{uuid}/stats", authMiddleware(http.HandlerFunc(h.GetFeedStats))).Methods("GET")
+	a.router.Handle("/search", authMiddleware(http.HandlerFunc(h.GetSearch))).Methods("GET")
+	a.router.Handle("/inbox", authMiddleware(http.HandlerFunc(h.GetInbox))).Methods("GET")
+	a.router.Handle("/inbox", authMiddleware(http.HandlerFunc(h.PostInbox))).Methods("POST")
 }
 
 func (a *App) Serve() {
@@ -134,8 +164,11 @@ func main() {
 
 	// Initialize database
 	db.InitDB()
+	feedcache.Init()
+	analytics.Init(db.InsertFetchEvents, db.GetAnalyticsSalt)
 
 	app := NewApp(nil)
+	transcode.Init(audioStoragePath)
 
 	// Start the Telegram bot in a goroutine
 	go app.startTelegramBot()
@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
 	"yt-podcaster/internal/worker"
 	"yt-podcaster/pkg/tasks"
 
@@ -22,6 +23,7 @@ func main() {
 	}
 
 	db.InitDB()
+	feedcache.Init()
 
 	redisAddr := os.Getenv("REDIS_ADDR")
 	if redisAddr == "" {
@@ -39,24 +41,17 @@ func main() {
 				"high":    2,
 				"default": 1,
 			},
-			// Custom retry delay function for exponential backoff
-			RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
-				// Calculate exponential backoff delay
-				delay := time.Duration(5*60*1000) * time.Millisecond        // 5 minutes base
-				maxDelay := time.Duration(24*60*60*1000) * time.Millisecond // 24 hours max
-
-				// Exponential backoff: 5min, 10min, 20min, 40min, 80min, etc.
-				for i := 0; i < n; i++ {
-					delay *= 2
-					if delay > maxDelay {
-						delay = maxDelay
-						break
-					}
-				}
-
-				log.Printf("Task %s failed %d times, retrying in %v", task.Type(), n+1, delay)
-				return delay
-			},
+			RetryDelayFunc: retryDelay,
+		},
+	)
+	// A podcast app is waiting for on-demand fetches, so they get a worker of
+	// their own instead of queueing behind whatever download is running
+	onDemandSrv := asynq.NewServer(
+		asynq.RedisClientOpt{Addr: redisAddr},
+		asynq.Config{
+			Concurrency:    1,
+			Queues:         map[string]int{tasks.QueueOnDemand: 1},
+			RetryDelayFunc: retryDelay,
 		},
 	)
 
@@ -67,9 +62,35 @@ func main() {
 	mux.HandleFunc(tasks.TypeProcessVideo, taskHandler.HandleProcessVideoTask)
 	mux.HandleFunc(tasks.TypeCheckAllSubscriptions, taskHandler.HandleCheckAllSubscriptionsTask)
 	mux.HandleFunc(tasks.TypeRetryFailedEpisodes, taskHandler.HandleRetryFailedEpisodesTask)
+	mux.HandleFunc(tasks.TypeRefreshChannel, taskHandler.HandleRefreshChannelTask)
+	mux.HandleFunc(tasks.TypeRefreshAllChannels, taskHandler.HandleRefreshAllChannelsTask)
+	mux.HandleFunc(tasks.TypeRollupAnalytics, taskHandler.HandleRollupAnalyticsTask)
 
 	log.Printf("Worker starting (commit: %s)", CommitSHA)
+	if err := onDemandSrv.Start(mux); err != nil {
+		log.Fatalf("could not start on-demand server: %v", err)
+	}
+	defer onDemandSrv.Shutdown()
 	if err := srv.Run(mux); err != nil {
 		log.Fatalf("could not run server: %v", err)
 	}
 }
+
+// retryDelay backs failed tasks off exponentially
+func retryDelay(n int, err error, task *asynq.Task) time.Duration {
+	// Calculate exponential backoff delay
+	delay := time.Duration(5*60*1000) * time.Millisecond        // 5 minutes base
+	maxDelay := time.Duration(24*60*60*1000) * time.Millisecond // 24 hours max
+
+	// Exponential backoff: 5min, 10min, 20min, 40min, 80min, etc.
+	for i := 0; i < n; i++ {
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+			break
+		}
+	}
+
+	log.Printf("Task %s failed %d times, retrying in %v", task.Type(), n+1, delay)
+	return delay
+}
@@ -0,0 +1,227 @@
+// Package analytics records who fetches feeds and their audio, so feed owners
+// can see which feeds are actually used. Requests are queued in memory and
+// written in batches, off the request path; the worker later rolls them up
+// into IAB-style deduplicated downloads and subscriber counts per podcast app.
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yt-podcaster/internal/models"
+)
+
+// queueSize caps the events waiting to be written; more are dropped
+const queueSize = 1000
+
+// flushInterval is how often queued events are written at the latest
+const flushInterval = 5 * time.Second
+
+// Writer stores a batch of events.
+type Writer func(events []models.FetchEvent) error
+
+// SaltSource returns the random salt of a UTC day, the same for every server.
+type SaltSource func(day time.Time) ([]byte, error)
+
+var queue chan models.FetchEvent
+
+var salts daySalts
+
+func getAnalyticsEnabled() bool {
+	enabled := true
+	if env := os.Getenv("ANALYTICS_ENABLED"); env != "" {
+		if val, err := strconv.ParseBool(env); err == nil {
+			enabled = val
+		}
+	}
+	return enabled
+}
+
+// Init starts writing recorded events with write, hashing addresses with the
+// salts of source, unless ANALYTICS_ENABLED is false. Until Init is called
+// nothing is recorded.
+func Init(write Writer, source SaltSource) {
+	if !getAnalyticsEnabled() {
+		return
+	}
+	salts = daySalts{source: source}
+	queue = make(chan models.FetchEvent, queueSize)
+	go run(queue, write, flushInterval)
+}
+
+// run writes events in batches as they fill up or every interval
+func run(events <-chan models.FetchEvent, write Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []models.FetchEvent
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := write(batch); err != nil {
+			log.Printf("Error writing %d fetch events: %v", len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= queueSize/10 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// RecordFeed records a fetch of the feed at rssUUID.
+func RecordFeed(r *http.Request, rssUUID string) {
+	event, ok := newEvent(r, models.FetchKindFeed, rssUUID)
+	if !ok {
+		return
+	}
+	event.ReportedSubscribers = ReportedSubscribers(event.UserAgent)
+	enqueue(event)
+}
+
+// RecordAudio records a request for an episode's audio through the feed at rssUUID.
+func RecordAudio(r *http.Request, rssUUID string, audioUUID string) {
+	event, ok := newEvent(r, models.FetchKindAudio, rssUUID)
+	if !ok {
+		return
+	}
+	event.AudioUUID = &audioUUID
+	event.RangeStart, event.RangeEnd = parseRange(r.Header.Get("Range"))
+	enqueue(event)
+}
+
+// newEvent describes a request; it returns false for bots and when analytics are off
+func newEvent(r *http.Request, kind string, rssUUID string) (models.FetchEvent, bool) {
+	if queue == nil {
+		return models.FetchEvent{}, false
+	}
+	userAgent := r.Header.Get("User-Agent")
+	app := App(userAgent)
+	if app == "" {
+		return models.FetchEvent{}, false
+	}
+	now := time.Now().UTC()
+	salt, err := salts.get(now)
+	if err != nil {
+		log.Printf("Error getting analytics salt, dropping %s fetch of %s: %v", kind, rssUUID, err)
+		return models.FetchEvent{}, false
+	}
+	return models.FetchEvent{
+		Kind:      kind,
+		RSSUUID:   rssUUID,
+		IPHash:    hashIP(clientIP(r), salt),
+		UserAgent: userAgent,
+		App:       app,
+		CreatedAt: now,
+	}, true
+}
+
+func enqueue(event models.FetchEvent) {
+	select {
+	case queue <- event:
+	default:
+		log.Printf("Analytics queue full, dropping %s fetch of %s", event.Kind, event.RSSUUID)
+	}
+}
+
+// clientIP returns the address of the client. Behind the reverse proxy that
+// is the last X-Forwarded-For entry, the one the proxy itself added.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// daySalts keeps the salt of the current UTC day
+type daySalts struct {
+	source SaltSource
+
+	mu   sync.Mutex
+	day  time.Time
+	salt []byte
+}
+
+func (d *daySalts) get(now time.Time) ([]byte, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.salt == nil || !d.day.Equal(day) {
+		salt, err := d.source(day)
+		if err != nil {
+			return nil, err
+		}
+		d.day, d.salt = day, salt
+	}
+	return d.salt, nil
+}
+
+// hashIP hashes an address with the random salt of its day, which is all IAB
+// deduplication needs. Once the salt is deleted, trying every address no
+// longer finds the one behind a hash.
+func hashIP(ip string, salt []byte) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// parseRange reads the first range of a Range header. Suffix ranges of the
+// last n bytes are returned as 0 to n - 1, which covers as many bytes.
+func parseRange(header string) (start, end *int64) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+	spec, _, _ = strings.Cut(spec, ",")
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if first == "" {
+		length, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || length <= 0 {
+			return nil, nil
+		}
+		zero, lastByte := int64(0), length-1
+		return &zero, &lastByte
+	}
+	from, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	if last == "" {
+		return &from, nil
+	}
+	to, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || to < from {
+		return nil, nil
+	}
+	return &from, &to
+}
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"yt-podcaster/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp(t *testing.T) {
+	cases := []struct {
+		userAgent, app string
+	}{
+		{"Overcast/1.0 Podcast Sync (123 subscribers; feed-id=456; +http://overcast.fm/)", "Overcast"},
+		{"AppleCoreMedia/1.0.0.20E247 (iPhone; U; CPU OS 16_4 like Mac OS X; en_us)", "Apple Podcasts"},
+		{"Podcasts/1570.1 CFNetwork/1410.0.3 Darwin/22.4.0", "Apple Podcasts"},
+		{"PocketCasts/1.0 (Pocket Casts Feed Parser; +http://pocketcasts.com/)", "Pocket Casts"},
+		{"Spotify/8.8.0 Android/33 (SM-G991B)", "Spotify"},
+		{"AntennaPod/3.2.0", "AntennaPod"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Web browser"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", ""},
+		{"curl/8.4.0", ""},
+		{"", ""},
+		{"SomePodcastApp/2.0", "Other"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.app, App(tc.userAgent), tc.userAgent)
+	}
+}
+
+func TestReportedSubscribers(t *testing.T) {
+	count := ReportedSubscribers("Overcast/1.0 Podcast Sync (123 subscribers; feed-id=456)")
+	if assert.NotNil(t, count) {
+		assert.Equal(t, 123, *count)
+	}
+	assert.Nil(t, ReportedSubscribers("AntennaPod/3.2.0"))
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header     string
+		start, end *int64
+	}{
+		{"", nil, nil},
+		{"bytes=0-1", ptr(0), ptr(1)},
+		{"bytes=100-", ptr(100), nil},
+		{"bytes=-500", ptr(0), ptr(499)},
+		{"bytes=0-99, 200-299", ptr(0), ptr(99)},
+		{"bytes=9-3", nil, nil},
+		{"items=0-1", nil, nil},
+	}
+	for _, tc := range cases {
+		start, end := parseRange(tc.header)
+		assert.Equal(t, tc.start, start, tc.header)
+		assert.Equal(t, tc.end, end, tc.header)
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	salt := []byte("salt of the day")
+
+	hash := hashIP("203.0.113.7", salt)
+	assert.Len(t, hash, 32)
+	assert.NotContains(t, hash, "203.0.113.7")
+	assert.Equal(t, hash, hashIP("203.0.113.7", salt))
+	assert.NotEqual(t, hash, hashIP("203.0.113.8", salt))
+	// A new salt every day keeps listeners from being followed across days
+	assert.NotEqual(t, hash, hashIP("203.0.113.7", []byte("salt of the next day")))
+}
+
+func TestDaySaltsFetchOncePerDay(t *testing.T) {
+	var fetched []time.Time
+	salts := daySalts{source: func(day time.Time) ([]byte, error) {
+		fetched = append(fetched, day)
+		return []byte(day.Format("2006-01-02")), nil
+	}}
+	day := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	salt, err := salts.get(day)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2024-05-01"), salt)
+	salt, err = salts.get(day.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2024-05-01"), salt)
+	salt, err = salts.get(day.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2024-05-02"), salt)
+
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+	}, fetched)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/rss/feed", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	assert.Equal(t, "10.0.0.2", clientIP(req))
+
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	assert.Equal(t, "203.0.113.7", clientIP(req))
+}
+
+func TestRunWritesBatches(t *testing.T) {
+	events := make(chan models.FetchEvent)
+	batches := make(chan []models.FetchEvent, queueSize)
+	done := make(chan struct{})
+	go func() {
+		run(events, func(batch []models.FetchEvent) error {
+			batches <- batch
+			return nil
+		}, time.Hour)
+		close(done)
+	}()
+
+	for i := 0; i < queueSize/10; i++ {
+		events <- models.FetchEvent{Kind: models.FetchKindFeed}
+	}
+	// A full batch is written without waiting for the interval
+	assert.Len(t, <-batches, queueSize/10)
+
+	events <- models.FetchEvent{Kind: models.FetchKindAudio}
+	close(events)
+	<-done
+	assert.Len(t, <-batches, 1)
+}
+
+func ptr(n int64) *int64 {
+	return &n
+}
@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Apps that fetch feeds or audio themselves, most specific first; browsers
+// and unknown clients come after them
+var apps = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Overcast", regexp.MustCompile(`Overcast`)},
+	{"Pocket Casts", regexp.MustCompile(`(?i)Pocket ?Casts`)},
+	{"Spotify", regexp.MustCompile(`(?i)Spotify`)},
+	{"Castro", regexp.MustCompile(`Castro`)},
+	{"Podcast Addict", regexp.MustCompile(`PodcastAddict`)},
+	{"AntennaPod", regexp.MustCompile(`AntennaPod`)},
+	{"Podverse", regexp.MustCompile(`Podverse`)},
+	{"Castbox", regexp.MustCompile(`(?i)CastBox`)},
+	{"Player FM", regexp.MustCompile(`Player ?FM`)},
+	{"Podcast Republic", regexp.MustCompile(`Podcast ?Republic`)},
+	{"Feedly", regexp.MustCompile(`Feedly`)},
+	{"Inoreader", regexp.MustCompile(`Inoreader`)},
+	{"Apple Podcasts", regexp.MustCompile(`^(Podcasts|iTunes|AppleCoreMedia|Apple ?Podcasts|atc)/`)},
+}
+
+// botPattern matches crawlers, monitors and scripts, which IAB rules exclude
+var botPattern = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|curl/|wget/|python-|go-http-client|java/|libwww|httpclient|monitor|uptime`)
+
+// browserPattern matches web browsers, which play audio through a generic user agent
+var browserPattern = regexp.MustCompile(`^Mozilla/`)
+
+// subscribersPattern reads the subscriber counts aggregators report, as in
+// "Overcast/1.0 Podcast Sync (123 subscribers; feed-id=456)"
+var subscribersPattern = regexp.MustCompile(`(\d+) subscribers?\b`)
+
+// App names the podcast app behind a user agent. It returns "" for bots and
+// requests without a user agent, which aren't recorded.
+func App(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	for _, app := range apps {
+		if app.pattern.MatchString(userAgent) {
+			return app.name
+		}
+	}
+	if botPattern.MatchString(userAgent) {
+		return ""
+	}
+	if browserPattern.MatchString(userAgent) {
+		return "Web browser"
+	}
+	return "Other"
+}
+
+// ReportedSubscribers returns the subscriber count in an aggregator's user
+// agent, or nil when there is none.
+func ReportedSubscribers(userAgent string) *int {
+	match := subscribersPattern.FindStringSubmatch(userAgent)
+	if match == nil {
+		return nil
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return nil
+	}
+	return &count
+}
@@ -0,0 +1,137 @@
+// Package audiourl signs the enclosure URLs of feeds. A signature ties an
+// audio file to the RSS UUID of the feed its episode belongs to, so rotating
+// that UUID or removing the subscription also stops its audio URLs from
+// working. Signed URLs can optionally expire.
+package audiourl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrInvalid is returned for URLs without a valid signature.
+var ErrInvalid = errors.New("invalid audio URL signature")
+
+// ErrExpired is returned for signed URLs past their expiry.
+var ErrExpired = errors.New("audio URL expired")
+
+// getSigningKey returns the key of signatures. Without AUDIO_URL_SIGNING_KEY
+// it is derived from the bot token, which every deployment keeps secret.
+func getSigningKey() []byte {
+	if key := os.Getenv("AUDIO_URL_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("TELEGRAM_BOT_TOKEN")))
+	mac.Write([]byte("audio-url"))
+	return mac.Sum(nil)
+}
+
+// getTTL returns how long signed URLs stay valid at least; 0 never expires them
+func getTTL() time.Duration {
+	if env := os.Getenv("AUDIO_URL_TTL_HOURS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val > 0 {
+			return time.Duration(val) * time.Hour
+		}
+	}
+	return 0
+}
+
+// Sign returns the URL of an episode's audio under baseURL, signed for the
+// RSS UUID of the feed the episode belongs to.
+func Sign(baseURL, audioUUID, feedToken string) string {
+	return sign(baseURL, audioUUID, feedToken, time.Now())
+}
+
+func sign(baseURL, audioUUID, feedToken string, now time.Time) string {
+	query := url.Values{}
+	expires := ""
+	if ttl := int64(getTTL().Seconds()); ttl > 0 {
+		// Expiries are rounded so feeds render the same URLs for a whole TTL,
+		// which keeps them cacheable; every URL lasts between one and two TTLs
+		expires = strconv.FormatInt((now.Unix()/ttl+2)*ttl, 10)
+		query.Set("exp", expires)
+	}
+	query.Set("sig", signature(audioUUID, feedToken, expires))
+	return fmt.Sprintf("%s/audio/%s.m4a?%s", baseURL, audioUUID, query.Encode())
+}
+
+// Match checks the signature and expiry in the query of an audio URL against
+// the RSS UUIDs currently allowed to serve the episode, returning the one the
+// URL is signed for.
+func Match(audioUUID string, feedTokens []string, query url.Values) (string, error) {
+	return match(audioUUID, feedTokens, query, time.Now())
+}
+
+// playbackTTL is how long the Mini App player's URLs stay valid
+const playbackTTL = 12 * time.Hour
+
+// playbackScope sets playback signatures apart from those of feed audio URLs
+const playbackScope = "playback\n"
+
+// SignPlayback returns the query authorizing the Mini App player to stream an
+// episode for a while, signed for the RSS UUID of a feed the episode belongs
+// to. Feed audio URLs and playback URLs don't verify as each other, so the
+// player's routes can skip the credentials of private feeds.
+func SignPlayback(audioUUID, feedToken string) url.Values {
+	return signPlayback(audioUUID, feedToken, time.Now())
+}
+
+func signPlayback(audioUUID, feedToken string, now time.Time) url.Values {
+	expires := strconv.FormatInt(now.Add(playbackTTL).Unix(), 10)
+	return url.Values{
+		"exp": {expires},
+		"sig": {signature(audioUUID, playbackScope+feedToken, expires)},
+	}
+}
+
+// VerifyPlayback checks a query made by SignPlayback against the RSS UUIDs
+// currently allowed to serve the episode.
+func VerifyPlayback(audioUUID string, feedTokens []string, query url.Values) error {
+	return verifyPlayback(audioUUID, feedTokens, query, time.Now())
+}
+
+func verifyPlayback(audioUUID string, feedTokens []string, query url.Values, now time.Time) error {
+	scoped := make([]string, len(feedTokens))
+	for i, token := range feedTokens {
+		scoped[i] = playbackScope + token
+	}
+	_, err := match(audioUUID, scoped, query, now)
+	return err
+}
+
+func match(audioUUID string, feedTokens []string, query url.Values, now time.Time) (string, error) {
+	expires := query.Get("exp")
+	given, err := base64.RawURLEncoding.DecodeString(query.Get("sig"))
+	if err != nil || len(given) == 0 {
+		return "", ErrInvalid
+	}
+
+	for _, token := range feedTokens {
+		want, _ := base64.RawURLEncoding.DecodeString(signature(audioUUID, token, expires))
+		if !hmac.Equal(given, want) {
+			continue
+		}
+		if expires != "" {
+			unix, err := strconv.ParseInt(expires, 10, 64)
+			if err != nil || now.Unix() >= unix {
+				return "", ErrExpired
+			}
+		}
+		return token, nil
+	}
+	return "", ErrInvalid
+}
+
+// signature is a truncated HMAC of the audio UUID, the feed token and the expiry
+func signature(audioUUID, feedToken, expires string) string {
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(audioUUID + "\n" + feedToken + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,83 @@
+package audiourl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signedQuery(t *testing.T, signed string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(signed)
+	assert.NoError(t, err)
+	return parsed.Query()
+}
+
+func TestSignAndMatch(t *testing.T) {
+	t.Setenv("AUDIO_URL_SIGNING_KEY", "test-signing-key")
+	t.Setenv("AUDIO_URL_TTL_HOURS", "")
+	check := func(audioUUID string, feedTokens []string, query url.Values) error {
+		_, err := Match(audioUUID, feedTokens, query)
+		return err
+	}
+
+	signed := Sign("https://podcaster.example.com", "audio-uuid", "feed-uuid")
+	assert.Regexp(t, `^https://podcaster\.example\.com/audio/audio-uuid\.m4a\?sig=[\w-]{22}$`, signed)
+	query := signedQuery(t, signed)
+
+	assert.NoError(t, check("audio-uuid", []string{"feed-uuid"}, query))
+	// Retired feed tokens in their grace period are passed along with the current one
+	assert.NoError(t, check("audio-uuid", []string{"new-uuid", "feed-uuid"}, query))
+	token, err := Match("audio-uuid", []string{"new-uuid", "feed-uuid"}, query)
+	assert.NoError(t, err)
+	assert.Equal(t, "feed-uuid", token)
+	assert.ErrorIs(t, check("audio-uuid", []string{"new-uuid"}, query), ErrInvalid)
+	assert.ErrorIs(t, check("other-audio", []string{"feed-uuid"}, query), ErrInvalid)
+	assert.ErrorIs(t, check("audio-uuid", nil, query), ErrInvalid)
+	assert.ErrorIs(t, check("audio-uuid", []string{"feed-uuid"}, url.Values{}), ErrInvalid)
+
+	t.Setenv("AUDIO_URL_SIGNING_KEY", "another-key")
+	assert.ErrorIs(t, check("audio-uuid", []string{"feed-uuid"}, query), ErrInvalid)
+}
+
+func TestSignExpiry(t *testing.T) {
+	t.Setenv("AUDIO_URL_SIGNING_KEY", "test-signing-key")
+	t.Setenv("AUDIO_URL_TTL_HOURS", "24")
+
+	now := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	signed := sign("https://podcaster.example.com", "audio-uuid", "feed-uuid", now)
+	query := signedQuery(t, signed)
+	// Rounded to the end of the next day, so the URL is stable for the rest of this one
+	assert.Equal(t, "1709424000", query.Get("exp"))
+	assert.Equal(t, signed, sign("https://podcaster.example.com", "audio-uuid", "feed-uuid", now.Add(5*time.Hour)))
+
+	token, err := match("audio-uuid", []string{"feed-uuid"}, query, now.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "feed-uuid", token)
+	_, err = match("audio-uuid", []string{"feed-uuid"}, query, now.Add(31*time.Hour))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	// Extending the expiry breaks the signature
+	query.Set("exp", "1809424000")
+	_, err = match("audio-uuid", []string{"feed-uuid"}, query, now)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestSignPlayback(t *testing.T) {
+	t.Setenv("AUDIO_URL_SIGNING_KEY", "test-signing-key")
+	t.Setenv("AUDIO_URL_TTL_HOURS", "")
+	now := time.Unix(1700000000, 0)
+
+	query := signPlayback("audio-uuid", "feed-uuid", now)
+	assert.NoError(t, verifyPlayback("audio-uuid", []string{"new-uuid", "feed-uuid"}, query, now))
+	assert.ErrorIs(t, verifyPlayback("audio-uuid", []string{"new-uuid"}, query, now), ErrInvalid)
+	assert.ErrorIs(t, verifyPlayback("audio-uuid", []string{"feed-uuid"}, query, now.Add(playbackTTL)), ErrExpired)
+
+	// Neither kind of URL passes for the other
+	_, err := match("audio-uuid", []string{"feed-uuid"}, query, now)
+	assert.ErrorIs(t, err, ErrInvalid)
+	feedQuery := signedQuery(t, sign("", "audio-uuid", "feed-uuid", now))
+	assert.ErrorIs(t, verifyPlayback("audio-uuid", []string{"feed-uuid"}, feedQuery, now), ErrInvalid)
+}
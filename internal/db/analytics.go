@@ -0,0 +1,125 @@
+package db
+
+import (
+	"crypto/rand"
+	"time"
+
+	"yt-podcaster/internal/models"
+)
+
+// InsertFetchEvents stores a batch of recorded feed and audio requests.
+func InsertFetchEvents(events []models.FetchEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO fetch_events (kind, rss_uuid, audio_uuid, ip_hash, user_agent, app, reported_subscribers, range_start, range_end, created_at)
+		VALUES (:kind, :rss_uuid, :audio_uuid, :ip_hash, :user_agent, :app, :reported_subscribers, :range_start, :range_end, :created_at)
+	`
+	_, err := DB.NamedExec(query, events)
+	return err
+}
+
+// GetAnalyticsSalt returns the salt of a UTC day, made on first use so that
+// every server hashes addresses with the same one.
+func GetAnalyticsSalt(day time.Time) ([]byte, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	// Updating to itself makes RETURNING give the salt another server made first
+	query := `
+		INSERT INTO analytics_salts (day, salt) VALUES ($1, $2)
+		ON CONFLICT (day) DO UPDATE SET day = EXCLUDED.day
+		RETURNING salt
+	`
+	var stored []byte
+	err := DB.Get(&stored, query, day, salt)
+	return stored, err
+}
+
+// DeleteAnalyticsSaltsBefore removes the salts of days no longer recorded.
+func DeleteAnalyticsSaltsBefore(day time.Time) error {
+	_, err := DB.Exec("DELETE FROM analytics_salts WHERE day < $1", day)
+	return err
+}
+
+// RollupFeedStats recomputes the daily stats of every UTC day from since on.
+// Following the IAB podcast measurement guidelines, a download is a listener
+// (IP hash and user agent) fetching at least a minute's worth of an episode's
+// audio, or all of shorter ones, counted once per day. Subscribers are the
+// listeners fetching a feed that day, or the counts aggregators report.
+// Requests at a subscription's retired RSS UUIDs count for its current one.
+func RollupFeedStats(since time.Time) error {
+	query := `
+		WITH events AS (
+			SELECT f.*, COALESCE(s.rss_uuid, f.rss_uuid) AS feed_uuid, (f.created_at AT TIME ZONE 'UTC')::date AS day
+			FROM fetch_events f
+			LEFT JOIN retired_feed_tokens t ON t.rss_uuid = f.rss_uuid
+			LEFT JOIN subscriptions s ON s.id = t.subscription_id
+			WHERE f.created_at >= $1
+		),
+		listens AS (
+			SELECT ev.feed_uuid, ev.day, ev.app,
+				SUM(COALESCE(ev.range_end + 1, e.audio_size_bytes) - COALESCE(ev.range_start, 0)) AS bytes,
+				MAX(e.audio_size_bytes) AS size,
+				MAX(COALESCE(e.duration_seconds, 0)) AS duration
+			FROM events ev
+			JOIN episodes e ON e.audio_uuid = ev.audio_uuid
+			WHERE ev.kind = 'audio' AND e.audio_size_bytes > 0
+			GROUP BY ev.feed_uuid, ev.day, ev.app, ev.ip_hash, ev.user_agent, ev.audio_uuid
+		),
+		downloads AS (
+			SELECT feed_uuid, day, app, COUNT(*) AS downloads
+			FROM listens
+			WHERE bytes >= LEAST(size, size * 60 / GREATEST(duration, 60))
+			GROUP BY feed_uuid, day, app
+		),
+		fetchers AS (
+			-- Aggregators fetch from many addresses, so their user agent alone identifies them
+			SELECT feed_uuid, day, app, COALESCE(MAX(reported_subscribers), 1) AS subscribers
+			FROM events
+			WHERE kind = 'feed'
+			GROUP BY feed_uuid, day, app, user_agent, CASE WHEN reported_subscribers IS NULL THEN ip_hash END
+		),
+		subscribers AS (
+			SELECT feed_uuid, day, app, SUM(subscribers) AS subscribers
+			FROM fetchers
+			GROUP BY feed_uuid, day, app
+		)
+		INSERT INTO feed_daily_stats (rss_uuid, day, app, downloads, subscribers)
+		SELECT COALESCE(d.feed_uuid, s.feed_uuid), COALESCE(d.day, s.day), COALESCE(d.app, s.app),
+			COALESCE(d.downloads, 0), COALESCE(s.subscribers, 0)
+		FROM downloads d
+		FULL JOIN subscribers s ON s.feed_uuid = d.feed_uuid AND s.day = d.day AND s.app = d.app
+		ON CONFLICT (rss_uuid, day, app) DO UPDATE
+		SET downloads = EXCLUDED.downloads, subscribers = EXCLUDED.subscribers
+	`
+	_, err := DB.Exec(query, since)
+	return err
+}
+
+// DeleteFetchEventsBefore removes recorded requests that were already rolled up.
+func DeleteFetchEventsBefore(before time.Time) (int64, error) {
+	result, err := DB.Exec("DELETE FROM fetch_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetFeedStats returns a feed's downloads since a day and its subscribers,
+// the most seen on any day since activeSince, per podcast app.
+func GetFeedStats(rssUUID string, since time.Time, activeSince time.Time) ([]models.FeedAppStats, error) {
+	var stats []models.FeedAppStats
+	query := `
+		SELECT app, SUM(downloads) AS downloads,
+			COALESCE(MAX(subscribers) FILTER (WHERE day >= $3), 0) AS subscribers
+		FROM feed_daily_stats
+		WHERE rss_uuid = $1 AND day >= $2
+		GROUP BY app
+		ORDER BY downloads DESC, subscribers DESC, app
+	`
+	err := DB.Select(&stats, query, rssUUID, since, activeSince)
+	return stats, err
+}
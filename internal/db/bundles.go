@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"yt-podcaster/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// bundleColumns selects a bundle with its active member subscriptions
+const bundleColumns = `
+	b.id, b.user_id, b.title, b.image_url, b.rss_uuid, b.created_at, b.updated_at,
+	ARRAY(
+		SELECT bs.subscription_id
+		FROM bundle_subscriptions bs
+		JOIN subscriptions s ON s.id = bs.subscription_id
+		WHERE bs.bundle_id = b.id AND s.active = TRUE
+		ORDER BY bs.subscription_id
+	) AS subscription_ids`
+
+// GetBundlesByUserID returns a user's bundles, oldest first.
+func GetBundlesByUserID(userID int64) ([]models.Bundle, error) {
+	var bundles []models.Bundle
+	err := DB.Select(&bundles, "SELECT "+bundleColumns+" FROM bundles b WHERE b.user_id = $1 ORDER BY b.created_at, b.id", userID)
+	return bundles, err
+}
+
+// GetBundleByRSSUUID returns the bundle served at a feed UUID.
+func GetBundleByRSSUUID(rssUUID string) (models.Bundle, error) {
+	var bundle models.Bundle
+	err := DB.Get(&bundle, "SELECT "+bundleColumns+" FROM bundles b WHERE b.rss_uuid = $1", rssUUID)
+	return bundle, err
+}
+
+// CreateBundle stores a bundle of the given subscriptions. IDs of subscriptions
+// that aren't the user's active ones are ignored.
+func CreateBundle(userID int64, title string, imageURL *string, subscriptionIDs []int64) (models.Bundle, error) {
+	var bundle models.Bundle
+	err := inTx(func(tx *sqlx.Tx) error {
+		if err := tx.Get(&bundle, `
+			INSERT INTO bundles (user_id, title, image_url)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, title, image_url, rss_uuid, created_at, updated_at
+		`, userID, title, imageURL); err != nil {
+			return err
+		}
+		return setBundleSubscriptions(tx, userID, bundle.ID, subscriptionIDs)
+	})
+	return bundle, err
+}
+
+// UpdateBundle replaces the title, artwork and members of a user's bundle.
+// It returns sql.ErrNoRows when the user has no such bundle.
+func UpdateBundle(userID int64, bundleID int, title string, imageURL *string, subscriptionIDs []int64) error {
+	return inTx(func(tx *sqlx.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE bundles SET title = $3, image_url = $4, updated_at = NOW()
+			WHERE id = $1 AND user_id = $2
+		`, bundleID, userID, title, imageURL)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.Exec("DELETE FROM bundle_subscriptions WHERE bundle_id = $1", bundleID); err != nil {
+			return err
+		}
+		return setBundleSubscriptions(tx, userID, bundleID, subscriptionIDs)
+	})
+}
+
+// DeleteBundle removes a user's bundle; its feed stops being served.
+func DeleteBundle(userID int64, bundleID int) error {
+	result, err := DB.Exec("DELETE FROM bundles WHERE id = $1 AND user_id = $2", bundleID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func setBundleSubscriptions(tx *sqlx.Tx, userID int64, bundleID int, subscriptionIDs []int64) error {
+	if len(subscriptionIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO bundle_subscriptions (bundle_id, subscription_id)
+		SELECT $1, id FROM subscriptions
+		WHERE user_id = $2 AND active = TRUE AND id = ANY($3)
+	`, bundleID, userID, pq.Array(subscriptionIDs))
+	return err
+}
+
+// GetCompletedEpisodesByBundleID returns the newest episodes of a bundle's active subscriptions.
+func GetCompletedEpisodesByBundleID(bundleID int, limit int) ([]models.SubscriptionEpisode, error) {
+	var episodes []models.SubscriptionEpisode
+	query := `
+		SELECT e.*, s.youtube_channel_title AS subscription_title
+		FROM episodes e
+		JOIN subscriptions s ON e.subscription_id = s.id
+		JOIN bundle_subscriptions bs ON bs.subscription_id = s.id
+		WHERE bs.bundle_id = $1 AND s.active = TRUE AND (e.status = 'COMPLETED' OR (e.on_demand AND e.status <> 'FAILED'))
+		ORDER BY e.published_at DESC NULLS LAST, e.id DESC
+		LIMIT $2
+	`
+	err := DB.Select(&episodes, query, bundleID, limit)
+	return episodes, err
+}
+
+// inTx runs fn in a transaction, committing when it succeeds.
+func inTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/youtube"
+)
+
+// ChannelResolutionCache stores resolved YouTube references in the
+// channel_resolutions table. It implements youtube.Cache.
+type ChannelResolutionCache struct{}
+
+// resolutionKey normalizes case-insensitive reference kinds so @Handle and @handle share a row
+func resolutionKey(ref youtube.Ref) (string, string) {
+	switch ref.Kind {
+	case youtube.KindHandle, youtube.KindUser, youtube.KindCustom:
+		return string(ref.Kind), strings.ToLower(ref.ID)
+	}
+	return string(ref.Kind), ref.ID
+}
+
+// Get returns the cached resolution of ref, or nil if it was never resolved.
+func (ChannelResolutionCache) Get(ref youtube.Ref) (*youtube.CacheEntry, error) {
+	kind, id := resolutionKey(ref)
+	resolution := models.ChannelResolution{}
+	err := DB.Get(&resolution, "SELECT * FROM channel_resolutions WHERE ref_kind = $1 AND ref_id = $2", kind, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &youtube.CacheEntry{
+		Info:       youtube.ChannelInfo{ChannelID: resolution.YoutubeChannelID, Title: resolution.Title},
+		ResolvedAt: resolution.ResolvedAt,
+	}, nil
+}
+
+// Put stores or refreshes the resolution of ref.
+func (ChannelResolutionCache) Put(ref youtube.Ref, info youtube.ChannelInfo) error {
+	kind, id := resolutionKey(ref)
+	_, err := DB.Exec(`
+		INSERT INTO channel_resolutions (ref_kind, ref_id, youtube_channel_id, title)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ref_kind, ref_id) DO UPDATE SET
+			youtube_channel_id = EXCLUDED.youtube_channel_id,
+			title = EXCLUDED.title,
+			resolved_at = NOW()
+	`, kind, id, info.ChannelID, info.Title)
+	return err
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"log"
+	"time"
+	"yt-podcaster/internal/models"
+)
+
+const (
+	ChannelStatusActive     = "active"
+	ChannelStatusRenamed    = "renamed"
+	ChannelStatusTerminated = "terminated"
+)
+
+// terminatedRecheckInterval is how often terminated channels are looked at
+// again, so that one wrongly flagged or reinstated comes back
+const terminatedRecheckInterval = 7 * 24 * time.Hour
+
+func GetChannel(provider string, channelID string) (models.Channel, error) {
+	channel := models.Channel{}
+	err := DB.Get(&channel, "SELECT * FROM channels WHERE provider = $1 AND youtube_channel_id = $2", provider, channelID)
+	return channel, err
+}
+
+// GetChannelsToRefresh returns the channels behind active channel subscriptions,
+// least recently refreshed first. Channels that were never refreshed have no row yet
+// and only carry their provider and ID. Terminated channels are included once a week.
+func GetChannelsToRefresh(limit int) ([]models.Channel, error) {
+	query := `
+		SELECT s.provider, s.youtube_channel_id, COALESCE(c.title, '') AS title, COALESCE(c.status, 'active') AS status, c.refreshed_at
+		FROM (
+			SELECT DISTINCT provider, youtube_channel_id
+			FROM subscriptions
+			WHERE active = TRUE AND source_type = 'channel'
+		) s
+		LEFT JOIN channels c ON c.provider = s.provider AND c.youtube_channel_id = s.youtube_channel_id
+		WHERE c.status IS DISTINCT FROM 'terminated' OR c.refreshed_at < $2
+		ORDER BY c.refreshed_at ASC NULLS FIRST
+		LIMIT $1
+	`
+	var channels []models.Channel
+	err := DB.Select(&channels, query, limit, time.Now().Add(-terminatedRecheckInterval))
+	if err != nil {
+		log.Printf("Error getting channels to refresh: %v", err)
+		return nil, err
+	}
+	return channels, nil
+}
+
+// UpsertChannel stores freshly fetched channel metadata.
+func UpsertChannel(channel models.Channel) error {
+	_, err := DB.Exec(`
+		INSERT INTO channels (provider, youtube_channel_id, title, handle, description, avatar_url, banner_url, subscriber_count, language, status, previous_title, refreshed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		ON CONFLICT (provider, youtube_channel_id) DO UPDATE SET
+			title = EXCLUDED.title,
+			handle = EXCLUDED.handle,
+			description = EXCLUDED.description,
+			avatar_url = EXCLUDED.avatar_url,
+			banner_url = EXCLUDED.banner_url,
+			subscriber_count = EXCLUDED.subscriber_count,
+			language = EXCLUDED.language,
+			status = EXCLUDED.status,
+			previous_title = EXCLUDED.previous_title,
+			refreshed_at = NOW()
+	`, channel.Provider, channel.YoutubeChannelID, channel.Title, channel.Handle, channel.Description, channel.AvatarURL, channel.BannerURL, channel.SubscriberCount, channel.Language, channel.Status, channel.PreviousTitle)
+	return err
+}
+
+// MarkChannelTerminated flags a channel that no longer exists so it stops being checked.
+func MarkChannelTerminated(provider string, channelID string) error {
+	_, err := DB.Exec(`
+		INSERT INTO channels (provider, youtube_channel_id, status, refreshed_at)
+		VALUES ($1, $2, 'terminated', NOW())
+		ON CONFLICT (provider, youtube_channel_id) DO UPDATE SET
+			status = 'terminated',
+			refreshed_at = NOW()
+	`, provider, channelID)
+	return err
+}
+
+// RenameChannelSubscriptions updates the stored title of every subscription to a renamed channel.
+func RenameChannelSubscriptions(provider string, channelID string, title string) error {
+	_, err := DB.Exec("UPDATE subscriptions SET youtube_channel_title = $3 WHERE provider = $1 AND youtube_channel_id = $2 AND source_type = 'channel'", provider, channelID, title)
+	return err
+}
+
+// GetChannelSubscriberIDs returns the users with an active subscription to a channel or its playlists.
+func GetChannelSubscriberIDs(provider string, channelID string) ([]int64, error) {
+	var userIDs []int64
+	err := DB.Select(&userIDs, "SELECT DISTINCT user_id FROM subscriptions WHERE provider = $1 AND youtube_channel_id = $2 AND active = TRUE", provider, channelID)
+	return userIDs, err
+}
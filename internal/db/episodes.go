@@ -10,49 +10,144 @@ const (
 	StatusProcessing = "PROCESSING"
 	StatusCompleted  = "COMPLETED"
 	StatusFailed     = "FAILED"
+	// StatusOnDemand episodes only have metadata until their audio is first requested
+	StatusOnDemand = "ON_DEMAND"
 )
 
+// CreateEpisode adds a video of a subscription, inheriting the subscription's provider.
 func CreateEpisode(subID int, videoID string) (models.Episode, error) {
 	episode := models.Episode{}
-	err := DB.Get(&episode, "INSERT INTO episodes (subscription_id, youtube_video_id) VALUES ($1, $2) RETURNING *", subID, videoID)
+	err := DB.Get(&episode, "INSERT INTO episodes (subscription_id, youtube_video_id, provider) SELECT $1, $2, provider FROM subscriptions WHERE id = $1 RETURNING *", subID, videoID)
 	return episode, err
 }
 
-func GetEpisodeByYoutubeID(videoID string) (models.Episode, error) {
+func CreatePlaylistEpisode(subID int, videoID string, position int) (models.Episode, error) {
 	episode := models.Episode{}
-	err := DB.Get(&episode, "SELECT * FROM episodes WHERE youtube_video_id = $1", videoID)
+	err := DB.Get(&episode, "INSERT INTO episodes (subscription_id, youtube_video_id, playlist_position) VALUES ($1, $2, $3) RETURNING *", subID, videoID, position)
 	return episode, err
 }
 
+// CreateOnDemandEpisode lists a video of an on-demand subscription with the
+// metadata its listing gave, leaving the audio to be fetched on first request.
+func CreateOnDemandEpisode(subID int, videoID string, position *int, title string, description string, duration int, publishedAt time.Time) (models.Episode, error) {
+	episode := models.Episode{}
+	query := `
+		INSERT INTO episodes (subscription_id, youtube_video_id, provider, playlist_position, title, description, duration_seconds, published_at, status, on_demand)
+		SELECT $1, $2, provider, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, 0), $7, 'ON_DEMAND', TRUE FROM subscriptions WHERE id = $1
+		RETURNING *
+	`
+	err := DB.Get(&episode, query, subID, videoID, position, title, description, duration, publishedAt)
+	return episode, err
+}
+
+// CreateInboxEpisode queues a single video in the user's listen later feed.
+func CreateInboxEpisode(userID int64, provider string, videoID string) (models.Episode, error) {
+	episode := models.Episode{}
+	err := DB.Get(&episode, "INSERT INTO episodes (user_id, provider, youtube_video_id) VALUES ($1, $2, $3) RETURNING *", userID, provider, videoID)
+	return episode, err
+}
+
+func GetEpisodeByID(id int) (models.Episode, error) {
+	episode := models.Episode{}
+	err := DB.Get(&episode, "SELECT * FROM episodes WHERE id = $1", id)
+	return episode, err
+}
+
+func GetEpisodeByYoutubeID(subID int, videoID string) (models.Episode, error) {
+	episode := models.Episode{}
+	err := DB.Get(&episode, "SELECT * FROM episodes WHERE subscription_id = $1 AND youtube_video_id = $2", subID, videoID)
+	return episode, err
+}
+
+// UpdateEpisodePlaylistPosition keeps the stored position in sync when a playlist is reordered.
+func UpdateEpisodePlaylistPosition(id int, position int) error {
+	_, err := DB.Exec("UPDATE episodes SET playlist_position = $1 WHERE id = $2", position, id)
+	return err
+}
+
 func UpdateEpisodeStatus(id int, status string) error {
-	_, err := DB.Exec("UPDATE episodes SET status = $1 WHERE id = $2", status, id)
+	_, err := DB.Exec("UPDATE episodes SET status = $1, updated_at = NOW() WHERE id = $2", status, id)
 	return err
 }
 
+// RequestOnDemandEpisode marks an on-demand episode's audio as wanted. It
+// returns false when an earlier request already did.
+func RequestOnDemandEpisode(id int) (bool, error) {
+	result, err := DB.Exec("UPDATE episodes SET status = 'PENDING', updated_at = NOW() WHERE id = $1 AND status = 'ON_DEMAND'", id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func GetEpisodeStatus(id int) (string, error) {
+	var status string
+	err := DB.Get(&status, "SELECT status FROM episodes WHERE id = $1", id)
+	return status, err
+}
+
 func UpdateEpisodeProcessingSuccess(id int, title string, description string, audioPath string, audioSize int64, duration int, publishedAt time.Time) error {
 	_, err := DB.Exec(`
 		UPDATE episodes
-		SET status = 'COMPLETED', title = $1, description = $2, audio_path = $3, audio_size_bytes = $4, duration_seconds = $5, published_at = $6
+		SET status = 'COMPLETED', title = $1, description = $2, audio_path = $3, audio_size_bytes = $4, duration_seconds = $5, published_at = $6, updated_at = NOW()
 		WHERE id = $7`,
 		title, description, audioPath, audioSize, duration, publishedAt, id)
 	return err
 }
 
+// GetStoredEpisodeByVideoID returns a completed episode of the same video
+// other than excludeID, whose audio can be shared instead of fetched again.
+func GetStoredEpisodeByVideoID(provider string, videoID string, excludeID int) (models.Episode, error) {
+	episode := models.Episode{}
+	query := `
+		SELECT * FROM episodes
+		WHERE provider = $1 AND youtube_video_id = $2 AND id <> $3 AND status = 'COMPLETED' AND audio_path IS NOT NULL
+		ORDER BY id
+		LIMIT 1
+	`
+	err := DB.Get(&episode, query, provider, videoID, excludeID)
+	return episode, err
+}
+
+// CompleteEpisodeFromStored completes an episode with the metadata of the
+// stored episode its audio at audioPath was linked from.
+func CompleteEpisodeFromStored(id int, storedID int, audioPath string) error {
+	_, err := DB.Exec(`
+		UPDATE episodes e
+		SET status = 'COMPLETED', title = s.title, description = s.description, audio_path = $3,
+			audio_size_bytes = s.audio_size_bytes, duration_seconds = s.duration_seconds, published_at = s.published_at, updated_at = NOW()
+		FROM episodes s
+		WHERE e.id = $1 AND s.id = $2`,
+		id, storedID, audioPath)
+	return err
+}
+
+// SetEpisodeHLSReady records that an episode's audio was packaged as HLS.
+func SetEpisodeHLSReady(id int) error {
+	_, err := DB.Exec("UPDATE episodes SET hls_ready = TRUE WHERE id = $1", id)
+	return err
+}
+
 func UpdateEpisodeProcessingFailed(id int) error {
-	_, err := DB.Exec("UPDATE episodes SET status = 'FAILED' WHERE id = $1", id)
+	_, err := DB.Exec("UPDATE episodes SET status = 'FAILED', updated_at = NOW() WHERE id = $1", id)
 	return err
 }
 
-func GetCompletedEpisodesByUserID(userID int64) ([]models.Episode, error) {
-	var episodes []models.Episode
+// GetCompletedEpisodesByUserID returns the newest episodes of a user's active
+// subscriptions that are included in the combined feed.
+func GetCompletedEpisodesByUserID(userID int64, limit int) ([]models.SubscriptionEpisode, error) {
+	var episodes []models.SubscriptionEpisode
 	query := `
-		SELECT e.*
+		SELECT e.*, s.youtube_channel_title AS subscription_title
 		FROM episodes e
 		JOIN subscriptions s ON e.subscription_id = s.id
-		WHERE s.user_id = $1 AND e.status = 'COMPLETED'
-		ORDER BY e.created_at DESC
+		WHERE s.user_id = $1 AND s.active = TRUE AND s.in_combined_feed = TRUE
+			AND (e.status = 'COMPLETED' OR (e.on_demand AND e.status <> 'FAILED'))
+		ORDER BY e.published_at DESC NULLS LAST, e.id DESC
+		LIMIT $2
 	`
-	err := DB.Select(&episodes, query, userID)
+	err := DB.Select(&episodes, query, userID, limit)
 	return episodes, err
 }
 
@@ -69,13 +164,99 @@ func GetFailedEpisodesOlderThan(duration time.Duration) ([]models.Episode, error
 	return episodes, err
 }
 
-func GetCompletedEpisodesBySubscriptionID(subscriptionID int) ([]models.Episode, error) {
+// CountCompletedEpisodesBySubscriptionID counts the episodes a subscription's feed pages through.
+func CountCompletedEpisodesBySubscriptionID(subscriptionID int) (int, error) {
+	var count int
+	err := DB.Get(&count, "SELECT COUNT(*) FROM episodes WHERE subscription_id = $1 AND (status = 'COMPLETED' OR (on_demand AND status <> 'FAILED'))", subscriptionID)
+	return count, err
+}
+
+// GetCompletedEpisodesBySubscriptionID returns one page of a subscription's
+// episodes, newest first, skipping the offset newest ones.
+// On-demand episodes are listed while their audio is yet to be fetched.
+func GetCompletedEpisodesBySubscriptionID(subscriptionID int, limit int, offset int) ([]models.Episode, error) {
+	var episodes []models.Episode
+	query := `
+		SELECT * FROM episodes
+		WHERE subscription_id = $1 AND (status = 'COMPLETED' OR (on_demand AND status <> 'FAILED'))
+		ORDER BY published_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+	err := DB.Select(&episodes, query, subscriptionID, limit, offset)
+	return episodes, err
+}
+
+// GetCompletedEpisodesByPlaylistPosition returns one page of a playlist
+// subscription's episodes in playlist order, which is what serial shows expect.
+func GetCompletedEpisodesByPlaylistPosition(subscriptionID int, limit int, offset int) ([]models.Episode, error) {
 	var episodes []models.Episode
 	query := `
 		SELECT * FROM episodes
-		WHERE subscription_id = $1 AND status = 'COMPLETED'
-		ORDER BY published_at DESC
+		WHERE subscription_id = $1 AND (status = 'COMPLETED' OR (on_demand AND status <> 'FAILED'))
+		ORDER BY playlist_position ASC NULLS LAST, published_at ASC, id ASC
+		LIMIT $2 OFFSET $3
 	`
-	err := DB.Select(&episodes, query, subscriptionID)
+	err := DB.Select(&episodes, query, subscriptionID, limit, offset)
 	return episodes, err
 }
+
+// GetInboxEpisodesByUserID returns every one-off episode a user queued, whatever its status.
+func GetInboxEpisodesByUserID(userID int64) ([]models.Episode, error) {
+	var episodes []models.Episode
+	query := `
+		SELECT * FROM episodes
+		WHERE user_id = $1 AND subscription_id IS NULL
+		ORDER BY created_at DESC
+	`
+	err := DB.Select(&episodes, query, userID)
+	return episodes, err
+}
+
+// GetCompletedInboxEpisodesByUserID returns the episodes of a user's listen later feed.
+func GetCompletedInboxEpisodesByUserID(userID int64) ([]models.Episode, error) {
+	var episodes []models.Episode
+	query := `
+		SELECT * FROM episodes
+		WHERE user_id = $1 AND subscription_id IS NULL AND status = 'COMPLETED'
+		ORDER BY created_at DESC
+	`
+	err := DB.Select(&episodes, query, userID)
+	return episodes, err
+}
+
+// GetAudioAccess returns the feed tokens a completed or on-demand episode's
+// audio can be served for. Deleted subscriptions and expired retired tokens contribute none.
+func GetAudioAccess(audioUUID string) (models.AudioAccess, error) {
+	var access models.AudioAccess
+	query := `
+		SELECT e.id, e.youtube_video_id, e.status, e.audio_uuid, ARRAY(
+			SELECT s.rss_uuid::text FROM subscriptions s
+			WHERE s.id = e.subscription_id AND s.active = TRUE
+			UNION ALL
+			SELECT t.rss_uuid::text FROM retired_feed_tokens t
+			JOIN subscriptions s ON s.id = t.subscription_id
+			WHERE t.subscription_id = e.subscription_id AND t.expires_at > NOW() AND s.active = TRUE
+			UNION ALL
+			SELECT u.combined_rss_uuid::text FROM subscriptions s
+			JOIN users u ON u.id = s.user_id
+			WHERE s.id = e.subscription_id AND s.active = TRUE AND s.in_combined_feed = TRUE
+			UNION ALL
+			SELECT b.rss_uuid::text FROM bundles b
+			JOIN bundle_subscriptions bs ON bs.bundle_id = b.id
+			JOIN subscriptions s ON s.id = bs.subscription_id
+			WHERE s.id = e.subscription_id AND s.active = TRUE
+			UNION ALL
+			-- Which smart feeds match changes with time, so any of the owner's will do
+			SELECT f.rss_uuid::text FROM smart_feeds f
+			JOIN subscriptions s ON s.user_id = f.user_id
+			WHERE s.id = e.subscription_id AND s.active = TRUE
+			UNION ALL
+			SELECT u.rss_uuid::text FROM users u
+			WHERE u.id = e.user_id AND e.subscription_id IS NULL
+		) AS feed_tokens
+		FROM episodes e
+		WHERE e.audio_uuid = $1 AND (e.status = 'COMPLETED' OR (e.on_demand AND e.status <> 'FAILED'))
+	`
+	err := DB.Get(&access, query, audioUUID)
+	return access, err
+}
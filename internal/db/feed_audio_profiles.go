@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// GetFeedAudioProfile returns the audio variant the feed at an RSS UUID links
+// to. A subscription's retired UUIDs share the profile of its current one.
+func GetFeedAudioProfile(rssUUID string) (string, error) {
+	var profile string
+	query := `
+		SELECT profile
+		FROM feed_audio_profiles
+		WHERE rss_uuid = $1 OR rss_uuid = (
+			SELECT s.rss_uuid FROM retired_feed_tokens t
+			JOIN subscriptions s ON s.id = t.subscription_id
+			WHERE t.rss_uuid = $1 AND t.expires_at > NOW()
+		)
+	`
+	err := DB.Get(&profile, query, rssUUID)
+	return profile, err
+}
+
+// SetFeedAudioProfile makes a user's feed link to an audio variant.
+func SetFeedAudioProfile(userID int64, rssUUID string, profile string) error {
+	query := `
+		INSERT INTO feed_audio_profiles (rss_uuid, user_id, profile)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (rss_uuid) DO UPDATE
+		SET profile = EXCLUDED.profile, updated_at = NOW()
+		WHERE feed_audio_profiles.user_id = EXCLUDED.user_id
+	`
+	result, err := DB.Exec(query, rssUUID, userID, profile)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteFeedAudioProfile makes a user's feed link to the original audio again.
+func DeleteFeedAudioProfile(userID int64, rssUUID string) error {
+	_, err := DB.Exec("DELETE FROM feed_audio_profiles WHERE rss_uuid = $1 AND user_id = $2", rssUUID, userID)
+	return err
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+
+	"yt-podcaster/internal/models"
+)
+
+// UserOwnsFeed reports whether a user owns the feed at an RSS UUID: one of
+// their active subscriptions, bundles or smart feeds, or their listen later or
+// combined feed.
+func UserOwnsFeed(userID int64, rssUUID string) (bool, error) {
+	var owned bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM subscriptions WHERE user_id = $1 AND rss_uuid = $2 AND active = TRUE)
+			OR EXISTS (SELECT 1 FROM bundles WHERE user_id = $1 AND rss_uuid = $2)
+			OR EXISTS (SELECT 1 FROM smart_feeds WHERE user_id = $1 AND rss_uuid = $2)
+			OR EXISTS (SELECT 1 FROM users WHERE id = $1 AND $2 IN (rss_uuid, combined_rss_uuid))
+	`
+	err := DB.Get(&owned, query, userID, rssUUID)
+	return owned, err
+}
+
+// GetFeedCredentials returns the credentials of the feed at an RSS UUID. A
+// subscription's retired UUIDs share the credentials of its current one.
+func GetFeedCredentials(rssUUID string) (models.FeedCredentials, error) {
+	var credentials models.FeedCredentials
+	query := `
+		SELECT rss_uuid, user_id, username, password_hash, created_at
+		FROM feed_credentials
+		WHERE rss_uuid = $1 OR rss_uuid = (
+			SELECT s.rss_uuid FROM retired_feed_tokens t
+			JOIN subscriptions s ON s.id = t.subscription_id
+			WHERE t.rss_uuid = $1 AND t.expires_at > NOW()
+		)
+	`
+	err := DB.Get(&credentials, query, rssUUID)
+	return credentials, err
+}
+
+// GetUserFeedCredentials returns the credentials a user set on one of their feeds.
+func GetUserFeedCredentials(userID int64, rssUUID string) (models.FeedCredentials, error) {
+	var credentials models.FeedCredentials
+	query := `
+		SELECT rss_uuid, user_id, username, password_hash, created_at
+		FROM feed_credentials
+		WHERE rss_uuid = $1 AND user_id = $2
+	`
+	err := DB.Get(&credentials, query, rssUUID, userID)
+	return credentials, err
+}
+
+// SetFeedCredentials makes a user's feed private, replacing any credentials it had.
+func SetFeedCredentials(userID int64, rssUUID string, username string, passwordHash string) (models.FeedCredentials, error) {
+	var credentials models.FeedCredentials
+	query := `
+		INSERT INTO feed_credentials (rss_uuid, user_id, username, password_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (rss_uuid) DO UPDATE
+		SET username = EXCLUDED.username, password_hash = EXCLUDED.password_hash, created_at = NOW()
+		WHERE feed_credentials.user_id = EXCLUDED.user_id
+		RETURNING rss_uuid, user_id, username, password_hash, created_at
+	`
+	err := DB.Get(&credentials, query, rssUUID, userID, username, passwordHash)
+	return credentials, err
+}
+
+// DeleteFeedCredentials makes a user's feed public again.
+func DeleteFeedCredentials(userID int64, rssUUID string) error {
+	result, err := DB.Exec("DELETE FROM feed_credentials WHERE rss_uuid = $1 AND user_id = $2", rssUUID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/smartfeed"
+)
+
+const smartFeedColumns = "id, user_id, title, rule, rss_uuid, created_at, updated_at"
+
+// GetSmartFeedsByUserID returns a user's smart feeds, oldest first.
+func GetSmartFeedsByUserID(userID int64) ([]models.SmartFeed, error) {
+	var feeds []models.SmartFeed
+	err := DB.Select(&feeds, "SELECT "+smartFeedColumns+" FROM smart_feeds WHERE user_id = $1 ORDER BY created_at, id", userID)
+	return feeds, err
+}
+
+// GetSmartFeedByRSSUUID returns the smart feed served at a feed UUID.
+func GetSmartFeedByRSSUUID(rssUUID string) (models.SmartFeed, error) {
+	var feed models.SmartFeed
+	err := DB.Get(&feed, "SELECT "+smartFeedColumns+" FROM smart_feeds WHERE rss_uuid = $1", rssUUID)
+	return feed, err
+}
+
+// CreateSmartFeed stores a smart feed for a user.
+func CreateSmartFeed(userID int64, title string, rule smartfeed.Rule) (models.SmartFeed, error) {
+	var feed models.SmartFeed
+	err := DB.Get(&feed, `
+		INSERT INTO smart_feeds (user_id, title, rule)
+		VALUES ($1, $2, $3)
+		RETURNING `+smartFeedColumns, userID, title, rule)
+	return feed, err
+}
+
+// UpdateSmartFeed replaces the title and rule of a user's smart feed.
+// It returns sql.ErrNoRows when the user has no such feed.
+func UpdateSmartFeed(userID int64, feedID int, title string, rule smartfeed.Rule) error {
+	result, err := DB.Exec(`
+		UPDATE smart_feeds SET title = $3, rule = $4, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, feedID, userID, title, rule)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSmartFeed removes a user's smart feed; its feed stops being served.
+func DeleteSmartFeed(userID int64, feedID int) error {
+	result, err := DB.Exec("DELETE FROM smart_feeds WHERE id = $1 AND user_id = $2", feedID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetEpisodesMatchingRule returns the newest completed episodes of a user's
+// active subscriptions that match a smart feed rule.
+func GetEpisodesMatchingRule(userID int64, rule smartfeed.Rule, limit int) ([]models.SubscriptionEpisode, error) {
+	condition, ruleArgs, err := rule.Compile(3)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smart feed rule: %w", err)
+	}
+
+	var episodes []models.SubscriptionEpisode
+	query := `
+		SELECT e.*, s.youtube_channel_title AS subscription_title
+		FROM episodes e
+		JOIN subscriptions s ON e.subscription_id = s.id
+		WHERE s.user_id = $1 AND s.active = TRUE AND (e.status = 'COMPLETED' OR (e.on_demand AND e.status <> 'FAILED')) AND (` + condition + `)
+		ORDER BY e.published_at DESC NULLS LAST, e.id DESC
+		LIMIT $2
+	`
+	args := append([]interface{}{userID, limit}, ruleArgs...)
+	err = DB.Select(&episodes, query, args...)
+	return episodes, err
+}
@@ -1,8 +1,19 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"log"
+	"time"
+
 	"yt-podcaster/internal/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	SourceTypeChannel  = "channel"
+	SourceTypePlaylist = "playlist"
 )
 
 func GetSubscriptionByID(id int) (models.Subscription, error) {
@@ -13,7 +24,7 @@ func GetSubscriptionByID(id int) (models.Subscription, error) {
 
 func GetSubscriptionsByUserID(userID int64) ([]models.Subscription, error) {
 	query := `
-		SELECT id, user_id, youtube_channel_id, youtube_channel_title, rss_uuid, active, created_at
+		SELECT id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, active, in_combined_feed, on_demand, created_at
 		FROM subscriptions
 		WHERE user_id = $1 AND active = TRUE
 		ORDER BY created_at DESC
@@ -42,7 +53,7 @@ func AddSubscription(userID int64, channelID string, channelTitle string) (*mode
 	query := `
 		INSERT INTO subscriptions (user_id, youtube_channel_id, youtube_channel_title)
 		VALUES ($1, $2, $3)
-		RETURNING id, user_id, youtube_channel_id, youtube_channel_title, rss_uuid, active, created_at
+		RETURNING id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, active, in_combined_feed, on_demand, created_at
 	`
 	sub := &models.Subscription{}
 	err := DB.Get(sub, query, userID, channelID, channelTitle)
@@ -53,6 +64,37 @@ func AddSubscription(userID int64, channelID string, channelTitle string) (*mode
 	return sub, nil
 }
 
+func AddPlaylistSubscription(userID int64, channelID string, playlistID string, playlistTitle string) (*models.Subscription, error) {
+	query := `
+		INSERT INTO subscriptions (user_id, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id)
+		VALUES ($1, $2, $3, 'playlist', $4)
+		RETURNING id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, active, in_combined_feed, on_demand, created_at
+	`
+	sub := &models.Subscription{}
+	err := DB.Get(sub, query, userID, channelID, playlistTitle, playlistID)
+	if err != nil {
+		log.Printf("Error adding playlist subscription for user %d: %v", userID, err)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// AddProviderSubscription subscribes a user to a source on a non-YouTube provider.
+func AddProviderSubscription(userID int64, provider string, sourceID string, title string) (*models.Subscription, error) {
+	query := `
+		INSERT INTO subscriptions (user_id, provider, youtube_channel_id, youtube_channel_title)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, active, in_combined_feed, on_demand, created_at
+	`
+	sub := &models.Subscription{}
+	err := DB.Get(sub, query, userID, provider, sourceID, title)
+	if err != nil {
+		log.Printf("Error adding %s subscription for user %d: %v", provider, userID, err)
+		return nil, err
+	}
+	return sub, nil
+}
+
 func DeleteSubscription(userID int64, subscriptionID int) error {
 	query := `
 		UPDATE subscriptions
@@ -68,10 +110,58 @@ func DeleteSubscription(userID int64, subscriptionID int) error {
 	return nil
 }
 
+// SetSubscriptionInCombinedFeed includes or excludes a user's subscription from their combined feed.
+func SetSubscriptionInCombinedFeed(userID int64, subscriptionID int, include bool) error {
+	result, err := DB.Exec("UPDATE subscriptions SET in_combined_feed = $3 WHERE id = $1 AND user_id = $2 AND active = TRUE", subscriptionID, userID, include)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSubscriptionOnDemand switches whether a user's subscription fetches the
+// audio of new videos only once it is requested.
+func SetSubscriptionOnDemand(userID int64, subscriptionID int, onDemand bool) error {
+	result, err := DB.Exec("UPDATE subscriptions SET on_demand = $3 WHERE id = $1 AND user_id = $2 AND active = TRUE", subscriptionID, userID, onDemand)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateSubscriptionFeedSettings replaces the feed overrides of a user's subscription.
+func UpdateSubscriptionFeedSettings(userID int64, subscriptionID int, settings models.FeedSettings) error {
+	query := `
+		UPDATE subscriptions
+		SET feed_title = $3, feed_description = $4, feed_image_url = $5, feed_author = $6,
+			feed_category = $7, feed_language = $8, feed_type = $9, feed_explicit = $10, feed_rewrite = $11
+		WHERE id = $1 AND user_id = $2 AND active = TRUE
+	`
+	result, err := DB.Exec(query, subscriptionID, userID, settings.Title, settings.Description, settings.ImageURL,
+		settings.Author, settings.Category, settings.Language, settings.Type, settings.Explicit, settings.Rewrite)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// feedColumns are the subscription columns its feed is rendered from
+const feedColumns = `id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, original_rss_uuid, active, in_combined_feed, created_at,
+	feed_title, feed_description, feed_image_url, feed_author, feed_category, feed_language, feed_type, feed_explicit, feed_rewrite`
+
 func GetSubscriptionByRSSUUID(rssUUID string) (models.Subscription, error) {
 	subscription := models.Subscription{}
 	query := `
-		SELECT id, user_id, youtube_channel_id, youtube_channel_title, rss_uuid, active, created_at
+		SELECT ` + feedColumns + `
 		FROM subscriptions
 		WHERE rss_uuid = $1 AND active = TRUE
 	`
@@ -82,11 +172,85 @@ func GetSubscriptionByRSSUUID(rssUUID string) (models.Subscription, error) {
 	return subscription, err
 }
 
-func GetAllSubscriptions() ([]models.Subscription, error) {
+// GetSubscriptionByRetiredRSSUUID returns the subscription a rotated-out RSS
+// UUID belonged to while its grace period lasts.
+func GetSubscriptionByRetiredRSSUUID(rssUUID string) (models.Subscription, error) {
+	subscription := models.Subscription{}
 	query := `
-		SELECT id, user_id, youtube_channel_id, youtube_channel_title, rss_uuid, active, created_at
+		SELECT ` + feedColumns + `
 		FROM subscriptions
+		WHERE active = TRUE AND id = (
+			SELECT subscription_id FROM retired_feed_tokens
+			WHERE rss_uuid = $1 AND expires_at > NOW()
+		)
+	`
+	err := DB.Get(&subscription, query, rssUUID)
+	return subscription, err
+}
+
+// RotateSubscriptionRSSUUID gives a user's subscription a new RSS UUID and
+// returns it. The old UUID keeps serving the feed for grace, or stops at once
+// when grace is 0, which also ends the grace periods of earlier rotations.
+func RotateSubscriptionRSSUUID(userID int64, subscriptionID int, grace time.Duration) (string, error) {
+	var rotated struct {
+		OldUUID string `db:"old_uuid"`
+		NewUUID string `db:"new_uuid"`
+	}
+	err := inTx(func(tx *sqlx.Tx) error {
+		query := `
+			WITH old AS (
+				SELECT id, rss_uuid FROM subscriptions
+				WHERE id = $1 AND user_id = $2 AND active = TRUE
+				FOR UPDATE
+			)
+			UPDATE subscriptions s
+			SET original_rss_uuid = COALESCE(s.original_rss_uuid, old.rss_uuid), rss_uuid = gen_random_uuid()
+			FROM old
+			WHERE s.id = old.id
+			RETURNING old.rss_uuid AS old_uuid, s.rss_uuid AS new_uuid
+		`
+		if err := tx.Get(&rotated, query, subscriptionID, userID); err != nil {
+			return err
+		}
+		// The feed keeps its credentials, stats and audio variant under its new URL
+		for _, table := range []string{"feed_credentials", "feed_daily_stats", "feed_audio_profiles"} {
+			if _, err := tx.Exec("UPDATE "+table+" SET rss_uuid = $1 WHERE rss_uuid = $2", rotated.NewUUID, rotated.OldUUID); err != nil {
+				return err
+			}
+		}
+
+		if grace <= 0 {
+			_, err := tx.Exec("DELETE FROM retired_feed_tokens WHERE subscription_id = $1", subscriptionID)
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM retired_feed_tokens WHERE subscription_id = $1 AND expires_at <= NOW()", subscriptionID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO retired_feed_tokens (rss_uuid, subscription_id, expires_at) VALUES ($1, $2, $3)",
+			rotated.OldUUID, subscriptionID, time.Now().Add(grace),
+		)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error rotating RSS UUID of subscription %d for user %d: %v", subscriptionID, userID, err)
+		}
+		return "", err
+	}
+	return rotated.NewUUID, nil
+}
+
+func GetAllSubscriptions() ([]models.Subscription, error) {
+	query := `
+		SELECT id, user_id, provider, youtube_channel_id, youtube_channel_title, source_type, youtube_playlist_id, rss_uuid, active, in_combined_feed, on_demand, created_at
+		FROM subscriptions s
 		WHERE active = TRUE
+			-- Terminated channels have nothing left to check
+			AND NOT EXISTS (
+				SELECT 1 FROM channels c
+				WHERE c.provider = s.provider AND c.youtube_channel_id = s.youtube_channel_id AND c.status = 'terminated'
+			)
 		ORDER BY created_at DESC
 	`
 	var subscriptions []models.Subscription
@@ -13,7 +13,7 @@ func UpsertUser(id int64, username string) (*models.User, error) {
 		ON CONFLICT (id) DO UPDATE SET
 			telegram_username = EXCLUDED.telegram_username,
 			updated_at = NOW()
-		RETURNING id, telegram_username, rss_uuid, created_at, updated_at
+		RETURNING id, telegram_username, rss_uuid, combined_rss_uuid, created_at, updated_at
 	`
 	user := &models.User{}
 	err := DB.Get(user, query, id, username)
@@ -27,7 +27,7 @@ func UpsertUser(id int64, username string) (*models.User, error) {
 // FindOrCreateUserByTelegramID finds a user by their telegram ID or creates a new one.
 func FindOrCreateUserByTelegramID(telegramID int64, username string) (*models.User, error) {
 	query := `
-		SELECT id, telegram_username, rss_uuid, created_at, updated_at
+		SELECT id, telegram_username, rss_uuid, combined_rss_uuid, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -47,7 +47,7 @@ func FindOrCreateUserByTelegramID(telegramID int64, username string) (*models.Us
 // GetUserByRSSUUID retrieves a user by their RSS UUID.
 func GetUserByRSSUUID(uuid string) (*models.User, error) {
 	query := `
-		SELECT id, telegram_username, rss_uuid, created_at, updated_at
+		SELECT id, telegram_username, rss_uuid, combined_rss_uuid, created_at, updated_at
 		FROM users
 		WHERE rss_uuid = $1
 	`
@@ -59,3 +59,18 @@ func GetUserByRSSUUID(uuid string) (*models.User, error) {
 	}
 	return user, nil
 }
+
+// GetUserByCombinedRSSUUID retrieves a user by the UUID of their combined feed.
+func GetUserByCombinedRSSUUID(uuid string) (*models.User, error) {
+	query := `
+		SELECT id, telegram_username, rss_uuid, combined_rss_uuid, created_at, updated_at
+		FROM users
+		WHERE combined_rss_uuid = $1
+	`
+	user := &models.User{}
+	err := DB.Get(user, query, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
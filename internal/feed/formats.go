@@ -0,0 +1,306 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is an output format of feeds. Every format renders the same episodes
+// with their audio attached.
+type Format string
+
+const (
+	FormatRSS  Format = "rss"
+	FormatAtom Format = "atom"
+	FormatJSON Format = "json"
+)
+
+// formatSuffixes select a format by the end of the feed path, as in /rss/{uuid}.atom
+var formatSuffixes = map[string]Format{
+	".rss":  FormatRSS,
+	".xml":  FormatRSS,
+	".atom": FormatAtom,
+	".json": FormatJSON,
+}
+
+// formatMediaTypes select a format by Accept header
+var formatMediaTypes = map[string]Format{
+	"application/rss+xml":   FormatRSS,
+	"application/xml":       FormatRSS,
+	"text/xml":              FormatRSS,
+	"application/atom+xml":  FormatAtom,
+	"application/feed+json": FormatJSON,
+	"application/json":      FormatJSON,
+}
+
+// ContentType is the media type a format is served as.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatAtom:
+		return "application/atom+xml"
+	case FormatJSON:
+		return "application/feed+json"
+	default:
+		return "application/rss+xml"
+	}
+}
+
+// suffix is appended to the feed URL of a format; RSS keeps the bare URL
+func (f Format) suffix() string {
+	switch f {
+	case FormatAtom:
+		return ".atom"
+	case FormatJSON:
+		return ".json"
+	default:
+		return ""
+	}
+}
+
+// SplitFormat strips a format suffix from a feed ID, so "uuid.atom" becomes
+// "uuid" and FormatAtom. ok is false when the ID has no known suffix.
+func SplitFormat(id string) (string, Format, bool) {
+	if dot := strings.LastIndex(id, "."); dot >= 0 {
+		if format, ok := formatSuffixes[strings.ToLower(id[dot:])]; ok {
+			return id[:dot], format, true
+		}
+	}
+	return id, FormatRSS, false
+}
+
+// AcceptedFormat picks the format an Accept header prefers. Podcast apps often
+// send */* or nothing, so anything that doesn't name a feed type gets RSS.
+func AcceptedFormat(accept string) Format {
+	best, bestQ := FormatRSS, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := formatMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		// Earlier types win ties, as clients list them by preference
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// encode renders the channel in a format
+func (c *rssChannel) encode(format Format) (string, error) {
+	switch format {
+	case FormatAtom:
+		return c.encodeAtom()
+	case FormatJSON:
+		return c.encodeJSON()
+	default:
+		return c.encodeRSS()
+	}
+}
+
+// atomFeed is an Atom 1.0 feed. Audio is attached to entries as enclosure links.
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	NS        string      `xml:"xmlns,attr"`
+	FHNS      string      `xml:"xmlns:fh,attr,omitempty"`
+	Lang      string      `xml:"xml:lang,attr,omitempty"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	FHArchive *struct{}   `xml:"fh:archive"`
+	Author    *atomPerson `xml:"author"`
+	Generator string      `xml:"generator"`
+	Logo      string      `xml:"logo,omitempty"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Author    *atomPerson `xml:"author"`
+	Links     []atomLink  `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   *atomText   `xml:"content"`
+}
+
+// atomText is a text construct of Atom, here always HTML
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (c *rssChannel) encodeAtom() (string, error) {
+	doc := atomFeed{
+		NS:        "http://www.w3.org/2005/Atom",
+		Lang:      c.Language,
+		ID:        "urn:uuid:" + c.PodcastGUID,
+		Title:     c.Title,
+		Subtitle:  c.Description,
+		Updated:   formatAtomDate(c.newest),
+		Generator: generator,
+		Links:     append(c.links(FormatAtom), atomLink{Href: c.Link, Rel: "alternate"}),
+	}
+	if c.page.Archive > 0 {
+		doc.FHNS = historyNamespace
+		doc.FHArchive = &struct{}{}
+	}
+	if c.ITunesAuthor != "" {
+		doc.Author = &atomPerson{Name: c.ITunesAuthor}
+	}
+	if c.Image != nil {
+		doc.Logo = c.Image.URL
+	}
+
+	for _, item := range c.Items {
+		entry := atomEntry{
+			ID:      item.GUID.Value,
+			Title:   item.Title,
+			Updated: doc.Updated,
+			Summary: item.Description,
+			Links: []atomLink{
+				{Href: item.Enclosure.URL, Rel: "enclosure", Type: item.Enclosure.Type, Length: item.Enclosure.Length},
+			},
+		}
+		if item.published != nil {
+			entry.Updated = formatAtomDate(*item.published)
+			entry.Published = entry.Updated
+		}
+		if item.ContentEncoded != nil {
+			entry.Content = &atomText{Type: "html", Value: item.ContentEncoded.Value}
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.Link, Rel: "alternate"})
+		}
+		if item.ITunesAuthor != "" {
+			entry.Author = &atomPerson{Name: item.ITunesAuthor}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return xml.Header + string(out) + "\n", nil
+}
+
+// formatAtomDate renders an RFC 3339 date. Atom requires one even for an empty
+// feed, which gets the zero Unix time so output stays reproducible.
+func formatAtomDate(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// jsonFeed is a JSON Feed 1.1 document. Audio is attached to items as attachments.
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	ContentHTML   string               `json:"content_html,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string `json:"url"`
+	MimeType          string `json:"mime_type"`
+	SizeInBytes       int64  `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+func (c *rssChannel) encodeJSON() (string, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       c.Title,
+		HomePageURL: c.Link,
+		FeedURL:     c.pageURL(FormatJSON, c.page.Archive),
+		NextURL:     c.olderPageURL(FormatJSON),
+		Description: c.Description,
+		Language:    c.Language,
+		Items:       []jsonFeedItem{},
+	}
+	if c.Image != nil {
+		doc.Icon = c.Image.URL
+	}
+	if c.ITunesAuthor != "" {
+		doc.Authors = []jsonFeedAuthor{{Name: c.ITunesAuthor}}
+	}
+
+	for _, item := range c.Items {
+		jsonItem := jsonFeedItem{
+			ID:          item.GUID.Value,
+			URL:         item.Link,
+			Title:       item.Title,
+			ContentText: item.Description,
+			Attachments: []jsonFeedAttachment{{
+				URL:               item.Enclosure.URL,
+				MimeType:          item.Enclosure.Type,
+				SizeInBytes:       item.Enclosure.Length,
+				DurationInSeconds: item.durationSeconds,
+			}},
+		}
+		if item.ContentEncoded != nil {
+			jsonItem.ContentHTML = item.ContentEncoded.Value
+		}
+		if item.published != nil {
+			jsonItem.DatePublished = item.published.UTC().Format(time.RFC3339)
+		}
+		if item.ITunesAuthor != "" {
+			jsonItem.Authors = []jsonFeedAuthor{{Name: item.ITunesAuthor}}
+		}
+		doc.Items = append(doc.Items, jsonItem)
+	}
+
+	// Feeds aren't embedded in web pages, so there's no reason to escape HTML characters
+	var out strings.Builder
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return out.String(), nil
+}
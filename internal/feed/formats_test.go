@@ -0,0 +1,33 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitFormat(t *testing.T) {
+	id, format, ok := SplitFormat("0b5e4c2a.atom")
+	assert.Equal(t, "0b5e4c2a", id)
+	assert.Equal(t, FormatAtom, format)
+	assert.True(t, ok)
+
+	id, format, ok = SplitFormat("0b5e4c2a.JSON")
+	assert.Equal(t, "0b5e4c2a", id)
+	assert.Equal(t, FormatJSON, format)
+	assert.True(t, ok)
+
+	id, format, ok = SplitFormat("0b5e4c2a")
+	assert.Equal(t, "0b5e4c2a", id)
+	assert.Equal(t, FormatRSS, format)
+	assert.False(t, ok)
+}
+
+func TestAcceptedFormat(t *testing.T) {
+	assert.Equal(t, FormatRSS, AcceptedFormat(""))
+	assert.Equal(t, FormatRSS, AcceptedFormat("*/*"))
+	assert.Equal(t, FormatAtom, AcceptedFormat("application/atom+xml"))
+	assert.Equal(t, FormatJSON, AcceptedFormat("application/feed+json, application/json;q=0.9, */*;q=0.1"))
+	assert.Equal(t, FormatAtom, AcceptedFormat("application/rss+xml;q=0.5, application/atom+xml"))
+	assert.Equal(t, FormatRSS, AcceptedFormat("application/rss+xml, application/atom+xml"))
+}
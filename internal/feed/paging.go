@@ -0,0 +1,104 @@
+package feed
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// historyNamespace marks archive pages as RFC 5005 describes
+const historyNamespace = "http://purl.org/syndication/history/1.0"
+
+// Page places one page of a feed in its RFC 5005 archive. The current feed
+// holds the newest episodes; archive pages split the whole history, oldest
+// first, into full pages that don't change as new episodes arrive.
+type Page struct {
+	// Archive is the archive page number, or 0 for the current feed
+	Archive int
+	// Archives is the number of archive pages
+	Archives int
+}
+
+// NewPage pages a feed of total episodes, size per page. archive selects an
+// archive page, or the current feed when 0, and must be one that exists.
+func NewPage(total, size, archive int) (Page, error) {
+	page := Page{Archive: archive}
+	// Episodes past the last full archive page are all in the current feed
+	if total > size {
+		page.Archives = total / size
+	}
+	if archive < 0 || archive > page.Archives {
+		return Page{}, fmt.Errorf("feed has no archive page %d", archive)
+	}
+	return page, nil
+}
+
+// Window returns the range of the page within the oldest-first history of a
+// feed of total episodes: the number of older episodes to skip, and how many to take.
+func (p Page) Window(total, size int) (skip, limit int) {
+	if p.Archive == 0 {
+		return max(total-size, 0), size
+	}
+	return (p.Archive - 1) * size, size
+}
+
+// setPage places the channel in its archive
+func (c *rssChannel) setPage(page Page) {
+	c.page = page
+}
+
+// pageURL is the URL of a page of the feed in a format
+func (c *rssChannel) pageURL(format Format, archive int) string {
+	url := c.feedURL + format.suffix()
+	if archive > 0 {
+		url += "?page=" + strconv.Itoa(archive)
+	}
+	return url
+}
+
+// links returns the self link and the RFC 5005 links between pages. Paged
+// feed clients follow next to older pages, archive-aware ones prev-archive;
+// both lead to the same page.
+func (c *rssChannel) links(format Format) []atomLink {
+	links := []atomLink{{Href: c.pageURL(format, c.page.Archive), Rel: "self", Type: format.ContentType()}}
+	if c.page.Archives == 0 {
+		return links
+	}
+
+	older := c.page.Archive - 1
+	if c.page.Archive == 0 {
+		older = c.page.Archives
+	} else {
+		links = append(links, atomLink{Href: c.pageURL(format, 0), Rel: "current", Type: format.ContentType()})
+	}
+	if older > 0 {
+		href := c.pageURL(format, older)
+		links = append(links,
+			atomLink{Href: href, Rel: "next", Type: format.ContentType()},
+			atomLink{Href: href, Rel: "prev-archive", Type: format.ContentType()},
+		)
+	}
+
+	if c.page.Archive > 0 {
+		// The newest archive page is followed by the current feed
+		newer := 0
+		if c.page.Archive < c.page.Archives {
+			newer = c.page.Archive + 1
+		}
+		href := c.pageURL(format, newer)
+		links = append(links, atomLink{Href: href, Rel: "previous", Type: format.ContentType()})
+		if newer > 0 {
+			links = append(links, atomLink{Href: href, Rel: "next-archive", Type: format.ContentType()})
+		}
+	}
+	return links
+}
+
+// olderPageURL is the page after this one for clients that only follow next links
+func (c *rssChannel) olderPageURL(format Format) string {
+	for _, link := range c.links(format) {
+		if link.Rel == "next" {
+			return link.Href
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"yt-podcaster/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPage(t *testing.T) {
+	page, err := NewPage(100, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, Page{}, page)
+
+	// 250 episodes make two full archive pages; the last 50 only live in the current feed
+	page, err = NewPage(250, 100, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, Page{Archives: 2}, page)
+	skip, limit := page.Window(250, 100)
+	assert.Equal(t, []int{150, 100}, []int{skip, limit})
+
+	page, err = NewPage(250, 100, 2)
+	assert.NoError(t, err)
+	skip, limit = page.Window(250, 100)
+	assert.Equal(t, []int{100, 100}, []int{skip, limit})
+
+	_, err = NewPage(250, 100, 3)
+	assert.Error(t, err)
+	_, err = NewPage(50, 100, 1)
+	assert.Error(t, err)
+}
+
+func TestGenerateSubscriptionRSSArchivePage(t *testing.T) {
+	setFeedEnv(t)
+
+	subscription := &models.Subscription{
+		ID:                  1,
+		Provider:            "youtube",
+		YoutubeChannelID:    "UCHnyfMqiRRG1u-2MsSQLbXA",
+		YoutubeChannelTitle: "Veritasium",
+		SourceType:          "channel",
+		RSSUUID:             "0b5e4c2a-6f1d-4c8e-9a37-2d4f8b1e6c90",
+	}
+	episodes := []models.Episode{
+		{
+			Provider:       "youtube",
+			YoutubeVideoID: "cUzklzVXJwo",
+			Title:          strPtr("The Longest-Standing Mystery in Physics"),
+			PublishedAt:    timePtr("2023-05-12T14:30:00Z"),
+			AudioUUID:      "c2b0d8e4-95a7-4d8a-a1f3-7e2c5b9d4f60",
+			AudioSizeBytes: int64Ptr(22806528),
+		},
+	}
+
+	rss, err := GenerateSubscriptionRSS(subscription, nil, episodes, Page{Archive: 2, Archives: 3}, FormatRSS, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID+"?page=2", nil))
+	assert.NoError(t, err)
+	assertGolden(t, "channel_archive.xml", rss)
+
+	// The current feed points at the newest archive page
+	jsonFeed, err := GenerateSubscriptionRSS(subscription, nil, episodes, Page{Archives: 3}, FormatJSON, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID+".json", nil))
+	assert.NoError(t, err)
+	assert.Contains(t, jsonFeed, `"next_url": "https://podcaster.example.com/rss/0b5e4c2a-6f1d-4c8e-9a37-2d4f8b1e6c90.json?page=3"`)
+}
@@ -0,0 +1,223 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const generator = "YT-Podcaster"
+
+// podcastNamespace is the Podcasting 2.0 namespace podcast:guid values are derived in
+var podcastNamespace = uuid.MustParse("ead4c236-bf58-58c6-a2c6-a6b28d128cb6")
+
+// rssDocument is an RSS 2.0 feed with the iTunes and Podcasting 2.0 extensions.
+// Prefixed element names are written verbatim, which is how encoding/xml emits
+// namespaced elements that validators accept.
+type rssDocument struct {
+	XMLName   xml.Name    `xml:"rss"`
+	Version   string      `xml:"version,attr"`
+	ITunesNS  string      `xml:"xmlns:itunes,attr"`
+	PodcastNS string      `xml:"xmlns:podcast,attr"`
+	AtomNS    string      `xml:"xmlns:atom,attr"`
+	ContentNS string      `xml:"xmlns:content,attr"`
+	FHNS      string      `xml:"xmlns:fh,attr,omitempty"`
+	Channel   *rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	AtomLinks      []atomLink      `xml:"atom:link"`
+	FHArchive      *struct{}       `xml:"fh:archive"`
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	Language       string          `xml:"language,omitempty"`
+	Generator      string          `xml:"generator"`
+	LastBuildDate  string          `xml:"lastBuildDate,omitempty"`
+	Image          *rssImage       `xml:"image"`
+	ITunesAuthor   string          `xml:"itunes:author,omitempty"`
+	ITunesImage    *itunesImage    `xml:"itunes:image"`
+	ITunesCategory *itunesCategory `xml:"itunes:category"`
+	ITunesExplicit string          `xml:"itunes:explicit"`
+	ITunesOwner    *itunesOwner    `xml:"itunes:owner"`
+	ITunesType     string          `xml:"itunes:type"`
+	// ITunesNewFeedURL points podcast apps at the URL a feed has moved to
+	ITunesNewFeedURL string        `xml:"itunes:new-feed-url,omitempty"`
+	PodcastGUID      string        `xml:"podcast:guid"`
+	PodcastLocked    podcastLocked `xml:"podcast:locked"`
+	Items            []rssItem     `xml:"item"`
+	// newest publish date, which becomes lastBuildDate so output is reproducible
+	newest time.Time
+	// feedURL is the URL of the current RSS feed, which pages and formats derive from
+	feedURL string
+	page    Page
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type itunesCategory struct {
+	Text        string          `xml:"text,attr"`
+	Subcategory *itunesCategory `xml:"itunes:category"`
+}
+
+type itunesOwner struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email"`
+}
+
+type podcastLocked struct {
+	Owner string `xml:"owner,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title             string          `xml:"title"`
+	Link              string          `xml:"link,omitempty"`
+	Description       string          `xml:"description"`
+	ContentEncoded    *contentEncoded `xml:"content:encoded"`
+	GUID              rssGUID         `xml:"guid"`
+	PubDate           string          `xml:"pubDate,omitempty"`
+	Enclosure         rssEnclosure    `xml:"enclosure"`
+	ITunesAuthor      string          `xml:"itunes:author,omitempty"`
+	ITunesDuration    string          `xml:"itunes:duration,omitempty"`
+	ITunesSeason      string          `xml:"itunes:season,omitempty"`
+	ITunesEpisode     string          `xml:"itunes:episode,omitempty"`
+	ITunesEpisodeType string          `xml:"itunes:episodeType"`
+	ITunesExplicit    string          `xml:"itunes:explicit"`
+	ITunesOrder       string          `xml:"itunes:order,omitempty"`
+	// kept for the Atom and JSON Feed renderings
+	published       *time.Time
+	durationSeconds int
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func getFeedCategory() string {
+	if category := os.Getenv("FEED_CATEGORY"); category != "" {
+		return category
+	}
+	return "Education"
+}
+
+func getFeedExplicit() bool {
+	explicit, _ := strconv.ParseBool(os.Getenv("FEED_EXPLICIT"))
+	return explicit
+}
+
+// newRSSChannel fills in the channel elements every feed shares
+func newRSSChannel(title, feedURL, link, description string) *rssChannel {
+	channel := &rssChannel{
+		Title:          title,
+		Link:           link,
+		Description:    description,
+		Generator:      generator,
+		ITunesCategory: parseCategory(getFeedCategory()),
+		ITunesExplicit: strconv.FormatBool(getFeedExplicit()),
+		ITunesType:     "episodic",
+		PodcastGUID:    podcastGUID(feedURL),
+		// These feeds mirror someone else's content, so no host should import them
+		PodcastLocked: podcastLocked{Value: "yes"},
+		feedURL:       feedURL,
+	}
+
+	if email := os.Getenv("FEED_OWNER_EMAIL"); email != "" {
+		channel.ITunesOwner = &itunesOwner{Name: os.Getenv("FEED_OWNER_NAME"), Email: email}
+		channel.PodcastLocked.Owner = email
+	}
+	channel.setImage(os.Getenv("FEED_IMAGE_URL"))
+	return channel
+}
+
+// setImage sets the artwork; an empty url keeps the current one
+func (c *rssChannel) setImage(url string) {
+	if url == "" {
+		return
+	}
+	c.Image = &rssImage{URL: url, Title: c.Title, Link: c.Link}
+	c.ITunesImage = &itunesImage{Href: url}
+}
+
+func (c *rssChannel) addItem(item rssItem, published *time.Time) {
+	item.published = published
+	c.Items = append(c.Items, item)
+	if published != nil && published.After(c.newest) {
+		c.newest = *published
+		c.LastBuildDate = formatDate(published)
+	}
+}
+
+func (c *rssChannel) encodeRSS() (string, error) {
+	doc := rssDocument{
+		Version:   "2.0",
+		ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		PodcastNS: "https://podcastindex.org/namespace/1.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel:   c,
+	}
+	c.AtomLinks = c.links(FormatRSS)
+	if c.page.Archive > 0 {
+		doc.FHNS = historyNamespace
+		c.FHArchive = &struct{}{}
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return xml.Header + string(out) + "\n", nil
+}
+
+// parseCategory turns "Education > Courses" into a category with a subcategory
+func parseCategory(category string) *itunesCategory {
+	parts := strings.SplitN(category, ">", 2)
+	parsed := &itunesCategory{Text: strings.TrimSpace(parts[0])}
+	if len(parts) == 2 {
+		parsed.Subcategory = &itunesCategory{Text: strings.TrimSpace(parts[1])}
+	}
+	return parsed
+}
+
+// podcastGUID derives the podcast:guid from the feed URL as the namespace specifies:
+// a UUIDv5 of the URL without scheme and trailing slashes.
+func podcastGUID(feedURL string) string {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(feedURL, "https://"), "http://")
+	return uuid.NewSHA1(podcastNamespace, []byte(strings.TrimRight(trimmed, "/"))).String()
+}
+
+func formatDate(t *time.Time) string {
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+// formatSeconds renders an itunes:duration as HH:MM:SS
+func formatSeconds(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
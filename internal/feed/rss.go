@@ -3,12 +3,16 @@ package feed
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
-	"time"
+	"strconv"
+	"strings"
 
+	"yt-podcaster/internal/audiourl"
+	"yt-podcaster/internal/feedauth"
 	"yt-podcaster/internal/models"
-
-	"github.com/eduncan911/podcast"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/internal/transcode"
 )
 
 func getBaseURL(r *http.Request) string {
@@ -27,52 +31,284 @@ func getBaseURL(r *http.Request) string {
 	return fmt.Sprintf("%s://%s", scheme, r.Host)
 }
 
-func GenerateRSS(user *models.User, episodes []models.Episode, r *http.Request) (string, error) {
+// GenerateRSS renders a user's listen later feed of individually queued videos.
+func GenerateRSS(user *models.User, episodes []models.Episode, format Format, r *http.Request) (string, error) {
 	baseURL := getBaseURL(r)
+	feedURL := fmt.Sprintf("%s/rss/%s", baseURL, user.RSSUUID)
 
-	p := podcast.New(
-		fmt.Sprintf("%s's Podcast", user.TelegramUsername),
-		fmt.Sprintf("%s/rss/%s", baseURL, user.RSSUUID),
-		"A podcast generated from YouTube channels.",
-		&time.Time{}, &time.Time{},
+	channel := newRSSChannel(
+		fmt.Sprintf("%s's Listen Later", user.TelegramUsername),
+		feedURL, feedURL,
+		"Individual YouTube videos saved to listen to later.",
 	)
+	channel.ITunesAuthor = user.TelegramUsername
 
+	links := newAudioLinks(r, baseURL, user.RSSUUID)
 	for _, episode := range episodes {
-		item := podcast.Item{
-			Title:       *episode.Title,
-			Description: *episode.Description,
-			PubDate:     episode.PublishedAt,
+		channel.addItem(newRSSItem(links, episode), episode.PublishedAt)
+	}
+
+	return channel.encode(format)
+}
+
+// GenerateCombinedRSS renders a user's combined feed of all their subscriptions.
+func GenerateCombinedRSS(user *models.User, episodes []models.SubscriptionEpisode, prefixTitles bool, format Format, r *http.Request) (string, error) {
+	baseURL := getBaseURL(r)
+	feedURL := fmt.Sprintf("%s/rss/%s", baseURL, user.CombinedRSSUUID)
+
+	channel := newRSSChannel(
+		fmt.Sprintf("%s's Subscriptions", user.TelegramUsername),
+		feedURL, feedURL,
+		"All of your subscriptions in one feed.",
+	)
+	channel.ITunesAuthor = user.TelegramUsername
+
+	channel.addMergedItems(newAudioLinks(r, baseURL, user.CombinedRSSUUID), episodes, prefixTitles)
+
+	return channel.encode(format)
+}
+
+// GenerateBundleRSS renders a bundle of some of a user's subscriptions like the combined feed.
+func GenerateBundleRSS(bundle *models.Bundle, episodes []models.SubscriptionEpisode, prefixTitles bool, format Format, r *http.Request) (string, error) {
+	baseURL := getBaseURL(r)
+	feedURL := fmt.Sprintf("%s/rss/%s", baseURL, bundle.RSSUUID)
+
+	channel := newRSSChannel(bundle.Title, feedURL, feedURL, fmt.Sprintf("%s, a bundle of your subscriptions.", bundle.Title))
+	channel.ITunesAuthor = bundle.Title
+	if bundle.ImageURL != nil {
+		channel.setImage(*bundle.ImageURL)
+	}
+	channel.addMergedItems(newAudioLinks(r, baseURL, bundle.RSSUUID), episodes, prefixTitles)
+
+	return channel.encode(format)
+}
+
+// GenerateSmartRSS renders a smart feed from the episodes its rule matches.
+func GenerateSmartRSS(smartFeed *models.SmartFeed, episodes []models.SubscriptionEpisode, prefixTitles bool, format Format, r *http.Request) (string, error) {
+	baseURL := getBaseURL(r)
+	feedURL := fmt.Sprintf("%s/rss/%s", baseURL, smartFeed.RSSUUID)
+
+	rule := strings.ReplaceAll(smartFeed.Rule.String(), "\n", ", ")
+	channel := newRSSChannel(smartFeed.Title, feedURL, feedURL, fmt.Sprintf("Episodes of your subscriptions matching %s.", rule))
+	channel.ITunesAuthor = smartFeed.Title
+	channel.addMergedItems(newAudioLinks(r, baseURL, smartFeed.RSSUUID), episodes, prefixTitles)
+
+	return channel.encode(format)
+}
+
+// addMergedItems adds episodes of several subscriptions, each attributed to its
+// channel as author and, with prefixTitles, in its title.
+func (c *rssChannel) addMergedItems(links audioLinks, episodes []models.SubscriptionEpisode, prefixTitles bool) {
+	seen := make(map[string]bool)
+	for _, episode := range episodes {
+		// A video can come from both a channel and one of its playlists
+		guid := episodeGUID(episode.Episode)
+		if seen[guid] {
+			continue
 		}
-		item.AddEnclosure(fmt.Sprintf("%s/audio/%s.m4a", baseURL, episode.AudioUUID), podcast.M4A, *episode.AudioSizeBytes)
-		if _, err := p.AddItem(item); err != nil {
-			return "", err
+		seen[guid] = true
+
+		item := newRSSItem(links, episode.Episode)
+		item.ITunesAuthor = episode.SubscriptionTitle
+		if prefixTitles {
+			item.Title = episode.SubscriptionTitle + ": " + item.Title
 		}
+		// Positions within one playlist mean nothing next to other subscriptions
+		item.ITunesOrder = ""
+		c.addItem(item, episode.PublishedAt)
 	}
+}
+
+// GenerateSubscriptionRSS renders the feed of a channel or playlist subscription.
+// channel holds the refreshed channel metadata and may be nil until the first refresh.
+// page places episodes, one page of the subscription's history, in the feed's archive.
+// The subscription's feed settings override the metadata taken from the source.
+func GenerateSubscriptionRSS(subscription *models.Subscription, channel *models.Channel, episodes []models.Episode, page Page, format Format, r *http.Request) (string, error) {
+	return generateSubscriptionRSS(subscription, channel, episodes, page, format, r, false)
+}
 
-	return p.String(), nil
+// GenerateMovedSubscriptionRSS renders a subscription's feed at an RSS UUID it
+// was rotated away from, with itunes:new-feed-url pointing at the current one.
+func GenerateMovedSubscriptionRSS(subscription *models.Subscription, channel *models.Channel, episodes []models.Episode, page Page, format Format, r *http.Request) (string, error) {
+	return generateSubscriptionRSS(subscription, channel, episodes, page, format, r, true)
 }
 
-func GenerateSubscriptionRSS(subscription *models.Subscription, episodes []models.Episode, r *http.Request) (string, error) {
+func generateSubscriptionRSS(subscription *models.Subscription, channel *models.Channel, episodes []models.Episode, page Page, format Format, r *http.Request, moved bool) (string, error) {
 	baseURL := getBaseURL(r)
 
-	p := podcast.New(
-		subscription.YoutubeChannelTitle,
-		fmt.Sprintf("%s/rss/%s", baseURL, subscription.RSSUUID),
-		fmt.Sprintf("Podcast feed for YouTube channel: %s", subscription.YoutubeChannelTitle),
-		&time.Time{}, &time.Time{},
-	)
+	description := fmt.Sprintf("Podcast feed for %s channel: %s", source.DisplayName(subscription.Provider), subscription.YoutubeChannelTitle)
+	if subscription.SourceType == "playlist" {
+		description = fmt.Sprintf("Podcast feed for %s playlist: %s", source.DisplayName(subscription.Provider), subscription.YoutubeChannelTitle)
+	} else if channel != nil && channel.Description != nil && *channel.Description != "" {
+		description = *channel.Description
+	}
 
+	feedURL := fmt.Sprintf("%s/rss/%s", baseURL, subscription.RSSUUID)
+	link := feedURL
+	if provider, err := source.Get(subscription.Provider); err == nil {
+		link = provider.ListURL(subscription)
+	}
+
+	settings := subscription.FeedSettings
+	title := subscription.YoutubeChannelTitle
+	if settings.Title != nil {
+		title = *settings.Title
+	}
+	if settings.Description != nil {
+		description = *settings.Description
+	}
+
+	rss := newRSSChannel(title, feedURL, link, description)
+	// Apps identify the podcast by its guid, which must survive URL rotations
+	rss.PodcastGUID = podcastGUID(fmt.Sprintf("%s/rss/%s", baseURL, subscription.FirstRSSUUID()))
+	if moved {
+		rss.ITunesNewFeedURL = feedURL
+	}
+	rss.ITunesAuthor = subscription.YoutubeChannelTitle
+	// Serial shows are listened to oldest first, playlists in playlist order
+	rss.ITunesType = subscription.FeedType()
+
+	// Playlists are presented with their owner's artwork
+	if channel != nil {
+		if channel.AvatarURL != nil {
+			rss.setImage(*channel.AvatarURL)
+		}
+		if channel.Language != nil {
+			rss.Language = *channel.Language
+		}
+		if channel.Title != "" {
+			rss.ITunesAuthor = channel.Title
+		}
+	}
+
+	// The user's own settings override whatever the source provides
+	if settings.ImageURL != nil {
+		rss.setImage(*settings.ImageURL)
+	}
+	if settings.Author != nil {
+		rss.ITunesAuthor = *settings.Author
+	}
+	if settings.Category != nil {
+		rss.ITunesCategory = parseCategory(*settings.Category)
+	}
+	if settings.Language != nil {
+		rss.Language = *settings.Language
+	}
+	if settings.Explicit != nil {
+		rss.ITunesExplicit = strconv.FormatBool(*settings.Explicit)
+	}
+
+	rewriter, err := settings.Rewrite.Compile()
+	if err != nil {
+		return "", fmt.Errorf("invalid rewrite rules: %w", err)
+	}
+
+	rss.setPage(page)
+	links := newAudioLinks(r, baseURL, subscription.RSSUUID)
 	for _, episode := range episodes {
-		item := podcast.Item{
-			Title:       *episode.Title,
-			Description: *episode.Description,
-			PubDate:     episode.PublishedAt,
+		item := newRSSItem(links, episode)
+		item.ITunesExplicit = rss.ITunesExplicit
+		rewritten := rewriter.Apply(item.Title)
+		item.Title = rewritten.Title
+		if rewritten.Season > 0 {
+			item.ITunesSeason = strconv.Itoa(rewritten.Season)
 		}
-		item.AddEnclosure(fmt.Sprintf("%s/audio/%s.m4a", baseURL, episode.AudioUUID), podcast.M4A, *episode.AudioSizeBytes)
-		if _, err := p.AddItem(item); err != nil {
-			return "", err
+		if rewritten.Episode > 0 {
+			item.ITunesEpisode = strconv.Itoa(rewritten.Episode)
 		}
+		rss.addItem(item, episode.PublishedAt)
+	}
+
+	return rss.encode(format)
+}
+
+// audioLinks builds the audio URLs of one feed, signed for its RSS UUID. When
+// the feed was fetched with its token, the URLs carry the token as well, since
+// apps that can't send Basic authentication can't for the audio either. Feeds
+// set to an audio variant select it in every URL.
+type audioLinks struct {
+	baseURL   string
+	feedToken string
+	authToken string
+	profile   string
+}
+
+func newAudioLinks(r *http.Request, baseURL string, feedToken string) audioLinks {
+	links := audioLinks{baseURL: baseURL, feedToken: feedToken, authToken: feedauth.Token(r.Context())}
+	if profile, ok := transcode.FeedProfile(r.Context()); ok {
+		links.profile = profile.Name
+	}
+	return links
+}
+
+func (l audioLinks) url(audioUUID string) string {
+	signed := audiourl.Sign(l.baseURL, audioUUID, l.feedToken)
+	if l.profile != "" {
+		signed += "&" + transcode.ProfileParam + "=" + l.profile
+	}
+	if l.authToken != "" {
+		signed += "&" + feedauth.TokenParam + "=" + url.QueryEscape(l.authToken)
 	}
+	return signed
+}
 
-	return p.String(), nil
+// newRSSItem renders an episode. Its GUID is the source video's ID, so it stays
+// stable however the audio URL changes.
+func newRSSItem(links audioLinks, episode models.Episode) rssItem {
+	item := rssItem{
+		Title:             deref(episode.Title),
+		Description:       deref(episode.Description),
+		GUID:              rssGUID{IsPermaLink: "false", Value: episodeGUID(episode)},
+		ITunesEpisodeType: "full",
+		ITunesExplicit:    strconv.FormatBool(getFeedExplicit()),
+		Enclosure: rssEnclosure{
+			URL:  links.url(episode.AudioUUID),
+			Type: "audio/x-m4a",
+		},
+	}
+	if notes := showNotesHTML(item.Description); notes != "" {
+		item.ContentEncoded = &contentEncoded{Value: notes}
+	}
+	if episode.AudioSizeBytes != nil {
+		item.Enclosure.Length = *episode.AudioSizeBytes
+	}
+	if episode.PublishedAt != nil {
+		item.PubDate = formatDate(episode.PublishedAt)
+	}
+	if episode.DurationSeconds != nil && *episode.DurationSeconds > 0 {
+		item.ITunesDuration = formatSeconds(*episode.DurationSeconds)
+		item.durationSeconds = *episode.DurationSeconds
+	}
+	// Let podcast apps keep serial shows in playlist order
+	if episode.PlaylistPosition != nil {
+		item.ITunesOrder = strconv.Itoa(*episode.PlaylistPosition)
+	}
+	if provider, err := source.Get(episodeProvider(episode)); err == nil {
+		item.Link = provider.VideoURL(episode.YoutubeVideoID)
+	}
+	return item
+}
+
+// episodeGUID follows YouTube's own yt:video:ID scheme, prefixed by provider elsewhere
+func episodeGUID(episode models.Episode) string {
+	provider := episodeProvider(episode)
+	if provider == source.ProviderYouTube {
+		return "yt:video:" + episode.YoutubeVideoID
+	}
+	return provider + ":video:" + episode.YoutubeVideoID
+}
+
+// episodeProvider defaults to YouTube like the provider column does
+func episodeProvider(episode models.Episode) string {
+	if episode.Provider == "" {
+		return source.ProviderYouTube
+	}
+	return episode.Provider
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
@@ -0,0 +1,386 @@
+package feed
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yt-podcaster/internal/feedauth"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/rewrite"
+	"yt-podcaster/internal/smartfeed"
+	"yt-podcaster/internal/transcode"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), got)
+}
+
+func setFeedEnv(t *testing.T) {
+	t.Setenv("BASE_URL", "https://podcaster.example.com")
+	t.Setenv("ALLOWED_PROVIDERS", "youtube,vimeo")
+	t.Setenv("FEED_CATEGORY", "")
+	t.Setenv("FEED_EXPLICIT", "")
+	t.Setenv("FEED_OWNER_NAME", "")
+	t.Setenv("FEED_OWNER_EMAIL", "")
+	t.Setenv("FEED_IMAGE_URL", "")
+	t.Setenv("AUDIO_URL_SIGNING_KEY", "test-signing-key")
+	t.Setenv("AUDIO_URL_TTL_HOURS", "")
+}
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+func int64Ptr(i int64) *int64 { return &i }
+
+func timePtr(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func TestGenerateSubscriptionRSSChannel(t *testing.T) {
+	setFeedEnv(t)
+	t.Setenv("FEED_OWNER_NAME", "Podcaster Admin")
+	t.Setenv("FEED_OWNER_EMAIL", "admin@podcaster.example.com")
+	t.Setenv("FEED_CATEGORY", "Science > Physics")
+
+	subscription := &models.Subscription{
+		ID:                  1,
+		Provider:            "youtube",
+		YoutubeChannelID:    "UCHnyfMqiRRG1u-2MsSQLbXA",
+		YoutubeChannelTitle: "Veritasium",
+		SourceType:          "channel",
+		RSSUUID:             "0b5e4c2a-6f1d-4c8e-9a37-2d4f8b1e6c90",
+	}
+	channel := &models.Channel{
+		Provider:         "youtube",
+		YoutubeChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA",
+		Title:            "Veritasium",
+		Description:      strPtr("An element of truth - videos about science & education."),
+		AvatarURL:        strPtr("https://yt3.googleusercontent.com/ytc/avatar=s0"),
+		Language:         strPtr("en"),
+	}
+	episodes := []models.Episode{
+		{
+			Provider:        "youtube",
+			YoutubeVideoID:  "Z8qEb5OvSBo",
+			Title:           strPtr("The Most Misunderstood Concept in Physics"),
+			Description:     strPtr("Entropy <explained>."),
+			PublishedAt:     timePtr("2023-07-01T15:00:00Z"),
+			AudioUUID:       "6a1c1b0e-3a52-4f44-8f0e-1d6f0f2b7a11",
+			AudioSizeBytes:  int64Ptr(26843545),
+			DurationSeconds: intPtr(1667),
+		},
+		{
+			Provider:       "youtube",
+			YoutubeVideoID: "cUzklzVXJwo",
+			Title:          strPtr("The Longest-Standing Mystery in Physics"),
+			PublishedAt:    timePtr("2023-05-12T14:30:00Z"),
+			AudioUUID:      "c2b0d8e4-95a7-4d8a-a1f3-7e2c5b9d4f60",
+			AudioSizeBytes: int64Ptr(22806528),
+		},
+	}
+
+	rss, err := GenerateSubscriptionRSS(subscription, channel, episodes, Page{}, FormatRSS, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "channel.xml", rss)
+
+	atom, err := GenerateSubscriptionRSS(subscription, channel, episodes, Page{}, FormatAtom, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID+".atom", nil))
+	assert.NoError(t, err)
+	assertGolden(t, "channel.atom", atom)
+
+	jsonFeed, err := GenerateSubscriptionRSS(subscription, channel, episodes, Page{}, FormatJSON, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID+".json", nil))
+	assert.NoError(t, err)
+	assertGolden(t, "channel.json", jsonFeed)
+}
+
+func TestGenerateSubscriptionRSSPlaylist(t *testing.T) {
+	setFeedEnv(t)
+	t.Setenv("FEED_IMAGE_URL", "https://podcaster.example.com/artwork.png")
+
+	subscription := &models.Subscription{
+		ID:                  2,
+		Provider:            "youtube",
+		YoutubeChannelID:    "UCHnyfMqiRRG1u-2MsSQLbXA",
+		YoutubeChannelTitle: "Physics & Engineering",
+		SourceType:          "playlist",
+		YoutubePlaylistID:   strPtr("PLkahZjV5wKe8w9GeFLwFHzqMRvFU4LiBY"),
+		RSSUUID:             "9d7f3a1b-2c4e-4f6a-8b0d-1e3f5a7c9b2d",
+	}
+	episodes := []models.Episode{
+		{
+			Provider:         "youtube",
+			YoutubeVideoID:   "Z8qEb5OvSBo",
+			Title:            strPtr("The Most Misunderstood Concept in Physics"),
+			Description:      strPtr("Entropy explained."),
+			PublishedAt:      timePtr("2023-07-01T15:00:00Z"),
+			AudioUUID:        "6a1c1b0e-3a52-4f44-8f0e-1d6f0f2b7a11",
+			AudioSizeBytes:   int64Ptr(26843545),
+			DurationSeconds:  intPtr(1667),
+			PlaylistPosition: intPtr(1),
+		},
+	}
+
+	rss, err := GenerateSubscriptionRSS(subscription, nil, episodes, Page{}, FormatRSS, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "playlist.xml", rss)
+}
+
+func TestGenerateSubscriptionRSSFeedSettings(t *testing.T) {
+	setFeedEnv(t)
+
+	explicit := true
+	subscription := &models.Subscription{
+		ID:                  1,
+		Provider:            "youtube",
+		YoutubeChannelID:    "UCHnyfMqiRRG1u-2MsSQLbXA",
+		YoutubeChannelTitle: "Veritasium",
+		SourceType:          "channel",
+		RSSUUID:             "0b5e4c2a-6f1d-4c8e-9a37-2d4f8b1e6c90",
+		FeedSettings: models.FeedSettings{
+			Title:       strPtr("Physics From the Start"),
+			Description: strPtr("Veritasium, oldest video first."),
+			ImageURL:    strPtr("https://podcaster.example.com/physics.png"),
+			Author:      strPtr("Derek Muller"),
+			Category:    strPtr("Education > Courses"),
+			Language:    strPtr("en-AU"),
+			Type:        strPtr(models.FeedTypeSerial),
+			Explicit:    &explicit,
+			Rewrite: rewrite.Rules{
+				Title:          []rewrite.Rule{{Pattern: `^Veritasium:\s*`}, {Pattern: `\|\s*Ep\. \d+$`}},
+				NumberEpisodes: true,
+			},
+		},
+	}
+	channel := &models.Channel{
+		Provider:         "youtube",
+		YoutubeChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA",
+		Title:            "Veritasium",
+		Description:      strPtr("An element of truth - videos about science & education."),
+		AvatarURL:        strPtr("https://yt3.googleusercontent.com/ytc/avatar=s0"),
+		Language:         strPtr("en"),
+	}
+	episodes := []models.Episode{
+		{
+			Provider:       "youtube",
+			YoutubeVideoID: "cUzklzVXJwo",
+			Title:          strPtr("Veritasium: The Longest-Standing Mystery in Physics | Ep. 12"),
+			Description:    strPtr("Sources at https://ve42.co/mystery.\n00:00 Intro"),
+			PublishedAt:    timePtr("2023-05-12T14:30:00Z"),
+			AudioUUID:      "c2b0d8e4-95a7-4d8a-a1f3-7e2c5b9d4f60",
+			AudioSizeBytes: int64Ptr(22806528),
+		},
+	}
+
+	rss, err := GenerateSubscriptionRSS(subscription, channel, episodes, Page{}, FormatRSS, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "channel_custom.xml", rss)
+}
+
+func TestGenerateMovedSubscriptionRSS(t *testing.T) {
+	setFeedEnv(t)
+
+	original := "0b5e4c2a-6f1d-4c8e-9a37-2d4f8b1e6c90"
+	subscription := &models.Subscription{
+		ID:                  1,
+		Provider:            "youtube",
+		YoutubeChannelID:    "UCHnyfMqiRRG1u-2MsSQLbXA",
+		YoutubeChannelTitle: "Veritasium",
+		SourceType:          "channel",
+		RSSUUID:             "5f3c9e1a-7b2d-4e8f-a6c0-9d1b3e5f7a2c",
+		OriginalRSSUUID:     &original,
+	}
+
+	rss, err := GenerateMovedSubscriptionRSS(subscription, nil, nil, Page{}, FormatRSS, httptest.NewRequest("GET", "/rss/"+original, nil))
+	assert.NoError(t, err)
+	assert.Contains(t, rss, "<itunes:new-feed-url>https://podcaster.example.com/rss/5f3c9e1a-7b2d-4e8f-a6c0-9d1b3e5f7a2c</itunes:new-feed-url>")
+	assert.Contains(t, rss, `<atom:link href="https://podcaster.example.com/rss/5f3c9e1a-7b2d-4e8f-a6c0-9d1b3e5f7a2c" rel="self"`)
+	// The guid is still the one of the first URL, as in channel.xml
+	assert.Contains(t, rss, "<podcast:guid>6db84fa8-debf-5607-8034-91203336a718</podcast:guid>")
+
+	current, err := GenerateSubscriptionRSS(subscription, nil, nil, Page{}, FormatRSS, httptest.NewRequest("GET", "/rss/"+subscription.RSSUUID, nil))
+	assert.NoError(t, err)
+	assert.NotContains(t, current, "new-feed-url")
+	assert.Contains(t, current, "<podcast:guid>6db84fa8-debf-5607-8034-91203336a718</podcast:guid>")
+}
+
+func TestGenerateRSSListenLater(t *testing.T) {
+	setFeedEnv(t)
+	t.Setenv("FEED_EXPLICIT", "true")
+
+	user := &models.User{ID: 1, TelegramUsername: "testuser", RSSUUID: "5e8a2f1c-7b3d-4e9a-b6c0-4d2f8e1a3c57"}
+	episodes := []models.Episode{
+		{
+			Provider:        "vimeo",
+			YoutubeVideoID:  "76979871",
+			Title:           strPtr("The New Vimeo Player"),
+			Description:     strPtr("A saved video."),
+			PublishedAt:     timePtr("2013-10-15T18:00:00Z"),
+			AudioUUID:       "e4f1a7c3-0b2d-4c6e-9f8a-3b5d7e9f1a2c",
+			AudioSizeBytes:  int64Ptr(1048576),
+			DurationSeconds: intPtr(62),
+		},
+	}
+
+	rss, err := GenerateRSS(user, episodes, FormatRSS, httptest.NewRequest("GET", "/rss/"+user.RSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "listen_later.xml", rss)
+}
+
+func TestGeneratePrivateRSSPassesTokenToAudio(t *testing.T) {
+	setFeedEnv(t)
+
+	user := &models.User{ID: 1, TelegramUsername: "testuser", RSSUUID: "5e8a2f1c-7b3d-4e9a-b6c0-4d2f8e1a3c57"}
+	episodes := []models.Episode{{YoutubeVideoID: "dQw4w9WgXcQ", Title: strPtr("Saved"), AudioUUID: "e4f1a7c3-0b2d-4c6e-9f8a-3b5d7e9f1a2c"}}
+
+	// The feed authenticated with its token, as FeedAuthMiddleware records it
+	req := httptest.NewRequest("GET", "/rss/"+user.RSSUUID+"?token=s3cr%2Bt", nil)
+	req = req.WithContext(feedauth.WithToken(req.Context(), "s3cr+t"))
+	rss, err := GenerateRSS(user, episodes, FormatRSS, req)
+	assert.NoError(t, err)
+	assert.Regexp(t, `<enclosure url="https://podcaster\.example\.com/audio/e4f1a7c3-0b2d-4c6e-9f8a-3b5d7e9f1a2c\.m4a\?sig=[\w-]+&amp;token=s3cr%2Bt"`, rss)
+}
+
+func TestGenerateRSSSelectsAudioProfile(t *testing.T) {
+	setFeedEnv(t)
+
+	user := &models.User{ID: 1, TelegramUsername: "testuser", RSSUUID: "5e8a2f1c-7b3d-4e9a-b6c0-4d2f8e1a3c57"}
+	episodes := []models.Episode{{YoutubeVideoID: "dQw4w9WgXcQ", Title: strPtr("Saved"), AudioUUID: "e4f1a7c3-0b2d-4c6e-9f8a-3b5d7e9f1a2c"}}
+
+	profile, _ := transcode.Lookup("voice48")
+	req := httptest.NewRequest("GET", "/rss/"+user.RSSUUID, nil)
+	req = req.WithContext(transcode.WithFeedProfile(req.Context(), profile))
+	rss, err := GenerateRSS(user, episodes, FormatRSS, req)
+	assert.NoError(t, err)
+	assert.Regexp(t, `<enclosure url="https://podcaster\.example\.com/audio/e4f1a7c3-0b2d-4c6e-9f8a-3b5d7e9f1a2c\.m4a\?sig=[\w-]+&amp;profile=voice48"`, rss)
+}
+
+func TestPodcastGUID(t *testing.T) {
+	// Example from the podcast namespace specification
+	assert.Equal(t, "917393e3-1b1e-5cef-ace4-edaa54e1f810", podcastGUID("https://mp3s.nashownotes.com/pc20rss.xml"))
+}
+
+func TestGenerateCombinedRSS(t *testing.T) {
+	setFeedEnv(t)
+
+	user := &models.User{ID: 1, TelegramUsername: "testuser", CombinedRSSUUID: "a3c5e7f9-1b2d-4f6a-8c0e-2d4f6a8c0e1b"}
+	episodes := []models.SubscriptionEpisode{
+		{
+			Episode: models.Episode{
+				Provider:        "youtube",
+				YoutubeVideoID:  "Z8qEb5OvSBo",
+				Title:           strPtr("The Most Misunderstood Concept in Physics"),
+				Description:     strPtr("Entropy explained."),
+				PublishedAt:     timePtr("2023-07-01T15:00:00Z"),
+				AudioUUID:       "6a1c1b0e-3a52-4f44-8f0e-1d6f0f2b7a11",
+				AudioSizeBytes:  int64Ptr(26843545),
+				DurationSeconds: intPtr(1667),
+				// Positions are dropped when playlists are merged with other subscriptions
+				PlaylistPosition: intPtr(3),
+			},
+			SubscriptionTitle: "Veritasium",
+		},
+		{
+			Episode: models.Episode{
+				Provider:        "youtube",
+				YoutubeVideoID:  "dQw4w9WgXcQ",
+				Title:           strPtr("Never Gonna Give You Up"),
+				Description:     strPtr("The official video."),
+				PublishedAt:     timePtr("2009-10-25T06:57:33Z"),
+				AudioUUID:       "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9",
+				AudioSizeBytes:  int64Ptr(3407872),
+				DurationSeconds: intPtr(212),
+			},
+			SubscriptionTitle: "Rick Astley",
+		},
+	}
+
+	rss, err := GenerateCombinedRSS(user, episodes, true, FormatRSS, httptest.NewRequest("GET", "/rss/"+user.CombinedRSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "combined.xml", rss)
+
+	rss, err = GenerateCombinedRSS(user, episodes, false, FormatRSS, httptest.NewRequest("GET", "/rss/"+user.CombinedRSSUUID+"?prefix=false", nil))
+	assert.NoError(t, err)
+	assert.Contains(t, rss, "<title>Never Gonna Give You Up</title>")
+	assert.Contains(t, rss, "<itunes:author>Rick Astley</itunes:author>")
+}
+
+func TestGenerateBundleRSS(t *testing.T) {
+	setFeedEnv(t)
+
+	bundle := &models.Bundle{
+		ID:       2,
+		UserID:   1,
+		Title:    "Science",
+		ImageURL: strPtr("https://example.com/science.jpg"),
+		RSSUUID:  "0b8f3d6e-5c2a-4e7b-9f1d-3a6c8e0b2d4f",
+	}
+	episodes := []models.SubscriptionEpisode{
+		{
+			Episode: models.Episode{
+				Provider:        "youtube",
+				YoutubeVideoID:  "Z8qEb5OvSBo",
+				Title:           strPtr("The Most Misunderstood Concept in Physics"),
+				Description:     strPtr("Entropy explained."),
+				PublishedAt:     timePtr("2023-07-01T15:00:00Z"),
+				AudioUUID:       "6a1c1b0e-3a52-4f44-8f0e-1d6f0f2b7a11",
+				AudioSizeBytes:  int64Ptr(26843545),
+				DurationSeconds: intPtr(1667),
+			},
+			SubscriptionTitle: "Veritasium",
+		},
+	}
+
+	rss, err := GenerateBundleRSS(bundle, episodes, true, FormatRSS, httptest.NewRequest("GET", "/rss/"+bundle.RSSUUID, nil))
+	assert.NoError(t, err)
+	assertGolden(t, "bundle.xml", rss)
+}
+
+func TestGenerateSmartRSS(t *testing.T) {
+	setFeedEnv(t)
+
+	rule, err := smartfeed.Parse("duration < 30; title ~ physics")
+	assert.NoError(t, err)
+	smartFeed := &models.SmartFeed{ID: 3, UserID: 1, Title: "Short Physics", Rule: rule, RSSUUID: "5e7a9c1b-3d5f-4a7c-9e1b-3d5f7a9c1b3d"}
+	episodes := []models.SubscriptionEpisode{
+		{
+			Episode: models.Episode{
+				Provider:        "youtube",
+				YoutubeVideoID:  "Z8qEb5OvSBo",
+				Title:           strPtr("The Most Misunderstood Concept in Physics"),
+				Description:     strPtr("Entropy explained."),
+				PublishedAt:     timePtr("2023-07-01T15:00:00Z"),
+				AudioUUID:       "6a1c1b0e-3a52-4f44-8f0e-1d6f0f2b7a11",
+				AudioSizeBytes:  int64Ptr(26843545),
+				DurationSeconds: intPtr(1667),
+			},
+			SubscriptionTitle: "Veritasium",
+		},
+	}
+
+	rss, err := GenerateSmartRSS(smartFeed, episodes, false, FormatRSS, httptest.NewRequest("GET", "/rss/"+smartFeed.RSSUUID, nil))
+	assert.NoError(t, err)
+	assert.Contains(t, rss, "<title>Short Physics</title>")
+	assert.Contains(t, rss, "<description>Episodes of your subscriptions matching duration &lt; 30, title ~ physics.</description>")
+	assert.Contains(t, rss, "<title>The Most Misunderstood Concept in Physics</title>")
+}
@@ -0,0 +1,40 @@
+package feed
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// linkPattern finds web addresses in plain text descriptions
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// contentEncoded holds the HTML show notes of an item, written as CDATA
+type contentEncoded struct {
+	Value string `xml:",cdata"`
+}
+
+// showNotesHTML turns a plain text description into HTML show notes with
+// clickable links and the original line breaks. It returns "" for an empty
+// description.
+func showNotesHTML(description string) string {
+	if strings.TrimSpace(description) == "" {
+		return ""
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, match := range linkPattern.FindAllStringIndex(description, -1) {
+		start, end := match[0], match[1]
+		// Sentence punctuation right after a link is rarely part of it
+		end = start + len(strings.TrimRight(description[start:end], ".,;:!?)]'"))
+		out.WriteString(html.EscapeString(description[last:start]))
+		link := html.EscapeString(description[start:end])
+		out.WriteString(`<a href="` + link + `">` + link + `</a>`)
+		last = end
+	}
+	out.WriteString(html.EscapeString(description[last:]))
+
+	lines := strings.Split(strings.ReplaceAll(out.String(), "\r\n", "\n"), "\n")
+	return "<p>" + strings.Join(lines, "<br>\n") + "</p>"
+}
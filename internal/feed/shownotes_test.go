@@ -0,0 +1,17 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowNotesHTML(t *testing.T) {
+	assert.Equal(t, "", showNotesHTML(" \n"))
+	assert.Equal(t,
+		"<p>Gear &amp; links (affiliate): <a href=\"https://example.com/kit?a=1&amp;b=2\">https://example.com/kit?a=1&amp;b=2</a>.<br>\n"+
+			"00:00 Intro<br>\n"+
+			"<a href=\"http://example.com\">http://example.com</a></p>",
+		showNotesHTML("Gear & links (affiliate): https://example.com/kit?a=1&b=2.\r\n00:00 Intro\nhttp://example.com"),
+	)
+}
@@ -0,0 +1,82 @@
+// Package feedauth checks the credentials of private feeds. Podcast apps
+// present them as HTTP Basic authentication, or, when they can't, as the
+// password in the token query parameter of the feed URL. Passwords are
+// generated rather than chosen, so a plain SHA-256 hash stores them safely.
+package feedauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"yt-podcaster/internal/models"
+)
+
+// TokenParam is the query parameter carrying a feed's password.
+const TokenParam = "token"
+
+// passwordBytes is the entropy of generated passwords
+const passwordBytes = 18
+
+// usernamePattern keeps usernames to what every app accepts; Basic
+// authentication can't carry a colon in them anyway
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ValidateUsername checks a username chosen for a feed.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("usernames have 1 to 64 letters, digits, dots, dashes or underscores")
+	}
+	return nil
+}
+
+// NewPassword generates a random password, safe to use in URLs.
+func NewPassword() (string, error) {
+	buf := make([]byte, passwordBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash returns the hash a password is stored as.
+func Hash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate checks a request against a feed's credentials. It returns the
+// token when the request authenticated with one, so responses can pass it on
+// to the feed's audio URLs.
+func Authenticate(r *http.Request, credentials models.FeedCredentials) (token string, ok bool) {
+	if username, password, found := r.BasicAuth(); found {
+		return "", equal(username, credentials.Username) && equal(Hash(password), credentials.PasswordHash)
+	}
+	if token := r.URL.Query().Get(TokenParam); token != "" && equal(Hash(token), credentials.PasswordHash) {
+		return token, true
+	}
+	return "", false
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+type tokenContextKey struct{}
+
+// WithToken returns a context remembering the token a request authenticated with.
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// Token returns the token a request authenticated with, or "".
+func Token(ctx context.Context) string {
+	token, _ := ctx.Value(tokenContextKey{}).(string)
+	return token
+}
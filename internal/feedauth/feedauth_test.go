@@ -0,0 +1,54 @@
+package feedauth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"yt-podcaster/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	password, err := NewPassword()
+	assert.NoError(t, err)
+	assert.Len(t, password, 24)
+	credentials := models.FeedCredentials{Username: "podcast", PasswordHash: Hash(password)}
+
+	req := httptest.NewRequest("GET", "/rss/feed", nil)
+	req.SetBasicAuth("podcast", password)
+	token, ok := Authenticate(req, credentials)
+	assert.True(t, ok)
+	assert.Empty(t, token)
+
+	req = httptest.NewRequest("GET", "/rss/feed?token="+password, nil)
+	token, ok = Authenticate(req, credentials)
+	assert.True(t, ok)
+	assert.Equal(t, password, token)
+
+	rejected := []struct {
+		name, username, password, url string
+	}{
+		{"no credentials", "", "", "/rss/feed"},
+		{"wrong password", "podcast", "guess", "/rss/feed"},
+		{"wrong username", "admin", password, "/rss/feed"},
+		{"wrong token", "", "", "/rss/feed?token=guess"},
+		// Wrong Basic credentials don't fall back to the token
+		{"wrong password with token", "podcast", "guess", "/rss/feed?token=" + password},
+	}
+	for _, tc := range rejected {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		if tc.username != "" {
+			req.SetBasicAuth(tc.username, tc.password)
+		}
+		_, ok := Authenticate(req, credentials)
+		assert.False(t, ok, tc.name)
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	assert.NoError(t, ValidateUsername("my.podcasts_2"))
+	assert.Error(t, ValidateUsername(""))
+	assert.Error(t, ValidateUsername("user:name"))
+	assert.Error(t, ValidateUsername("name with spaces"))
+}
@@ -0,0 +1,190 @@
+// Package feedcache keeps rendered feeds so podcast apps polling them don't
+// hit Postgres. Entries are keyed by feed UUID and stamped with a generation
+// counter of the feed's owner; bumping the counter invalidates all of the
+// user's feeds at once, whichever process bumps it.
+package feedcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Entry is a rendered feed together with its validators.
+type Entry struct {
+	Body         []byte
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	UserID       int64
+	Generation   int64
+}
+
+// Store holds entries and per-user generations.
+type Store interface {
+	// Get returns nil without error on a miss
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	Generation(ctx context.Context, userID int64) (int64, error)
+	Bump(ctx context.Context, userID int64) error
+}
+
+var (
+	store Store
+	ttl   time.Duration
+	// localValidators remembers validators while caching is disabled
+	localValidators Store = NewMemoryStore()
+)
+
+// validatorTTL is how long a feed's Last-Modified is remembered after it was last rendered
+const validatorTTL = 30 * 24 * time.Hour
+
+func getFeedCacheTTL() time.Duration {
+	ttl := time.Hour
+	if env := os.Getenv("FEED_CACHE_TTL_MINUTES"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			ttl = time.Duration(val) * time.Minute
+		}
+	}
+	return ttl
+}
+
+// Init configures the cache from FEED_CACHE: redis (default), memory or off.
+// Until Init is called caching is disabled.
+func Init() {
+	ttl = getFeedCacheTTL()
+	if ttl <= 0 {
+		store = nil
+		return
+	}
+
+	switch mode := os.Getenv("FEED_CACHE"); mode {
+	case "", "redis":
+		redisAddr := os.Getenv("REDIS_ADDR")
+		if redisAddr == "" {
+			redisAddr = "127.0.0.1:6379"
+		}
+		store = NewRedisStore(redisAddr)
+	case "memory":
+		// Only sees invalidations from its own process, so worker updates show after the TTL
+		store = NewMemoryStore()
+	case "off":
+		store = nil
+	default:
+		log.Printf("Unknown FEED_CACHE %q, feed caching disabled", mode)
+		store = nil
+	}
+}
+
+// Use replaces the store, which tests use to enable caching; nil disables it.
+func Use(s Store, entryTTL time.Duration) {
+	store = s
+	ttl = entryTTL
+}
+
+// Enabled reports whether feeds are cached, so callers can skip looking up feed owners.
+func Enabled() bool {
+	return store != nil
+}
+
+// Get returns a cached feed that is still current, or nil. Cache errors are
+// logged and count as misses.
+func Get(ctx context.Context, key string) *Entry {
+	if store == nil {
+		return nil
+	}
+	entry, err := store.Get(ctx, key)
+	if err != nil {
+		log.Printf("Error reading feed cache for %s: %v", key, err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	generation, err := store.Generation(ctx, entry.UserID)
+	if err != nil {
+		log.Printf("Error reading feed cache generation for user %d: %v", entry.UserID, err)
+		return nil
+	}
+	if generation != entry.Generation {
+		return nil
+	}
+	return entry
+}
+
+// Uncached is a generation Put never stores entries under, and Get never
+// serves them for.
+const Uncached int64 = -1
+
+// Generation returns the user's current generation. Read it before loading what
+// a feed is rendered from, so a change made during rendering isn't lost.
+func Generation(ctx context.Context, userID int64) int64 {
+	if store == nil {
+		return 0
+	}
+	generation, err := store.Generation(ctx, userID)
+	if err != nil {
+		log.Printf("Error reading feed cache generation for user %d: %v", userID, err)
+		// The entry won't be served
+		return Uncached
+	}
+	return generation
+}
+
+// Put caches a rendered feed and returns it as an entry with validators, which
+// is also what's served when caching is disabled.
+func Put(ctx context.Context, key string, userID int64, generation int64, contentType string, body []byte) *Entry {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	entry := &Entry{
+		Body:         body,
+		ContentType:  contentType,
+		ETag:         etag,
+		LastModified: lastModified(ctx, key, etag),
+		UserID:       userID,
+		Generation:   generation,
+	}
+	if store == nil || generation == Uncached {
+		return entry
+	}
+	if err := store.Set(ctx, key, entry, ttl); err != nil {
+		log.Printf("Error writing feed cache for %s: %v", key, err)
+	}
+	return entry
+}
+
+// lastModified returns the time a feed's body last changed. It outlives the
+// cached entries, so clients sending only If-Modified-Since still get 304s
+// when an expired or invalidated feed renders the same again.
+func lastModified(ctx context.Context, key string, etag string) time.Time {
+	validators := store
+	if validators == nil {
+		validators = localValidators
+	}
+
+	modified := time.Now().UTC().Truncate(time.Second)
+	previous, err := validators.Get(ctx, "validators:"+key)
+	if err != nil {
+		log.Printf("Error reading feed validators for %s: %v", key, err)
+	} else if previous != nil && previous.ETag == etag {
+		modified = previous.LastModified
+	}
+	if err := validators.Set(ctx, "validators:"+key, &Entry{ETag: etag, LastModified: modified}, validatorTTL); err != nil {
+		log.Printf("Error writing feed validators for %s: %v", key, err)
+	}
+	return modified
+}
+
+// InvalidateUser drops all cached feeds of a user.
+func InvalidateUser(ctx context.Context, userID int64) {
+	if store == nil {
+		return
+	}
+	if err := store.Bump(ctx, userID); err != nil {
+		log.Printf("Error invalidating feed cache for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,65 @@
+package feedcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidateUser(t *testing.T) {
+	Use(NewMemoryStore(), time.Hour)
+	defer Use(nil, 0)
+	ctx := context.Background()
+
+	generation := Generation(ctx, 1)
+	first := Put(ctx, "feed-a", 1, generation, "application/rss+xml", []byte("<rss/>"))
+	Put(ctx, "feed-b", 2, Generation(ctx, 2), "application/rss+xml", []byte("<rss></rss>"))
+
+	assert.Equal(t, first, Get(ctx, "feed-a"))
+	assert.NotEqual(t, first.ETag, Get(ctx, "feed-b").ETag)
+
+	InvalidateUser(ctx, 1)
+	assert.Nil(t, Get(ctx, "feed-a"))
+	assert.NotNil(t, Get(ctx, "feed-b"), "other users' feeds stay cached")
+}
+
+func TestPutWithStaleGeneration(t *testing.T) {
+	Use(NewMemoryStore(), time.Hour)
+	defer Use(nil, 0)
+	ctx := context.Background()
+
+	// An episode completes while the feed is being rendered
+	generation := Generation(ctx, 1)
+	InvalidateUser(ctx, 1)
+	Put(ctx, "feed-a", 1, generation, "application/rss+xml", []byte("<rss/>"))
+
+	assert.Nil(t, Get(ctx, "feed-a"))
+}
+
+func TestDisabled(t *testing.T) {
+	Use(nil, 0)
+	ctx := context.Background()
+
+	entry := Put(ctx, "feed-a", 1, Generation(ctx, 1), "application/rss+xml", []byte("<rss/>"))
+	assert.NotEmpty(t, entry.ETag)
+	assert.Nil(t, Get(ctx, "feed-a"))
+}
+
+func TestLastModifiedSurvivesRenders(t *testing.T) {
+	for _, s := range []Store{NewMemoryStore(), nil} {
+		Use(s, time.Hour)
+		ctx := context.Background()
+
+		first := Put(ctx, "feed-a", 1, Generation(ctx, 1), "application/rss+xml", []byte("<rss/>"))
+		InvalidateUser(ctx, 1)
+		time.Sleep(time.Second)
+
+		same := Put(ctx, "feed-a", 1, Generation(ctx, 1), "application/rss+xml", []byte("<rss/>"))
+		assert.Equal(t, first.LastModified, same.LastModified)
+		changed := Put(ctx, "feed-a", 1, Generation(ctx, 1), "application/rss+xml", []byte("<rss></rss>"))
+		assert.True(t, changed.LastModified.After(first.LastModified))
+	}
+	Use(nil, 0)
+}
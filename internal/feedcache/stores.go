@@ -0,0 +1,113 @@
+package feedcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares entries and generations between the server and the worker.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(addr string) *RedisStore {
+	return &RedisStore{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := s.client.Get(ctx, "feed:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cached feed: %w", err)
+	}
+	return &entry, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, "feed:"+key, data, ttl).Err()
+}
+
+func (s *RedisStore) Generation(ctx context.Context, userID int64) (int64, error) {
+	generation, err := s.client.Get(ctx, generationKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+func (s *RedisStore) Bump(ctx context.Context, userID int64) error {
+	return s.client.Incr(ctx, generationKey(userID)).Err()
+}
+
+func generationKey(userID int64) string {
+	return fmt.Sprintf("feed:generation:%d", userID)
+}
+
+// MemoryStore keeps entries in the process.
+type MemoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	generations map[int64]int64
+}
+
+type memoryEntry struct {
+	entry   *Entry
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), generations: make(map[int64]int64)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.entries[key]
+	if !ok || time.Now().After(cached.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	return cached.entry, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{entry: entry, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Generation(ctx context.Context, userID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generations[userID], nil
+}
+
+func (s *MemoryStore) Bump(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[userID]++
+	// Entries of the user are unreachable now; drop them rather than wait for expiry
+	for key, cached := range s.entries {
+		if cached.entry.UserID == userID {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package filter holds the rules that decide which listed uploads of a
+// subscription become episodes. The channel checker applies them, and the
+// subscription preview shows their outcome before subscribing.
+package filter
+
+import "time"
+
+// MaxNewChannelEpisodes caps how many videos the first check of a channel imports.
+const MaxNewChannelEpisodes = 50
+
+// MaxPlaylistEpisodesPerCheck caps how many entries one check of a playlist
+// imports. Playlists are listed in full, so the rest of a long one follows in
+// later checks instead of being downloaded all at once.
+const MaxPlaylistEpisodesPerCheck = 50
+
+// Rules are the inclusion rules of one subscription.
+type Rules struct {
+	// Playlist subscriptions are curated, so every entry is kept regardless of age
+	Playlist bool
+}
+
+// Cutoff returns the oldest upload date still included: one year before the
+// newest upload. newestUploadDate is in yt-dlp's YYYYMMDD format.
+func (r Rules) Cutoff(newestUploadDate string) time.Time {
+	newest, _ := time.Parse("20060102", newestUploadDate)
+	return newest.AddDate(-1, 0, 0)
+}
+
+// TooOld reports whether an upload falls before the cutoff. Uploads without a
+// known date are kept.
+func (r Rules) TooOld(uploadDate string, cutoff time.Time) bool {
+	if r.Playlist {
+		return false
+	}
+	date, err := time.Parse("20060102", uploadDate)
+	return err == nil && date.Before(cutoff)
+}
+
+// Decision explains whether an upload would become an episode. Included
+// uploads may carry a Reason too, when they become one only later.
+type Decision struct {
+	Included bool
+	Reason   string
+}
+
+// Preview applies the rules to the uploads of a channel that was never checked,
+// listed newest first as the checker sees them, or to a playlist's entries in
+// playlist order.
+func (r Rules) Preview(uploadDates []string) []Decision {
+	decisions := make([]Decision, len(uploadDates))
+	if len(uploadDates) == 0 {
+		return decisions
+	}
+
+	cutoff := r.Cutoff(uploadDates[0])
+	included := 0
+	for i, date := range uploadDates {
+		switch {
+		case r.Playlist && included >= MaxPlaylistEpisodesPerCheck:
+			decisions[i] = Decision{Included: true, Reason: "imported by a later hourly check"}
+			included++
+		case included >= MaxNewChannelEpisodes:
+			decisions[i] = Decision{Reason: "beyond the first 50 videos"}
+		case r.TooOld(date, cutoff):
+			decisions[i] = Decision{Reason: "more than a year older than the newest video"}
+		default:
+			decisions[i] = Decision{Included: true}
+			included++
+		}
+	}
+	return decisions
+}
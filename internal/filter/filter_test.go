@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	decisions := Rules{}.Preview([]string{"20240601", "20231001", "", "20230531"})
+	assert.Equal(t, []Decision{
+		{Included: true},
+		{Included: true},
+		{Included: true},
+		{Reason: "more than a year older than the newest video"},
+	}, decisions)
+
+	decisions = Rules{Playlist: true}.Preview([]string{"20240601", "20100101"})
+	assert.Equal(t, []Decision{{Included: true}, {Included: true}}, decisions)
+}
+
+func TestPreviewCapsNewChannels(t *testing.T) {
+	dates := make([]string, MaxNewChannelEpisodes+2)
+	for i := range dates {
+		dates[i] = "20240601"
+	}
+
+	decisions := Rules{}.Preview(dates)
+	assert.True(t, decisions[MaxNewChannelEpisodes-1].Included)
+	assert.False(t, decisions[MaxNewChannelEpisodes].Included)
+	assert.Equal(t, "beyond the first 50 videos", decisions[MaxNewChannelEpisodes+1].Reason)
+}
+
+func TestPreviewPagesThroughPlaylists(t *testing.T) {
+	dates := make([]string, MaxPlaylistEpisodesPerCheck+1)
+	decisions := Rules{Playlist: true}.Preview(dates)
+	assert.Equal(t, Decision{Included: true}, decisions[MaxPlaylistEpisodesPerCheck-1])
+	assert.Equal(t, Decision{Included: true, Reason: "imported by a later hourly check"}, decisions[MaxPlaylistEpisodesPerCheck])
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ways of handing audio bytes to the reverse proxy in front of the server
+const (
+	audioOffloadDirect = "direct"
+	// nginx serves the file from an internal location mapped to the audio directory
+	audioOffloadAccelRedirect = "x-accel-redirect"
+	// Apache, lighttpd and Caddy setups serve the file at an absolute path
+	audioOffloadSendfile = "x-sendfile"
+)
+
+func getAudioOffload() string {
+	switch mode := strings.ToLower(os.Getenv("AUDIO_OFFLOAD")); mode {
+	case "", audioOffloadDirect:
+		return audioOffloadDirect
+	case audioOffloadAccelRedirect, audioOffloadSendfile:
+		return mode
+	default:
+		log.Printf("Unknown AUDIO_OFFLOAD %q, serving audio directly", mode)
+		return audioOffloadDirect
+	}
+}
+
+// getAudioOffloadPrefix returns the internal nginx location the audio directory is served at
+func getAudioOffloadPrefix() string {
+	prefix := "/internal/audio"
+	if env := os.Getenv("AUDIO_OFFLOAD_PREFIX"); env != "" {
+		prefix = env
+	}
+	return prefix
+}
+
+// getAudioCacheMaxAge returns how long clients and caches may keep audio; 0 disables caching headers
+func getAudioCacheMaxAge() time.Duration {
+	maxAge := 365 * 24 * time.Hour
+	if env := os.Getenv("AUDIO_CACHE_MAX_AGE_DAYS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val >= 0 {
+			maxAge = time.Duration(val) * 24 * time.Hour
+		}
+	}
+	return maxAge
+}
+
+// setAudioCacheHeaders marks a response with audio that never changes under
+// its URL as cacheable for long, validated by a key of the audio UUID. Signed
+// URLs that expire are cached until their expiry at most, and private feeds'
+// audio, which FeedAuthMiddleware marked private, stays out of shared caches.
+func setAudioCacheHeaders(w http.ResponseWriter, r *http.Request, key string) {
+	maxAge := getAudioCacheMaxAge()
+	if maxAge <= 0 {
+		return
+	}
+	if exp, err := strconv.ParseInt(r.URL.Query().Get("exp"), 10, 64); err == nil {
+		maxAge = min(maxAge, time.Until(time.Unix(exp, 0)))
+		if maxAge <= 0 {
+			return
+		}
+	}
+
+	visibility := "public"
+	if strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+		visibility = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, immutable", visibility, int64(maxAge.Seconds())))
+	w.Header().Set("ETag", `"`+key+`"`)
+}
+
+// sendAudioFile writes a file under the audio directory, or with AUDIO_OFFLOAD
+// leaves that to the reverse proxy once the request was authorized. The proxy
+// keeps the headers set here and handles Range requests itself.
+func (h *Handlers) sendAudioFile(w http.ResponseWriter, r *http.Request, relPath string) {
+	mode := getAudioOffload()
+	// Every file under the audio directory is MP4 audio, which the proxy can't sniff from an empty body
+	if mode != audioOffloadDirect && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "audio/mp4")
+	}
+
+	switch mode {
+	case audioOffloadAccelRedirect:
+		w.Header().Set("X-Accel-Redirect", path.Join(getAudioOffloadPrefix(), filepath.ToSlash(relPath)))
+	case audioOffloadSendfile:
+		absPath, err := filepath.Abs(filepath.Join(h.audioStoragePath, relPath))
+		if err != nil {
+			log.Printf("Error resolving audio path %s: %v", relPath, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Sendfile", absPath)
+	default:
+		http.ServeFile(w, r, filepath.Join(h.audioStoragePath, relPath))
+	}
+}
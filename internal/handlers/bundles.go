@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxFeedTitleLength matches the title column of bundles and smart feeds
+const maxFeedTitleLength = 255
+
+// parseFeedTitle validates the title of a user-named feed
+func parseFeedTitle(value string) (string, error) {
+	title := strings.TrimSpace(value)
+	if title == "" {
+		return "", errors.New("Title is required")
+	}
+	if utf8.RuneCountInString(title) > maxFeedTitleLength {
+		return "", errors.New("Title is too long")
+	}
+	return title, nil
+}
+
+// parseImageURL validates optional artwork. It ends up in feeds, so only plain
+// web URLs are accepted; an empty value gives nil.
+func parseImageURL(value string) (*string, error) {
+	imageURL := strings.TrimSpace(value)
+	if imageURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("Artwork must be an http or https URL")
+	}
+	return &imageURL, nil
+}
+
+// bundleForm is a validated create or update request
+type bundleForm struct {
+	Title           string
+	ImageURL        *string
+	SubscriptionIDs []int64
+}
+
+// parseBundleForm reads title, image_url and repeated subscription_id fields
+func parseBundleForm(r *http.Request) (*bundleForm, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.New("Bad request")
+	}
+
+	title, err := parseFeedTitle(r.FormValue("title"))
+	if err != nil {
+		return nil, err
+	}
+	form := &bundleForm{Title: title}
+
+	if form.ImageURL, err = parseImageURL(r.FormValue("image_url")); err != nil {
+		return nil, err
+	}
+
+	for _, value := range r.Form["subscription_id"] {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid subscription ID")
+		}
+		form.SubscriptionIDs = append(form.SubscriptionIDs, id)
+	}
+	return form, nil
+}
+
+func (h *Handlers) GetBundles(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	bundles, err := db.GetBundlesByUserID(user.ID)
+	if err != nil {
+		log.Printf("Error getting bundles for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	subscriptions, err := db.GetSubscriptionsByUserID(user.ID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := getBaseURL()
+
+	templateData := struct {
+		Bundles       []models.Bundle
+		Subscriptions []models.Subscription
+		BaseURL       string
+	}{
+		Bundles:       bundles,
+		Subscriptions: subscriptions,
+		BaseURL:       baseURL,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "bundles.html", templateData)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) PostBundle(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	form, err := parseBundleForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.CreateBundle(user.ID, form.Title, form.ImageURL, form.SubscriptionIDs); err != nil {
+		log.Printf("Error creating bundle for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetBundles(w, r)
+}
+
+func (h *Handlers) PutBundle(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	bundleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+	form, err := parseBundleForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateBundle(user.ID, bundleID, form.Title, form.ImageURL, form.SubscriptionIDs)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Bundle not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating bundle %d: %v", bundleID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	h.GetBundles(w, r)
+}
+
+func (h *Handlers) DeleteBundle(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	bundleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid bundle ID", http.StatusBadRequest)
+		return
+	}
+
+	err = db.DeleteBundle(user.ID, bundleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Bundle not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting bundle %d: %v", bundleID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,51 +1,446 @@
 package handlers
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"yt-podcaster/internal/analytics"
+	"yt-podcaster/internal/audiourl"
 	"yt-podcaster/internal/db"
 	"yt-podcaster/internal/feed"
+	"yt-podcaster/internal/feedauth"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/transcode"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// serveFeed writes a rendered feed. ServeContent answers HEAD requests and
+// If-None-Match/If-Modified-Since with 304s from the entry's validators.
+func serveFeed(w http.ResponseWriter, r *http.Request, entry *feedcache.Entry) {
+	// Polls answered with a 304 count too; HEAD requests only check the feed is there
+	if r.Method == http.MethodGet {
+		rssUUID, _ := FeedUUID(r)
+		analytics.RecordFeed(r, rssUUID)
+	}
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Header().Set("ETag", entry.ETag)
+	http.ServeContent(w, r, "", entry.LastModified, bytes.NewReader(entry.Body))
+}
+
+// maxCombinedFeedLimit caps the limit parameter of combined feeds
+const maxCombinedFeedLimit = 500
+
+func getCombinedFeedLimit() int {
+	limit := 100
+	if env := os.Getenv("COMBINED_FEED_LIMIT"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val > 0 {
+			limit = val
+		}
+	}
+	return limit
+}
+
+func getFeedPageSize() int {
+	size := 100
+	if env := os.Getenv("FEED_PAGE_SIZE"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val > 0 {
+			size = val
+		}
+	}
+	return size
+}
+
+// feedQueryParams are the query parameters that change a feed's output
+var feedQueryParams = []string{"limit", "prefix", "page"}
+
+// feedRequest is a request for the feed at UUID, rendered in Format
+type feedRequest struct {
+	UUID     string
+	Format   feed.Format
+	CacheKey string
+}
+
+// newFeedRequest reads the feed UUID and format of a request. A suffix on the
+// path, as in /rss/{uuid}.atom, takes precedence over the Accept header.
+func newFeedRequest(r *http.Request) feedRequest {
+	uuid, format, ok := feed.SplitFormat(mux.Vars(r)["uuid"])
+	if !ok {
+		format = feed.AcceptedFormat(r.Header.Get("Accept"))
+	}
+
+	// The cache key covers everything that changes the output
+	key := uuid + "&format=" + string(format)
+	query := r.URL.Query()
+	for _, param := range feedQueryParams {
+		if value := query.Get(param); value != "" {
+			key += "&" + param + "=" + value
+		}
+	}
+	// Feeds fetched with their token pass it on to their audio URLs
+	if feedauth.Token(r.Context()) != "" {
+		key += "&" + feedauth.TokenParam
+	}
+	return feedRequest{UUID: uuid, Format: format, CacheKey: key}
+}
+
+// FeedUUID returns the RSS UUID of the feed an /rss request is for.
+func FeedUUID(r *http.Request) (string, error) {
+	rssUUID, _, _ := feed.SplitFormat(mux.Vars(r)["uuid"])
+	return rssUUID, nil
+}
+
+// AudioFeedUUID returns the RSS UUID of the feed an /audio request is signed
+// for, or "" when it isn't validly signed, which ServeAudioFile answers.
+func AudioFeedUUID(r *http.Request) (string, error) {
+	audioUUID, ok := requestAudioUUID(r)
+	if !ok {
+		return "", nil
+	}
+	access, err := db.GetAudioAccess(audioUUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	feedToken, _ := audiourl.Match(access.AudioUUID, access.FeedTokens, r.URL.Query())
+	return feedToken, nil
+}
+
+// requestAudioUUID reads the audio UUID from an /audio/{uuid}.m4a path
+func requestAudioUUID(r *http.Request) (string, bool) {
+	audioUUID, ok := strings.CutSuffix(mux.Vars(r)["filename"], ".m4a")
+	return audioUUID, ok && uuid.Validate(audioUUID) == nil
+}
+
+// feedRenderer serves the feed of one kind at fr.UUID. It returns false without
+// writing anything when no feed of its kind has that UUID.
+type feedRenderer func(w http.ResponseWriter, r *http.Request, fr feedRequest) bool
+
 func (h *Handlers) GetRSSFeed(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	uuid := vars["uuid"]
+	fr := newFeedRequest(r)
+	// The same URL serves several formats depending on Accept
+	w.Header().Set("Vary", "Accept")
+
+	if entry := feedcache.Get(r.Context(), fr.CacheKey); entry != nil {
+		serveFeed(w, r, entry)
+		return
+	}
+
+	// Feeds set to an audio variant link every episode to it
+	if uuid.Validate(fr.UUID) == nil {
+		name, err := db.GetFeedAudioProfile(fr.UUID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting audio profile of feed %s: %v", fr.UUID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if profile, ok := transcode.Lookup(name); ok {
+			r = r.WithContext(transcode.WithFeedProfile(r.Context(), profile))
+		}
+	}
+
+	// Every kind of feed is served at its own UUID under /rss
+	renderers := []feedRenderer{
+		h.renderSubscriptionFeed,
+		h.renderInboxFeed,
+		h.renderCombinedFeed,
+		h.renderBundleFeed,
+		h.renderSmartFeed,
+		h.renderMovedSubscriptionFeed,
+	}
+	for _, render := range renderers {
+		if render(w, r, fr) {
+			return
+		}
+	}
+	http.Error(w, "Subscription not found", http.StatusNotFound)
+}
+
+// mergedFeedOptions reads the limit and prefix parameters of feeds merging several subscriptions
+func mergedFeedOptions(r *http.Request) (limit int, prefixTitles bool) {
+	limit = getCombinedFeedLimit()
+	if val, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && val > 0 {
+		limit = min(val, maxCombinedFeedLimit)
+	}
+	prefixTitles = true
+	if val, err := strconv.ParseBool(r.URL.Query().Get("prefix")); err == nil {
+		prefixTitles = val
+	}
+	return limit, prefixTitles
+}
 
-	// Get subscription by RSS UUID instead of user
-	subscription, err := db.GetSubscriptionByRSSUUID(uuid)
+func (h *Handlers) renderSubscriptionFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	subscription, err := db.GetSubscriptionByRSSUUID(fr.UUID)
 	if err != nil {
-		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return false
+	}
+	h.serveSubscriptionFeed(w, r, fr, subscription, false)
+	return true
+}
+
+// renderMovedSubscriptionFeed serves a subscription's feed at an RSS UUID
+// rotated out less than its grace period ago, pointing apps at the new URL
+func (h *Handlers) renderMovedSubscriptionFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	subscription, err := db.GetSubscriptionByRetiredRSSUUID(fr.UUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting subscription by retired RSS UUID: %v", err)
+		}
+		return false
+	}
+	h.serveSubscriptionFeed(w, r, fr, subscription, true)
+	return true
+}
+
+// serveSubscriptionFeed renders the requested page of a subscription's feed.
+// Feeds at a retired UUID aren't cached, so they stop when the grace period ends.
+func (h *Handlers) serveSubscriptionFeed(w http.ResponseWriter, r *http.Request, fr feedRequest, subscription models.Subscription, moved bool) {
+	generation := feedcache.Uncached
+	if !moved {
+		generation = feedcache.Generation(r.Context(), subscription.UserID)
+	}
+
+	// Long histories are split into RFC 5005 archive pages behind the current feed
+	total, err := db.CountCompletedEpisodesBySubscriptionID(subscription.ID)
+	if err != nil {
+		log.Printf("Error counting episodes for subscription %d: %v", subscription.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	archive := 0
+	if value := r.URL.Query().Get("page"); value != "" {
+		if archive, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+	}
+	size := getFeedPageSize()
+	page, err := feed.NewPage(total, size, archive)
+	if err != nil {
+		http.Error(w, "Page not found", http.StatusNotFound)
 		return
 	}
+	skip, limit := page.Window(total, size)
 
-	// Get episodes for this specific subscription
-	episodes, err := db.GetCompletedEpisodesBySubscriptionID(subscription.ID)
+	// Get episodes for this specific subscription, playlists in playlist order
+	var episodes []models.Episode
+	if subscription.SourceType == db.SourceTypePlaylist {
+		episodes, err = db.GetCompletedEpisodesByPlaylistPosition(subscription.ID, limit, skip)
+	} else {
+		// Newest first, so the oldest skip episodes come last
+		episodes, err = db.GetCompletedEpisodesBySubscriptionID(subscription.ID, limit, max(total-skip-limit, 0))
+	}
 	if err != nil {
 		log.Printf("Error getting episodes for subscription %d: %v", subscription.ID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	// Pages come newest first for channels and in order for playlists; a
+	// feed type chosen by the user flips that
+	natural := models.FeedTypeEpisodic
+	if subscription.SourceType == db.SourceTypePlaylist {
+		natural = models.FeedTypeSerial
+	}
+	if subscription.FeedType() != natural {
+		slices.Reverse(episodes)
+	}
+
+	// Channel metadata only enriches the feed, so a missing row is fine
+	var channel *models.Channel
+	if c, err := db.GetChannel(subscription.Provider, subscription.YoutubeChannelID); err == nil {
+		channel = &c
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting channel metadata for subscription %d: %v", subscription.ID, err)
+	}
 
 	// Generate RSS for this specific subscription
-	rss, err := feed.GenerateSubscriptionRSS(&subscription, episodes, r)
+	generate := feed.GenerateSubscriptionRSS
+	if moved {
+		generate = feed.GenerateMovedSubscriptionRSS
+	}
+	rss, err := generate(&subscription, channel, episodes, page, fr.Format, r)
 	if err != nil {
 		log.Printf("Error generating RSS for subscription %d: %v", subscription.ID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/rss+xml")
-	w.Write([]byte(rss))
+	serveFeed(w, r, feedcache.Put(r.Context(), fr.CacheKey, subscription.UserID, generation, fr.Format.ContentType(), []byte(rss)))
 }
 
+// renderInboxFeed serves the listen later feed, which lives at the user's own RSS UUID
+func (h *Handlers) renderInboxFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	user, err := db.GetUserByRSSUUID(fr.UUID)
+	if err != nil {
+		return false
+	}
+	generation := feedcache.Generation(r.Context(), user.ID)
+
+	episodes, err := db.GetCompletedInboxEpisodesByUserID(user.ID)
+	if err != nil {
+		log.Printf("Error getting inbox episodes for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	rss, err := feed.GenerateRSS(user, episodes, fr.Format, r)
+	if err != nil {
+		log.Printf("Error generating inbox RSS for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	serveFeed(w, r, feedcache.Put(r.Context(), fr.CacheKey, user.ID, generation, fr.Format.ContentType(), []byte(rss)))
+	return true
+}
+
+func (h *Handlers) renderCombinedFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	user, err := db.GetUserByCombinedRSSUUID(fr.UUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting user by combined feed UUID: %v", err)
+		}
+		return false
+	}
+	generation := feedcache.Generation(r.Context(), user.ID)
+
+	limit, prefixTitles := mergedFeedOptions(r)
+	episodes, err := db.GetCompletedEpisodesByUserID(user.ID, limit)
+	if err != nil {
+		log.Printf("Error getting combined feed episodes for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	rss, err := feed.GenerateCombinedRSS(user, episodes, prefixTitles, fr.Format, r)
+	if err != nil {
+		log.Printf("Error generating combined RSS for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	serveFeed(w, r, feedcache.Put(r.Context(), fr.CacheKey, user.ID, generation, fr.Format.ContentType(), []byte(rss)))
+	return true
+}
+
+func (h *Handlers) renderBundleFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	bundle, err := db.GetBundleByRSSUUID(fr.UUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting bundle by RSS UUID: %v", err)
+		}
+		return false
+	}
+	generation := feedcache.Generation(r.Context(), bundle.UserID)
+
+	limit, prefixTitles := mergedFeedOptions(r)
+	episodes, err := db.GetCompletedEpisodesByBundleID(bundle.ID, limit)
+	if err != nil {
+		log.Printf("Error getting episodes for bundle %d: %v", bundle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	rss, err := feed.GenerateBundleRSS(&bundle, episodes, prefixTitles, fr.Format, r)
+	if err != nil {
+		log.Printf("Error generating RSS for bundle %d: %v", bundle.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	serveFeed(w, r, feedcache.Put(r.Context(), fr.CacheKey, bundle.UserID, generation, fr.Format.ContentType(), []byte(rss)))
+	return true
+}
+
+// renderSmartFeed serves the episodes matching a smart feed's rule. Rules on
+// age drift with time, so these feeds also rely on the cache TTL to refresh.
+func (h *Handlers) renderSmartFeed(w http.ResponseWriter, r *http.Request, fr feedRequest) bool {
+	smartFeed, err := db.GetSmartFeedByRSSUUID(fr.UUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting smart feed by RSS UUID: %v", err)
+		}
+		return false
+	}
+	generation := feedcache.Generation(r.Context(), smartFeed.UserID)
+
+	limit, prefixTitles := mergedFeedOptions(r)
+	episodes, err := db.GetEpisodesMatchingRule(smartFeed.UserID, smartFeed.Rule, limit)
+	if err != nil {
+		log.Printf("Error getting episodes for smart feed %d: %v", smartFeed.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	rss, err := feed.GenerateSmartRSS(&smartFeed, episodes, prefixTitles, fr.Format, r)
+	if err != nil {
+		log.Printf("Error generating RSS for smart feed %d: %v", smartFeed.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+
+	serveFeed(w, r, feedcache.Put(r.Context(), fr.CacheKey, smartFeed.UserID, generation, fr.Format.ContentType(), []byte(rss)))
+	return true
+}
+
+// ServeAudioFile serves an episode's audio by its audio UUID, if the URL is
+// signed for a feed the episode still belongs to. The audio of private feeds
+// is behind FeedAuthMiddleware with AudioFeedUUID.
 func (h *Handlers) ServeAudioFile(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	filename := vars["filename"]
+	audioUUID, ok := requestAudioUUID(r)
+	if !ok {
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+
+	access, err := db.GetAudioAccess(audioUUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting audio %s: %v", audioUUID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+	// The episode's subscription was removed
+	if len(access.FeedTokens) == 0 {
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
 
-	filePath := filepath.Join(h.audioStoragePath, filename)
-	http.ServeFile(w, r, filePath)
+	feedToken, err := audiourl.Match(access.AudioUUID, access.FeedTokens, r.URL.Query())
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, audiourl.ErrExpired) {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	analytics.RecordAudio(r, feedToken, access.AudioUUID)
+	if access.Status != db.StatusCompleted && !h.awaitOnDemandAudio(w, r, access) {
+		return
+	}
+	// The path is built from the UUID the database returned, never the request
+	filename := access.AudioUUID + ".m4a"
+	if profile, ok := transcode.Lookup(r.URL.Query().Get(transcode.ProfileParam)); ok {
+		transcode.Serve(w, r, filepath.Join(h.audioStoragePath, filename), access.AudioUUID, profile)
+		return
+	}
+	setAudioCacheHeaders(w, r, access.AudioUUID)
+	h.sendAudioFile(w, r, filename)
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/transcode"
+)
+
+type feedAudioView struct {
+	RSSUUID  string
+	Profile  string
+	Profiles []transcode.Profile
+}
+
+func (h *Handlers) renderFeedAudio(w http.ResponseWriter, rssUUID string, profile string) {
+	view := feedAudioView{RSSUUID: rssUUID, Profile: profile, Profiles: transcode.Profiles}
+	if err := h.templates.ExecuteTemplate(w, "feed_audio.html", view); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) GetFeedAudio(w http.ResponseWriter, r *http.Request) {
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+	profile, err := db.GetFeedAudioProfile(rssUUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting audio profile of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.renderFeedAudio(w, rssUUID, profile)
+}
+
+// PutFeedAudio picks the audio variant a feed links to; an empty profile
+// links to the original audio.
+func (h *Handlers) PutFeedAudio(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+	profile := r.FormValue("profile")
+
+	var err error
+	if profile == "" {
+		err = db.DeleteFeedAudioProfile(user.ID, rssUUID)
+	} else {
+		if _, ok := transcode.Lookup(profile); !ok {
+			http.Error(w, "Unknown audio profile", http.StatusBadRequest)
+			return
+		}
+		err = db.SetFeedAudioProfile(user.ID, rssUUID, profile)
+	}
+	if err != nil {
+		log.Printf("Error setting audio profile of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	h.renderFeedAudio(w, rssUUID, profile)
+}
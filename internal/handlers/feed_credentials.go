@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedauth"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// defaultFeedUsername is offered for private feeds; the password is what matters
+const defaultFeedUsername = "podcast"
+
+// feedCredentialsView shows whether a feed is private. Password and the URLs
+// carrying it are only set right after a password is generated, the one time
+// it is shown.
+type feedCredentialsView struct {
+	RSSUUID      string
+	Private      bool
+	Username     string
+	CreatedAt    string
+	Password     string
+	BasicAuthURL string
+	TokenURL     string
+}
+
+func newFeedCredentialsView(rssUUID string, credentials *models.FeedCredentials) feedCredentialsView {
+	view := feedCredentialsView{RSSUUID: rssUUID, Username: defaultFeedUsername}
+	if credentials != nil {
+		view.Private = true
+		view.Username = credentials.Username
+		view.CreatedAt = credentials.CreatedAt.Format("Jan 2, 2006")
+	}
+	return view
+}
+
+// userFeed reads the RSS UUID of the request's feed, writing a 404 unless it
+// is one of the user's feeds
+func userFeed(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rssUUID := mux.Vars(r)["uuid"]
+	if uuid.Validate(rssUUID) != nil {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return "", false
+	}
+	owned, err := db.UserOwnsFeed(user.ID, rssUUID)
+	if err != nil {
+		log.Printf("Error checking the owner of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	if !owned {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return "", false
+	}
+	return rssUUID, true
+}
+
+func (h *Handlers) renderFeedCredentials(w http.ResponseWriter, view feedCredentialsView) {
+	if err := h.templates.ExecuteTemplate(w, "feed_credentials.html", view); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) GetFeedCredentials(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+	credentials, err := db.GetUserFeedCredentials(user.ID, rssUUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting credentials of feed %s: %v", rssUUID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.renderFeedCredentials(w, newFeedCredentialsView(rssUUID, nil))
+		return
+	}
+	h.renderFeedCredentials(w, newFeedCredentialsView(rssUUID, &credentials))
+}
+
+// PostFeedCredentials makes a feed private with a new generated password,
+// replacing the old one if the feed already was.
+func (h *Handlers) PostFeedCredentials(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+	username := strings.TrimSpace(r.FormValue("username"))
+	if username == "" {
+		username = defaultFeedUsername
+	}
+	if err := feedauth.ValidateUsername(username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	password, err := feedauth.NewPassword()
+	if err != nil {
+		log.Printf("Error generating a feed password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	credentials, err := db.SetFeedCredentials(user.ID, rssUUID, username, feedauth.Hash(password))
+	if err != nil {
+		log.Printf("Error setting credentials of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Cached feeds may carry the old password in their audio URLs
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	baseURL := getBaseURL()
+	feedURL, err := url.Parse(fmt.Sprintf("%s/rss/%s", baseURL, rssUUID))
+	if err != nil {
+		log.Printf("Error parsing feed URL: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	view := newFeedCredentialsView(rssUUID, &credentials)
+	view.Password = password
+	view.TokenURL = feedURL.String() + "?" + url.Values{feedauth.TokenParam: {password}}.Encode()
+	// Some apps take the credentials as part of the URL
+	feedURL.User = url.UserPassword(username, password)
+	view.BasicAuthURL = feedURL.String()
+	h.renderFeedCredentials(w, view)
+}
+
+// DeleteFeedCredentials makes a private feed public again.
+func (h *Handlers) DeleteFeedCredentials(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteFeedCredentials(user.ID, rssUUID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error deleting credentials of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	h.renderFeedCredentials(w, newFeedCredentialsView(rssUUID, nil))
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/rewrite"
+
+	"github.com/gorilla/mux"
+)
+
+// languagePattern accepts language tags like "en" or "pt-BR"
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// optionalText reads a free-text setting; an empty value gives nil
+func optionalText(value string, maxLength int, name string) (*string, error) {
+	text := strings.TrimSpace(value)
+	if text == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(text) > maxLength {
+		return nil, fmt.Errorf("%s is too long", name)
+	}
+	return &text, nil
+}
+
+// parseFeedSettingsForm reads the feed overrides of a subscription. Empty
+// fields keep the defaults.
+func parseFeedSettingsForm(r *http.Request) (models.FeedSettings, error) {
+	var settings models.FeedSettings
+	var err error
+
+	if settings.Title, err = optionalText(r.FormValue("title"), maxFeedTitleLength, "Title"); err != nil {
+		return settings, err
+	}
+	if settings.Description, err = optionalText(r.FormValue("description"), 4000, "Description"); err != nil {
+		return settings, err
+	}
+	if settings.ImageURL, err = parseImageURL(r.FormValue("image_url")); err != nil {
+		return settings, err
+	}
+	if settings.Author, err = optionalText(r.FormValue("author"), 255, "Author"); err != nil {
+		return settings, err
+	}
+	if settings.Category, err = optionalText(r.FormValue("category"), 255, "Category"); err != nil {
+		return settings, err
+	}
+	if settings.Language, err = optionalText(r.FormValue("language"), 35, "Language"); err != nil {
+		return settings, err
+	}
+	if settings.Language != nil && !languagePattern.MatchString(*settings.Language) {
+		return settings, errors.New("Language must be a code like en or pt-BR")
+	}
+
+	switch feedType := r.FormValue("type"); feedType {
+	case "":
+	case models.FeedTypeEpisodic, models.FeedTypeSerial:
+		settings.Type = &feedType
+	default:
+		return settings, errors.New("Episode order must be episodic or serial")
+	}
+
+	if value := r.FormValue("explicit"); value != "" {
+		explicit, err := strconv.ParseBool(value)
+		if err != nil {
+			return settings, errors.New("Invalid explicit flag")
+		}
+		settings.Explicit = &explicit
+	}
+
+	if settings.Rewrite, err = parseRewriteForm(r); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// parseRewriteForm reads the title rules and episode numbering of a feed
+func parseRewriteForm(r *http.Request) (rewrite.Rules, error) {
+	rules, err := rewrite.Parse(r.FormValue("title_rules"))
+	if err != nil {
+		return rewrite.Rules{}, err
+	}
+	numberEpisodes, _ := strconv.ParseBool(r.FormValue("number_episodes"))
+	return rewrite.Rules{Title: rules, NumberEpisodes: numberEpisodes}, nil
+}
+
+// feedSettingsView fills the feed settings form, with unset overrides left empty
+type feedSettingsView struct {
+	ID          int
+	Title       string
+	Description string
+	ImageURL    string
+	Author      string
+	Category    string
+	Language    string
+	Type        string
+	Explicit    string
+	// TitleRules are the title rewrite rules, one per line
+	TitleRules     string
+	NumberEpisodes bool
+}
+
+func newFeedSettingsView(subscriptionID int, settings models.FeedSettings) feedSettingsView {
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	view := feedSettingsView{
+		ID:             subscriptionID,
+		Title:          value(settings.Title),
+		Description:    value(settings.Description),
+		ImageURL:       value(settings.ImageURL),
+		Author:         value(settings.Author),
+		Category:       value(settings.Category),
+		Language:       value(settings.Language),
+		Type:           value(settings.Type),
+		TitleRules:     settings.Rewrite.String(),
+		NumberEpisodes: settings.Rewrite.NumberEpisodes,
+	}
+	if settings.Explicit != nil {
+		view.Explicit = strconv.FormatBool(*settings.Explicit)
+	}
+	return view
+}
+
+// userSubscription loads a subscription of the request's user from the id route variable
+func userSubscription(w http.ResponseWriter, r *http.Request) (*models.Subscription, bool) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return nil, false
+	}
+	subscription, err := db.GetSubscriptionByID(subscriptionID)
+	if err != nil || subscription.UserID != user.ID || !subscription.Active {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting subscription %d: %v", subscriptionID, err)
+		}
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &subscription, true
+}
+
+func (h *Handlers) GetSubscriptionFeedSettings(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := userSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.templates.ExecuteTemplate(w, "feed_settings.html", newFeedSettingsView(subscription.ID, subscription.FeedSettings))
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) PutSubscriptionFeedSettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	subscription, ok := userSubscription(w, r)
+	if !ok {
+		return
+	}
+	settings, err := parseFeedSettingsForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateSubscriptionFeedSettings(user.ID, subscription.ID, settings)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating feed settings of subscription %d: %v", subscription.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	err = h.templates.ExecuteTemplate(w, "feed_settings.html", newFeedSettingsView(subscription.ID, settings))
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// previewEpisodeCount is how many recent episodes rewrite rules are previewed against
+const previewEpisodeCount = 10
+
+// rewritePreview is one episode title before and after rewriting
+type rewritePreview struct {
+	Original string
+	rewrite.Result
+}
+
+// PostSubscriptionFeedPreview shows what the submitted rewrite rules make of
+// the subscription's recent episode titles, without saving them.
+func (h *Handlers) PostSubscriptionFeedPreview(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := userSubscription(w, r)
+	if !ok {
+		return
+	}
+	rules, err := parseRewriteForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rewriter, err := rules.Compile()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	episodes, err := db.GetCompletedEpisodesBySubscriptionID(subscription.ID, previewEpisodeCount, 0)
+	if err != nil {
+		log.Printf("Error getting episodes to preview for subscription %d: %v", subscription.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	previews := make([]rewritePreview, 0, len(episodes))
+	for _, episode := range episodes {
+		title := ""
+		if episode.Title != nil {
+			title = *episode.Title
+		}
+		previews = append(previews, rewritePreview{Original: title, Result: rewriter.Apply(title)})
+	}
+
+	err = h.templates.ExecuteTemplate(w, "feed_preview.html", previews)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
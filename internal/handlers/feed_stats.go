@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/models"
+)
+
+const (
+	// statsDays is how far back downloads are counted
+	statsDays = 30
+	// activeSubscriberDays is how recently a subscriber must have fetched the feed
+	activeSubscriberDays = 7
+)
+
+type feedStatsView struct {
+	Days        int
+	Downloads   int
+	Subscribers int
+	Apps        []models.FeedAppStats
+}
+
+// GetFeedStats shows a feed's downloads and active subscribers per podcast app.
+func (h *Handlers) GetFeedStats(w http.ResponseWriter, r *http.Request) {
+	rssUUID, ok := userFeed(w, r)
+	if !ok {
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	apps, err := db.GetFeedStats(rssUUID, today.AddDate(0, 0, -statsDays), today.AddDate(0, 0, -activeSubscriberDays))
+	if err != nil {
+		log.Printf("Error getting stats of feed %s: %v", rssUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	view := feedStatsView{Days: statsDays, Apps: apps}
+	for _, app := range apps {
+		view.Downloads += app.Downloads
+		view.Subscribers += app.Subscribers
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "feed_stats.html", view); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
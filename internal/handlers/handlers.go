@@ -4,6 +4,12 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/youtube"
 	"yt-podcaster/pkg/tasks"
 )
 
@@ -11,16 +17,41 @@ type Handlers struct {
 	templates        *template.Template
 	asynqClient      tasks.TaskEnqueuer
 	audioStoragePath string
+	channelResolver  youtube.ChannelResolver
+	// pendingSubscriptions maps bot preview messages to the pendingSubscription confirming them subscribes to
+	pendingSubscriptions sync.Map
 }
 
 func New(templates *template.Template, asynqClient tasks.TaskEnqueuer, audioStoragePath string) *Handlers {
+	client := &http.Client{Timeout: 10 * time.Second}
 	return &Handlers{
 		templates:        templates,
 		asynqClient:      asynqClient,
 		audioStoragePath: audioStoragePath,
+		channelResolver:  youtube.NewCachedResolver(youtube.NewDefaultResolver(client), db.ChannelResolutionCache{}, getChannelResolveCacheTTL()),
 	}
 }
 
+// getBaseURL returns the public URL feed links are built from
+func getBaseURL() string {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080" // fallback for development
+	}
+	return baseURL
+}
+
+// getChannelResolveCacheTTL returns how long resolved handles and channel titles are trusted
+func getChannelResolveCacheTTL() time.Duration {
+	ttl := 7 * 24 * time.Hour
+	if env := os.Getenv("CHANNEL_RESOLVE_CACHE_TTL_HOURS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			ttl = time.Duration(val) * time.Hour
+		}
+	}
+	return ttl
+}
+
 func (h *Handlers) ServeWebApp(w http.ResponseWriter, r *http.Request) {
 	err := h.templates.ExecuteTemplate(w, "index.html", nil)
 	if err != nil {
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"yt-podcaster/internal/audiourl"
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// hlsFilePattern matches the files of the HLS renditions the worker makes
+var hlsFilePattern = regexp.MustCompile(`^(index\.m3u8|init\.mp4|seg\d{5}\.m4s)$`)
+
+// hlsMapPattern matches the init segment URI of an fMP4 playlist
+var hlsMapPattern = regexp.MustCompile(`URI="([^"?]*)"`)
+
+// hlsPlaybackURL returns the URL of an episode's HLS playlist for the Mini App
+// player, or "" when the episode has no HLS rendition.
+func hlsPlaybackURL(episode models.Episode, feedToken string) string {
+	if !episode.HLSReady || episode.Status != db.StatusCompleted {
+		return ""
+	}
+	return "/hls/" + episode.AudioUUID + "/index.m3u8?" + audiourl.SignPlayback(episode.AudioUUID, feedToken).Encode()
+}
+
+// ServeHLS serves the HLS rendition of an episode to the Mini App player, if
+// the URL is signed for playback from a feed the episode still belongs to.
+// Playback URLs are only handed to the feed's owner, so private feeds'
+// credentials aren't asked for.
+func (h *Handlers) ServeHLS(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	audioUUID, file := vars["uuid"], vars["file"]
+	if uuid.Validate(audioUUID) != nil || !hlsFilePattern.MatchString(file) {
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+
+	access, err := db.GetAudioAccess(audioUUID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting audio %s: %v", audioUUID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+	if len(access.FeedTokens) == 0 {
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	if err := audiourl.VerifyPlayback(access.AudioUUID, access.FeedTokens, query); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, audiourl.ErrExpired) {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// The path is built from the UUID the database returned and a known file name
+	relPath := filepath.Join("hls", access.AudioUUID, file)
+	w.Header().Set("Cache-Control", "private")
+	if file != "index.m3u8" {
+		w.Header().Set("Content-Type", "audio/mp4")
+		setAudioCacheHeaders(w, r, access.AudioUUID+"/"+file)
+		h.sendAudioFile(w, r, relPath)
+		return
+	}
+
+	playlist, err := os.ReadFile(filepath.Join(h.audioStoragePath, relPath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading HLS playlist of %s: %v", audioUUID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Audio not found", http.StatusNotFound)
+		return
+	}
+	signature := url.Values{"sig": {query.Get("sig")}, "exp": {query.Get("exp")}}.Encode()
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write([]byte(signPlaylist(string(playlist), signature)))
+}
+
+// signPlaylist appends the playlist's signature to the URIs in it, since
+// relative segment URIs don't carry the query of the playlist URL
+func signPlaylist(playlist string, signature string) string {
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			lines[i] = hlsMapPattern.ReplaceAllString(line, `URI="${1}?`+signature+`"`)
+		case !strings.HasPrefix(line, "#"):
+			lines[i] = line + "?" + signature
+		}
+	}
+	return strings.Join(lines, "\n")
+}
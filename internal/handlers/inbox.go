@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/pkg/tasks"
+
+	"github.com/hibiken/asynq"
+)
+
+var errAlreadyInInbox = errors.New("video already in inbox")
+
+// getInboxFeedURL returns the listen later feed URL, which is served at the user's RSS UUID
+func getInboxFeedURL(user *models.User) string {
+	return fmt.Sprintf("%s/rss/%s", getBaseURL(), user.RSSUUID)
+}
+
+// addVideoToInbox creates a one-off episode in the user's inbox and queues it for processing
+func (h *Handlers) addVideoToInbox(userID int64, provider source.Provider, videoID string) (*models.Episode, error) {
+	episode, err := db.CreateInboxEpisode(userID, provider.Name(), videoID)
+	if err != nil {
+		log.Printf("Error creating inbox episode for user %d: %v", userID, err)
+		if strings.Contains(err.Error(), "episodes_user_id_youtube_video_id_inbox_key") {
+			return nil, errAlreadyInInbox
+		}
+		return nil, err
+	}
+
+	task, err := tasks.NewProcessEpisodeTask(episode.ID, episode.YoutubeVideoID)
+	if err != nil {
+		log.Printf("Error creating task: %v", err)
+		return &episode, nil
+	}
+
+	// The user asked for this video explicitly, so don't make them wait behind channel backlogs
+	opts := append(tasks.GetProcessVideoTaskOptions(), asynq.Queue("high"))
+	if _, err := h.asynqClient.Enqueue(task, opts...); err != nil {
+		log.Printf("Error enqueuing task: %v", err)
+	}
+
+	return &episode, nil
+}
+
+func (h *Handlers) GetInbox(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	episodes, err := db.GetInboxEpisodesByUserID(user.ID)
+	if err != nil {
+		log.Printf("Error getting inbox episodes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Episodes packaged as HLS can be played right in the Mini App
+	type inboxEpisode struct {
+		models.Episode
+		PlaybackURL string
+	}
+	inboxEpisodes := make([]inboxEpisode, len(episodes))
+	for i, episode := range episodes {
+		inboxEpisodes[i] = inboxEpisode{Episode: episode, PlaybackURL: hlsPlaybackURL(episode, user.RSSUUID)}
+	}
+
+	templateData := struct {
+		Episodes []inboxEpisode
+		FeedURL  string
+		RSSUUID  string
+	}{
+		Episodes: inboxEpisodes,
+		FeedURL:  getInboxFeedURL(user),
+		RSSUUID:  user.RSSUUID,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "inbox.html", templateData)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) PostInbox(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	provider, videoID, err := source.MatchVideo(strings.TrimSpace(r.FormValue("url")))
+	if err != nil {
+		if errors.Is(err, source.ErrProviderNotAllowed) {
+			http.Error(w, "Videos from this site are not enabled on this server", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Invalid video URL format", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.addVideoToInbox(user.ID, provider, videoID)
+	if err != nil {
+		if errors.Is(err, errAlreadyInInbox) {
+			http.Error(w, "This video is already in your Listen Later feed.", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetInbox(w, r)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/pkg/tasks"
+
+	"github.com/hibiken/asynq"
+)
+
+// onDemandPollInterval is how often a waiting request checks whether the audio arrived
+const onDemandPollInterval = time.Second
+
+// onDemandRetryAfter is when podcast apps are told to try again after the wait ran out
+const onDemandRetryAfter = 60 * time.Second
+
+// getOnDemandWait returns how long a request for an on-demand episode waits
+// for its audio; podcast apps give up on requests after about half a minute
+func getOnDemandWait() time.Duration {
+	wait := 20 * time.Second
+	if env := os.Getenv("ON_DEMAND_WAIT_SECONDS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val >= 0 {
+			wait = time.Duration(val) * time.Second
+		}
+	}
+	return wait
+}
+
+// awaitOnDemandAudio has the audio of an on-demand episode fetched, on the
+// first request for it, and waits for it to arrive. When it doesn't in time,
+// or can't be fetched, it answers the request and returns false; podcast apps
+// retry the 503 once the audio is likely there.
+func (h *Handlers) awaitOnDemandAudio(w http.ResponseWriter, r *http.Request, access models.AudioAccess) bool {
+	if access.Status == db.StatusOnDemand {
+		requested, err := db.RequestOnDemandEpisode(access.EpisodeID)
+		if err != nil {
+			log.Printf("Error requesting on-demand episode %d: %v", access.EpisodeID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if requested {
+			h.enqueueOnDemandEpisode(access)
+		}
+	}
+
+	deadline := time.Now().Add(getOnDemandWait())
+	for {
+		status, err := db.GetEpisodeStatus(access.EpisodeID)
+		if err != nil {
+			log.Printf("Error getting status of episode %d: %v", access.EpisodeID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		switch status {
+		case db.StatusCompleted:
+			return true
+		case db.StatusFailed:
+			http.Error(w, "Audio could not be fetched", http.StatusNotFound)
+			return false
+		}
+
+		if !time.Now().Before(deadline) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(onDemandRetryAfter.Seconds())))
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "Audio is being fetched, try again shortly", http.StatusServiceUnavailable)
+			return false
+		}
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-time.After(onDemandPollInterval):
+		}
+	}
+}
+
+// enqueueOnDemandEpisode queues fetching an episode's audio for the on-demand
+// worker, as a listener is waiting for it. If that fails the episode is
+// left on demand for the next request to try again.
+func (h *Handlers) enqueueOnDemandEpisode(access models.AudioAccess) {
+	task, err := tasks.NewOnDemandEpisodeTask(access.EpisodeID, access.YoutubeVideoID)
+	if err == nil {
+		opts := append(tasks.GetProcessVideoTaskOptions(), asynq.Queue(tasks.QueueOnDemand))
+		_, err = h.asynqClient.Enqueue(task, opts...)
+	}
+	if err != nil {
+		log.Printf("Error enqueuing on-demand episode %d: %v", access.EpisodeID, err)
+		if err := db.UpdateEpisodeStatus(access.EpisodeID, db.StatusOnDemand); err != nil {
+			log.Printf("Error resetting on-demand episode %d: %v", access.EpisodeID, err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/filter"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/internal/youtube"
+	"yt-podcaster/internal/ytdlp"
+)
+
+// previewUploadCount is how many recent uploads a preview lists
+const previewUploadCount = 10
+
+func getPreviewTimeout() time.Duration {
+	timeout := 30 * time.Second // listing uploads through yt-dlp is slower than resolving
+	if env := os.Getenv("PREVIEW_TIMEOUT_SECONDS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			timeout = time.Duration(val) * time.Second
+		}
+	}
+	return timeout
+}
+
+// previewUpload is a recent upload as shown before subscribing
+type previewUpload struct {
+	Title     string
+	Duration  string
+	Published string
+	Included  bool
+	Reason    string
+}
+
+// subscriptionPreview is what a user sees before confirming a subscription
+type subscriptionPreview struct {
+	// URL is what confirming subscribes to
+	URL          string
+	Title        string
+	AvatarURL    string
+	ProviderName string
+	IsPlaylist   bool
+	Uploads      []previewUpload
+	// WeeklyAudio is empty when the listing has no upload dates to estimate from
+	WeeklyAudio string
+	TotalAudio  string
+}
+
+// buildSubscriptionPreview resolves a validated channel or playlist URL and lists its
+// recent uploads together with whether the subscription's filters would include them.
+func (h *Handlers) buildSubscriptionPreview(ctx context.Context, provider source.Provider, sourceURL string) (*subscriptionPreview, error) {
+	preview := &subscriptionPreview{URL: sourceURL, ProviderName: provider.DisplayName()}
+	listing := &models.Subscription{Provider: provider.Name(), SourceType: db.SourceTypeChannel}
+
+	if provider.Name() == source.ProviderYouTube {
+		ref, err := youtube.Parse(sourceURL)
+		if err != nil || !ref.IsSource() {
+			return nil, fmt.Errorf("%w: %q is not a YouTube channel or playlist", errSourceInfo, sourceURL)
+		}
+		info, err := h.channelResolver.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSourceInfo, err)
+		}
+
+		preview.URL = ref.Canonical()
+		preview.Title = info.Title
+		listing.YoutubeChannelID = info.ChannelID
+		if ref.Kind == youtube.KindPlaylist {
+			listing.SourceType = db.SourceTypePlaylist
+			listing.YoutubePlaylistID = &ref.ID
+		}
+	} else {
+		listing.YoutubeChannelID = provider.SourceID(sourceURL)
+	}
+	preview.IsPlaylist = listing.SourceType == db.SourceTypePlaylist
+
+	meta, err := ytdlp.ListChannel(ctx, provider.ListURL(listing), previewUploadCount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSourceInfo, err)
+	}
+	if preview.Title == "" {
+		preview.Title = meta.Title
+	}
+
+	preview.AvatarURL = meta.AvatarURL
+	if preview.AvatarURL == "" {
+		// Playlist listings carry no avatar, but a refreshed owner channel might
+		if channel, err := db.GetChannel(provider.Name(), meta.ID); err == nil && channel.AvatarURL != nil {
+			preview.AvatarURL = *channel.AvatarURL
+		}
+	}
+
+	dates := make([]string, len(meta.Entries))
+	for i, entry := range meta.Entries {
+		dates[i] = entryUploadDate(entry)
+	}
+	decisions := filter.Rules{Playlist: preview.IsPlaylist}.Preview(dates)
+
+	var total, dated time.Duration
+	var oldest time.Time
+	for i, entry := range meta.Entries {
+		duration := time.Duration(entry.Duration) * time.Second
+		upload := previewUpload{
+			Title:    entry.Title,
+			Included: decisions[i].Included,
+			Reason:   decisions[i].Reason,
+		}
+		if duration > 0 {
+			upload.Duration = formatDuration(duration)
+		}
+		if published, err := time.Parse("20060102", dates[i]); err == nil {
+			upload.Published = published.Format("Jan 2, 2006")
+			if upload.Included {
+				dated += duration
+				if oldest.IsZero() || published.Before(oldest) {
+					oldest = published
+				}
+			}
+		}
+		if upload.Included {
+			total += duration
+		}
+		preview.Uploads = append(preview.Uploads, upload)
+	}
+
+	if total > 0 {
+		preview.TotalAudio = formatAudioVolume(total)
+	}
+	// Spread the dated uploads over the weeks since the oldest of them
+	if !oldest.IsZero() && dated > 0 {
+		weeks := time.Since(oldest).Hours() / (24 * 7)
+		if weeks < 1 {
+			weeks = 1
+		}
+		preview.WeeklyAudio = formatAudioVolume(time.Duration(float64(dated) / weeks))
+	}
+
+	return preview, nil
+}
+
+// entryUploadDate returns the upload date in yt-dlp's YYYYMMDD format, if known
+func entryUploadDate(entry ytdlp.Entry) string {
+	if entry.UploadDate != "" {
+		return entry.UploadDate
+	}
+	if entry.Timestamp > 0 {
+		return time.Unix(entry.Timestamp, 0).UTC().Format("20060102")
+	}
+	return ""
+}
+
+// formatDuration renders a video length as 12:34 or 1:02:03
+func formatDuration(d time.Duration) string {
+	seconds := int(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// formatAudioVolume renders an amount of audio as 3h 20m or 45m
+func formatAudioVolume(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes < 1 {
+		return "under a minute"
+	}
+	if minutes >= 60 {
+		return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func (h *Handlers) PostSubscriptionPreview(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	channelURL := r.FormValue("url")
+	if channelURL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate URL against the allowlisted providers to prevent SSRF attacks
+	provider, err := source.MatchSource(channelURL)
+	if err != nil {
+		if errors.Is(err, source.ErrProviderNotAllowed) {
+			http.Error(w, "Subscriptions from this site are not enabled on this server", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Invalid YouTube URL format", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), getPreviewTimeout())
+	defer cancel()
+
+	preview, err := h.buildSubscriptionPreview(ctx, provider, channelURL)
+	if err != nil {
+		log.Printf("Error building preview for URL '%s': %v", channelURL, err)
+		if errors.Is(err, errSourceInfo) {
+			http.Error(w, "Could not extract channel info from URL", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.templates.ExecuteTemplate(w, "preview.html", preview)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
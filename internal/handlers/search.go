@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"yt-podcaster/internal/youtube"
+	"yt-podcaster/internal/ytdlp"
+)
+
+// searchResultCount is how many channels a search returns
+const searchResultCount = 8
+
+// searchResult is a channel candidate with the URL subscribing to it
+type searchResult struct {
+	ytdlp.ChannelCandidate
+	URL         string
+	Subscribers string
+}
+
+// searchChannels looks up YouTube channels by name
+func searchChannels(ctx context.Context, query string) ([]searchResult, error) {
+	candidates, err := ytdlp.SearchChannels(ctx, query, searchResultCount)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]searchResult, 0, len(candidates))
+	for _, c := range candidates {
+		results = append(results, searchResult{
+			ChannelCandidate: c,
+			URL:              youtube.Ref{Kind: youtube.KindChannel, ID: c.ID}.Canonical(),
+			Subscribers:      formatSubscriberCount(c.SubscriberCount),
+		})
+	}
+	return results, nil
+}
+
+// formatSubscriberCount renders 16800000 as "16.8M subscribers"
+func formatSubscriberCount(count int64) string {
+	switch {
+	case count <= 0:
+		return ""
+	case count >= 1_000_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(count)/1_000_000), ".0") + "M subscribers"
+	case count >= 1_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(count)/1_000), ".0") + "K subscribers"
+	}
+	return fmt.Sprintf("%d subscribers", count)
+}
+
+func (h *Handlers) GetSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var results []searchResult
+	if len([]rune(query)) >= 2 {
+		ctx, cancel := context.WithTimeout(r.Context(), getPreviewTimeout())
+		defer cancel()
+
+		var err error
+		results, err = searchChannels(ctx, query)
+		if err != nil {
+			log.Printf("Error searching channels for %q: %v", query, err)
+			http.Error(w, "Search failed, please try again", http.StatusBadGateway)
+			return
+		}
+	}
+
+	templateData := struct {
+		Query   string
+		Results []searchResult
+	}{
+		Query:   query,
+		Results: results,
+	}
+
+	err := h.templates.ExecuteTemplate(w, "search.html", templateData)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/smartfeed"
+
+	"github.com/gorilla/mux"
+)
+
+// smartFeedPreviewLimit caps the episodes shown by a rule preview
+const smartFeedPreviewLimit = 20
+
+// parseSmartFeedForm reads the title and rule fields of a smart feed
+func parseSmartFeedForm(r *http.Request) (string, smartfeed.Rule, error) {
+	title, err := parseFeedTitle(r.FormValue("title"))
+	if err != nil {
+		return "", smartfeed.Rule{}, err
+	}
+	rule, err := smartfeed.Parse(r.FormValue("rule"))
+	if err != nil {
+		return "", smartfeed.Rule{}, err
+	}
+	return title, rule, nil
+}
+
+func (h *Handlers) GetSmartFeeds(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	feeds, err := db.GetSmartFeedsByUserID(user.ID)
+	if err != nil {
+		log.Printf("Error getting smart feeds for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := getBaseURL()
+
+	templateData := struct {
+		SmartFeeds []models.SmartFeed
+		BaseURL    string
+	}{
+		SmartFeeds: feeds,
+		BaseURL:    baseURL,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "smart_feeds.html", templateData)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) PostSmartFeed(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	title, rule, err := parseSmartFeedForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.CreateSmartFeed(user.ID, title, rule); err != nil {
+		log.Printf("Error creating smart feed for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetSmartFeeds(w, r)
+}
+
+func (h *Handlers) PutSmartFeed(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	feedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid smart feed ID", http.StatusBadRequest)
+		return
+	}
+	title, rule, err := parseSmartFeedForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = db.UpdateSmartFeed(user.ID, feedID, title, rule)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Smart feed not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating smart feed %d: %v", feedID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	h.GetSmartFeeds(w, r)
+}
+
+func (h *Handlers) DeleteSmartFeed(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	feedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid smart feed ID", http.StatusBadRequest)
+		return
+	}
+
+	err = db.DeleteSmartFeed(user.ID, feedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Smart feed not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting smart feed %d: %v", feedID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PostSmartFeedPreview shows the newest episodes a rule currently matches,
+// without saving anything.
+func (h *Handlers) PostSmartFeedPreview(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	rule, err := smartfeed.Parse(r.FormValue("rule"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	episodes, err := db.GetEpisodesMatchingRule(user.ID, rule, smartFeedPreviewLimit)
+	if err != nil {
+		log.Printf("Error previewing smart feed rule for user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	templateData := struct {
+		Episodes []models.SubscriptionEpisode
+		Limit    int
+	}{
+		Episodes: episodes,
+		Limit:    smartFeedPreviewLimit,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "smart_feed_preview.html", templateData)
+	if err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -2,27 +2,28 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
 	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/internal/youtube"
+	"yt-podcaster/internal/ytdlp"
 	"yt-podcaster/pkg/tasks"
 
 	"github.com/gorilla/mux"
 )
 
-// execCommandContext can be mocked in tests
-var execCommandContext = exec.CommandContext
-
 func getMaxSubscriptionsPerUser() int {
 	maxSubs := 100 // default as suggested in review
 	if env := os.Getenv("MAX_SUBSCRIPTIONS_PER_USER"); env != "" {
@@ -43,163 +44,118 @@ func getChannelInfoTimeout() time.Duration {
 	return timeout
 }
 
-// validateYouTubeURL validates that the URL is a proper YouTube channel URL
-// to prevent SSRF attacks by ensuring only YouTube domains are accessed
-func validateYouTubeURL(url string) bool {
-	// Regular expressions for valid YouTube channel and user URLs
-	patterns := []string{
-		`^https://(?:www\.)?youtube\.com/channel/[a-zA-Z0-9_-]+(?:/.*)?$`,
-		`^https://(?:www\.)?youtube\.com/@[a-zA-Z0-9_.-]+(?:/.*)?$`,
-		`^https://(?:www\.)?youtube\.com/user/[a-zA-Z0-9_.-]+(?:/.*)?$`,
-		`^https://(?:www\.)?youtube\.com/c/[a-zA-Z0-9_.-]+(?:/.*)?$`,
-	}
-
-	for _, pattern := range patterns {
-		if matched, _ := regexp.MatchString(pattern, url); matched {
-			return true
-		}
-	}
+var (
+	errSourceInfo        = errors.New("could not extract valid channel info")
+	errAlreadySubscribed = errors.New("already subscribed")
+)
 
-	return false
+// ytDlpSourceInfo is the subset of yt-dlp's playlist JSON used to name non-YouTube sources
+type ytDlpSourceInfo struct {
+	Title    string `json:"title"`
+	Uploader string `json:"uploader"`
+	Channel  string `json:"channel"`
 }
 
-// extractChannelInfo extracts channel ID and title from YouTube channel URL using web scraping
-func extractChannelInfo(ctx context.Context, channelURL string) (channelID, channelTitle string, err error) {
-	// Create HTTP client with timeout and redirect handling
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 10 redirects
-			if len(via) >= 10 {
-				return fmt.Errorf("too many redirects")
-			}
-			return nil
-		},
-	}
-
-	// Try different URL formats to bypass consent pages
-	urlsToTry := []string{
-		channelURL,
-		channelURL + "?hl=en&gl=US", // Force English locale and US region
-	}
-
-	var html string
-	for _, url := range urlsToTry {
-		// Create request with context
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			continue
-		}
+// extractSourceInfo asks yt-dlp for the title of a non-YouTube source listing.
+// It also proves the source exists before a subscription is stored.
+func extractSourceInfo(ctx context.Context, listURL string) (string, error) {
+	output, err := ytdlp.DumpSingleJSON(ctx, listURL, "--playlist-items", "0")
+	if err != nil {
+		return "", err
+	}
 
-		// Add realistic headers to avoid bot detection
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-		req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-		req.Header.Set("Accept-Encoding", "identity") // Don't use compression to avoid issues
-		req.Header.Set("Connection", "keep-alive")
-		req.Header.Set("Cache-Control", "no-cache")
-		req.Header.Set("Pragma", "no-cache")
-
-		// Make the request
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("HTTP request failed for %s: %v", url, err)
-			continue
-		}
-		defer resp.Body.Close()
+	var info ytDlpSourceInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return "", fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
 
-		if resp.StatusCode != 200 {
-			log.Printf("HTTP %d for URL: %s", resp.StatusCode, url)
-			continue
+	for _, title := range []string{info.Channel, info.Uploader, info.Title} {
+		if title = strings.TrimSpace(title); title != "" && title != "NA" {
+			return title, nil
 		}
+	}
+	return "", fmt.Errorf("yt-dlp returned no title for %s", listURL)
+}
 
-		// Read response body
-		body, err := io.ReadAll(resp.Body)
+// addSubscriptionFromURL resolves a validated channel or playlist URL and
+// stores the subscription for the user
+func (h *Handlers) addSubscriptionFromURL(ctx context.Context, userID int64, provider source.Provider, sourceURL string) (*models.Subscription, error) {
+	var sub *models.Subscription
+
+	if provider.Name() != source.ProviderYouTube {
+		sourceID := provider.SourceID(sourceURL)
+		log.Printf("Extracting %s source info for: %s", provider.Name(), sourceID)
+		title, err := extractSourceInfo(ctx, provider.ListURL(&models.Subscription{YoutubeChannelID: sourceID}))
 		if err != nil {
-			log.Printf("Failed to read response body: %v", err)
-			continue
+			log.Printf("Error extracting source info from URL '%s': %v", sourceURL, err)
+			return nil, fmt.Errorf("%w: %v", errSourceInfo, err)
 		}
+		sub, err = db.AddProviderSubscription(userID, provider.Name(), sourceID, title)
+		return finishAddSubscription(sub, err)
+	}
 
-		html = string(body)
+	// Resolve the typed reference, whatever shape of YouTube link the user pasted
+	ref, err := youtube.Parse(sourceURL)
+	if err != nil || !ref.IsSource() {
+		return nil, fmt.Errorf("%w: %q is not a YouTube channel or playlist", errSourceInfo, sourceURL)
+	}
 
-		// Check if we got actual YouTube content (not a consent page)
-		if strings.Contains(html, "youtube.com") && !strings.Contains(html, "consent.youtube.com") {
-			break
-		}
+	log.Printf("Resolving %s", ref)
+	info, err := h.channelResolver.Resolve(ctx, ref)
+	if err != nil {
+		log.Printf("Error resolving URL '%s': %v", sourceURL, err)
+		return nil, fmt.Errorf("%w: %v", errSourceInfo, err)
+	}
+	log.Printf("Resolved %s - Channel ID: %s, Title: %s", ref, info.ChannelID, info.Title)
 
-		log.Printf("Got consent page or invalid response for %s, trying next URL", url)
-	}
-
-	if html == "" {
-		return "", "", fmt.Errorf("could not fetch valid YouTube page content")
-	}
-
-	// Log HTML snippet for debugging (first 500 chars)
-	htmlSnippet := html
-	if len(htmlSnippet) > 500 {
-		htmlSnippet = htmlSnippet[:500] + "..."
-	}
-	log.Printf("HTML snippet for debugging: %s", htmlSnippet)
-
-	// Extract channel ID from various possible patterns
-	channelIDPatterns := []string{
-		`"channelId":"([^"]+)"`,
-		`"browse_id":"([^"]+)"`,
-		`<link rel="canonical" href="https://www\.youtube\.com/channel/([^"]+)">`,
-		`<link rel="canonical" href="https://www\.youtube\.com/channel/([^"?]+)`,
-		`channel/([A-Za-z0-9_-]{24})`, // YouTube channel IDs are exactly 24 characters
-		`"externalId":"([^"]+)"`,
-		`data-channel-external-id="([^"]+)"`,
-	}
-
-	log.Printf("Searching for channel ID...")
-	for i, pattern := range channelIDPatterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(html)
-		log.Printf("Pattern %d (%s): matches=%v", i+1, pattern, len(matches) > 1)
-		if len(matches) > 1 {
-			candidate := matches[1]
-			log.Printf("Found candidate channel ID: %s", candidate)
-			// Check if it looks like a valid YouTube channel ID (starts with UC and is 24 chars)
-			if strings.HasPrefix(candidate, "UC") && len(candidate) == 24 {
-				channelID = candidate
-				log.Printf("Valid channel ID found: %s", channelID)
-				break
-			}
+	if ref.Kind == youtube.KindPlaylist {
+		// Some playlists (e.g. mixes) don't expose an owner, so key them by the playlist itself
+		channelID := info.ChannelID
+		if channelID == "" {
+			channelID = ref.ID
 		}
+		sub, err = db.AddPlaylistSubscription(userID, channelID, ref.ID, info.Title)
+	} else {
+		sub, err = db.AddSubscription(userID, info.ChannelID, info.Title)
 	}
 
-	// Extract channel title
-	titlePatterns := []string{
-		`<title>([^-\|]+) - YouTube</title>`,
-		`<title>([^-\|]+)\s*-\s*YouTube</title>`,
-		`"title":"([^"]+)"`,
-		`<meta property="og:title" content="([^"]+)"`,
-		`<meta name="title" content="([^"]+)"`,
-	}
-
-	log.Printf("Searching for channel title...")
-	for i, pattern := range titlePatterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindStringSubmatch(html)
-		log.Printf("Title pattern %d: matches=%v", i+1, len(matches) > 1)
-		if len(matches) > 1 {
-			candidate := strings.TrimSpace(matches[1])
-			if candidate != "" && candidate != "YouTube" {
-				channelTitle = candidate
-				log.Printf("Channel title found: %s", channelTitle)
-				break
-			}
-		}
+	return finishAddSubscription(sub, err)
+}
+
+// enqueueNewSubscriptionTasks checks a new subscription for videos and fetches its channel's metadata
+func (h *Handlers) enqueueNewSubscriptionTasks(sub *models.Subscription) {
+	// Use default options for channel checking (less aggressive than video processing)
+	task, err := tasks.NewCheckChannelTask(sub.ID)
+	if err != nil {
+		log.Printf("Error creating task: %v", err)
+	} else if _, err = h.asynqClient.Enqueue(task); err != nil {
+		log.Printf("Error enqueuing task: %v", err)
 	}
 
-	log.Printf("Final extraction results - ID: '%s', Title: '%s'", channelID, channelTitle)
+	if sub.SourceType != db.SourceTypeChannel {
+		return
+	}
+	task, err = tasks.NewRefreshChannelTask(sub.Provider, sub.YoutubeChannelID)
+	if err != nil {
+		log.Printf("Error creating refresh channel task: %v", err)
+	} else if _, err = h.asynqClient.Enqueue(task); err != nil {
+		log.Printf("Error enqueuing refresh channel task: %v", err)
+	}
+}
 
-	if channelID == "" || channelTitle == "" {
-		return "", "", fmt.Errorf("could not extract channel info from HTML (ID found: %v, Title found: %v)", channelID != "", channelTitle != "")
+// finishAddSubscription translates duplicate subscription errors from the database
+func finishAddSubscription(sub *models.Subscription, err error) (*models.Subscription, error) {
+	if err != nil {
+		log.Printf("Error creating subscription: %v", err)
+		// Handle potential duplicate subscription error gracefully
+		if strings.Contains(err.Error(), "subscriptions_user_id_source_key") {
+			return nil, errAlreadySubscribed
+		}
+		return nil, err
 	}
 
-	return channelID, channelTitle, nil
+	feedcache.InvalidateUser(context.Background(), sub.UserID)
+	return sub, nil
 }
 
 func (h *Handlers) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
@@ -212,19 +168,19 @@ func (h *Handlers) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get BASE_URL from environment
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080" // fallback for development
-	}
+	baseURL := getBaseURL()
 
 	// Create template data with subscriptions and base URL for individual RSS feeds
 	templateData := struct {
-		Subscriptions []models.Subscription
-		BaseURL       string
+		Subscriptions   []models.Subscription
+		BaseURL         string
+		CombinedFeedURL string
+		CombinedRSSUUID string
 	}{
-		Subscriptions: subscriptions,
-		BaseURL:       baseURL,
+		Subscriptions:   subscriptions,
+		BaseURL:         baseURL,
+		CombinedFeedURL: fmt.Sprintf("%s/rss/%s", baseURL, user.CombinedRSSUUID),
+		CombinedRSSUUID: user.CombinedRSSUUID,
 	}
 
 	err = h.templates.ExecuteTemplate(w, "subscriptions.html", templateData)
@@ -268,8 +224,13 @@ func (h *Handlers) PostSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate URL to prevent SSRF attacks
-	if !validateYouTubeURL(channelURL) {
+	// Validate URL against the allowlisted providers to prevent SSRF attacks
+	provider, err := source.MatchSource(channelURL)
+	if err != nil {
+		if errors.Is(err, source.ErrProviderNotAllowed) {
+			http.Error(w, "Subscriptions from this site are not enabled on this server", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Invalid YouTube URL format", http.StatusBadRequest)
 		return
 	}
@@ -278,45 +239,20 @@ func (h *Handlers) PostSubscription(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), getChannelInfoTimeout())
 	defer cancel()
 
-	log.Printf("Extracting channel info from URL: %s", channelURL)
-	channelID, channelTitle, err := extractChannelInfo(ctx, channelURL)
+	sub, err := h.addSubscriptionFromURL(ctx, user.ID, provider, channelURL)
 	if err != nil {
-		log.Printf("Error extracting channel info from URL '%s': %v", channelURL, err)
-		http.Error(w, "Could not extract channel info from URL", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Extracted channel info - ID: %s, Title: %s", channelID, channelTitle)
-
-	if channelID == "" || channelTitle == "" || channelTitle == "NA" {
-		log.Printf("Could not extract valid channel info from yt-dlp for URL '%s': ID='%s', Title='%s'", channelURL, channelID, channelTitle)
-		http.Error(w, "Could not extract valid channel info from URL", http.StatusBadRequest)
-		return
-	}
-
-	sub, err := db.AddSubscription(user.ID, channelID, channelTitle)
-	if err != nil {
-		log.Printf("Error creating subscription: %v", err)
-		// Handle potential duplicate subscription error gracefully
-		if strings.Contains(err.Error(), "subscriptions_user_id_youtube_channel_id_key") {
+		switch {
+		case errors.Is(err, errSourceInfo):
+			http.Error(w, "Could not extract channel info from URL", http.StatusBadRequest)
+		case errors.Is(err, errAlreadySubscribed):
 			http.Error(w, "You are already subscribed to this channel.", http.StatusConflict)
-			return
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Enqueue a task to check the channel for new videos
-	task, err := tasks.NewCheckChannelTask(sub.ID)
-	if err != nil {
-		log.Printf("Error creating task: %v", err)
-	} else {
-		// Use default options for channel checking (less aggressive than video processing)
-		_, err = h.asynqClient.Enqueue(task)
-		if err != nil {
-			log.Printf("Error enqueuing task: %v", err)
-		}
-	}
+	h.enqueueNewSubscriptionTasks(sub)
 
 	h.GetSubscriptions(w, r)
 }
@@ -344,6 +280,123 @@ func (h *Handlers) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
 	log.Printf("DeleteSubscription: Successfully deleted subscription %d", subscriptionID)
 	w.WriteHeader(http.StatusOK)
 }
+
+// PostSubscriptionCombined includes a subscription in the combined feed or leaves it out
+func (h *Handlers) PostSubscriptionCombined(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	include, err := strconv.ParseBool(r.FormValue("include"))
+	if err != nil {
+		http.Error(w, "include must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	err = db.SetSubscriptionInCombinedFeed(user.ID, subscriptionID, include)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating combined feed membership of subscription %d: %v", subscriptionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	feedcache.InvalidateUser(r.Context(), user.ID)
+
+	h.GetSubscriptions(w, r)
+}
+
+// PostSubscriptionOnDemand switches a subscription to fetching the audio of
+// new videos only when a podcast app first requests it, or back. Videos
+// already listed keep the mode they were listed in.
+func (h *Handlers) PostSubscriptionOnDemand(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	onDemand, err := strconv.ParseBool(r.FormValue("on_demand"))
+	if err != nil {
+		http.Error(w, "on_demand must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	err = db.SetSubscriptionOnDemand(user.ID, subscriptionID, onDemand)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating on-demand mode of subscription %d: %v", subscriptionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetSubscriptions(w, r)
+}
+
+// maxRotationGraceDays caps how long a rotated-out feed URL keeps working
+const maxRotationGraceDays = 30
+
+// defaultRotationGraceDays gives podcast apps a week to follow a rotated feed URL
+const defaultRotationGraceDays = 7
+
+// rotateFeedURL gives a subscription a new feed URL; the old one keeps working
+// for graceDays and stops at once when graceDays is 0
+func rotateFeedURL(ctx context.Context, userID int64, subscriptionID int, graceDays int) (string, error) {
+	rssUUID, err := db.RotateSubscriptionRSSUUID(userID, subscriptionID, time.Duration(graceDays)*24*time.Hour)
+	if err != nil {
+		return "", err
+	}
+	feedcache.InvalidateUser(ctx, userID)
+	return rssUUID, nil
+}
+
+// PostSubscriptionRotate replaces a leaked or unwanted feed URL of a subscription.
+func (h *Handlers) PostSubscriptionRotate(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(models.UserContextKey).(*models.User)
+
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+	graceDays, err := strconv.Atoi(r.FormValue("grace_days"))
+	if err != nil || graceDays < 0 || graceDays > maxRotationGraceDays {
+		http.Error(w, fmt.Sprintf("grace_days must be between 0 and %d", maxRotationGraceDays), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := rotateFeedURL(r.Context(), user.ID, subscriptionID, graceDays); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.GetSubscriptions(w, r)
+}
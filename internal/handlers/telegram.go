@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"os"
-	"regexp"
 	"strings"
+	"time"
 
 	"yt-podcaster/internal/db"
-	"yt-podcaster/pkg/tasks"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/internal/youtube"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -30,7 +35,16 @@ func (h *Handlers) StartTelegramBot() {
 	updates := bot.GetUpdatesChan(u)
 
 	for update := range updates {
-		if update.Message == nil { // ignore any non-Message updates
+		if update.CallbackQuery != nil {
+			if strings.HasPrefix(update.CallbackQuery.Data, callbackRotatePrefix) {
+				h.handleRotateCallback(bot, update.CallbackQuery)
+			} else {
+				h.handleSubscriptionCallback(bot, update.CallbackQuery)
+			}
+			continue
+		}
+
+		if update.Message == nil { // ignore any other non-Message updates
 			continue
 		}
 
@@ -43,6 +57,8 @@ func (h *Handlers) StartTelegramBot() {
 		switch update.Message.Command() {
 		case "list":
 			h.handleListCommand(bot, update.Message)
+		case "rotate":
+			h.handleRotateCommand(bot, update.Message)
 		default:
 			msg := tgbotapi.NewMessage(update.Message.Chat.ID, "I don't know that command")
 			bot.Send(msg)
@@ -50,28 +66,21 @@ func (h *Handlers) StartTelegramBot() {
 	}
 }
 
-// processChannelInput processes user input and converts it to a valid YouTube channel URL
+// processChannelInput processes user input and converts it to a valid channel URL
 // Supports:
-// - Full YouTube URLs (https://youtube.com/@channel, https://youtube.com/channel/UCxxxxx, etc.)
-// - @channel_name format (converts to https://youtube.com/@channel_name)
+// - Any YouTube channel, handle, user, custom or playlist link, normalized to its canonical URL
+// - @channel_name format (converts to https://www.youtube.com/@channel_name)
+// - Channel URLs of other allowed providers (https://vimeo.com/user, https://soundcloud.com/artist, etc.)
 func (h *Handlers) processChannelInput(input string) string {
 	input = strings.TrimSpace(input)
 
-	// If it's already a valid YouTube URL, return it
-	if validateYouTubeURL(input) {
-		return input
+	if ref, err := youtube.Parse(input); err == nil && ref.IsSource() {
+		return ref.Canonical()
 	}
 
-	// Check if it's @channel_name format
-	if strings.HasPrefix(input, "@") {
-		channelName := strings.TrimPrefix(input, "@")
-
-		// Validate channel name (alphanumeric, underscore, hyphen, dot)
-		channelNameRegex := regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
-		if channelNameRegex.MatchString(channelName) && len(channelName) > 0 {
-			// Convert to YouTube URL
-			return fmt.Sprintf("https://www.youtube.com/@%s", channelName)
-		}
+	// If it's a valid URL of another allowed provider, return it
+	if _, err := source.MatchSource(input); err == nil {
+		return input
 	}
 
 	// Return empty string if input doesn't match any supported format
@@ -89,56 +98,265 @@ func (h *Handlers) handleTelegramMessage(bot *tgbotapi.BotAPI, message *tgbotapi
 		return
 	}
 
+	// Single videos go to the user's listen later feed instead of creating a subscription
+	if provider, videoID, err := source.MatchVideo(strings.TrimSpace(message.Text)); err == nil {
+		h.handleInboxVideo(bot, message, user, provider, videoID)
+		return
+	}
+
 	channelURL := h.processChannelInput(message.Text)
-	if channelURL == "" {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Please provide a valid YouTube channel URL or @channel_name format.\n\nExamples:\n• https://youtube.com/@channelname\n• @channelname\n• https://youtube.com/channel/UCxxxxx")
+	if channelURL == "" && looksLikeSearch(message.Text) {
+		h.handleChannelSearch(bot, message)
+		return
+	}
+
+	provider, err := source.MatchSource(channelURL)
+	if channelURL == "" || err != nil {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Please provide a valid YouTube channel URL, playlist URL or @channel_name format.\n\nExamples:\n• https://youtube.com/@channelname\n• @channelname\n• https://youtube.com/channel/UCxxxxx\n• https://youtube.com/playlist?list=PLxxxxx\n\nSupported sites: %s", strings.Join(source.AllowedDisplayNames(), ", ")))
 		bot.Send(msg)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), getChannelInfoTimeout())
+	ctx, cancel := context.WithTimeout(context.Background(), getPreviewTimeout())
 	defer cancel()
 
-	log.Printf("Extracting channel info from URL: %s", channelURL)
-	channelID, channelTitle, err := extractChannelInfo(ctx, channelURL)
+	preview, err := h.buildSubscriptionPreview(ctx, provider, channelURL)
 	if err != nil {
-		log.Printf("Error extracting channel info from URL '%s': %v", channelURL, err)
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Could not extract channel info from URL")
+		log.Printf("Error building preview for URL '%s': %v", channelURL, err)
+		reply := "Internal server error"
+		if errors.Is(err, errSourceInfo) {
+			reply = "Could not extract channel info from URL"
+		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, reply)
 		bot.Send(msg)
 		return
 	}
 
-	if channelID == "" || channelTitle == "" || channelTitle == "NA" {
-		log.Printf("Could not extract valid channel info for URL '%s': ID='%s', Title='%s'", channelURL, channelID, channelTitle)
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Could not extract valid channel info from URL")
-		bot.Send(msg)
+	// Nothing is stored until the user confirms with the inline keyboard
+	msg := tgbotapi.NewMessage(message.Chat.ID, formatTelegramPreview(preview))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Subscribe", callbackSubscribe),
+			tgbotapi.NewInlineKeyboardButtonData("Cancel", callbackCancel),
+		),
+	)
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending preview: %v", err)
 		return
 	}
+	h.storePendingSubscription(pendingSubscriptionKey{sent.Chat.ID, sent.MessageID}, preview.URL)
+}
+
+const (
+	callbackSubscribe = "subscribe"
+	callbackCancel    = "cancel"
+	// callbackChannelPrefix precedes the channel ID of a search result button
+	callbackChannelPrefix = "channel:"
+	// callbackRotatePrefix precedes the subscription ID and grace days of a feed URL rotation button
+	callbackRotatePrefix = "rotate:"
+)
+
+// looksLikeSearch reports whether free text is a channel name rather than a mistyped link or handle
+func looksLikeSearch(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && !strings.HasPrefix(text, "@") && !strings.Contains(text, "/")
+}
 
-	sub, err := db.AddSubscription(user.ID, channelID, channelTitle)
+// handleChannelSearch replies with matching channels as an inline keyboard; one tap subscribes
+func (h *Handlers) handleChannelSearch(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), getPreviewTimeout())
+	defer cancel()
+
+	results, err := searchChannels(ctx, message.Text)
 	if err != nil {
-		log.Printf("Error creating subscription: %v", err)
-		if strings.Contains(err.Error(), "subscriptions_user_id_youtube_channel_id_key") {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "You are already subscribed to this channel.")
-			bot.Send(msg)
+		log.Printf("Error searching channels for %q: %v", message.Text, err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Search failed, please try again later."))
+		return
+	}
+	if len(results) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "No channels found. Try another name, or send a channel link or @handle."))
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, result := range results {
+		label := result.Title
+		if result.Subscribers != "" {
+			label += " · " + result.Subscribers
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, callbackChannelPrefix+result.ID),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Tap a channel to subscribe:")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	bot.Send(msg)
+}
+
+// pendingSubscriptionKey identifies a preview message awaiting confirmation
+type pendingSubscriptionKey struct {
+	chatID    int64
+	messageID int
+}
+
+// pendingSubscriptionTTL is how long a preview's Subscribe button keeps working
+const pendingSubscriptionTTL = time.Hour
+
+// pendingSubscription is the URL a preview subscribes to and when it was sent
+type pendingSubscription struct {
+	url    string
+	sentAt time.Time
+}
+
+// storePendingSubscription remembers a preview until it is answered, dropping
+// previews nobody answered in time so ignored ones don't pile up
+func (h *Handlers) storePendingSubscription(key pendingSubscriptionKey, url string) {
+	now := time.Now()
+	h.pendingSubscriptions.Range(func(k, v any) bool {
+		if now.Sub(v.(pendingSubscription).sentAt) > pendingSubscriptionTTL {
+			h.pendingSubscriptions.Delete(k)
+		}
+		return true
+	})
+	h.pendingSubscriptions.Store(key, pendingSubscription{url: url, sentAt: now})
+}
+
+// formatTelegramPreview renders a subscription preview as a Telegram HTML message
+func formatTelegramPreview(preview *subscriptionPreview) string {
+	var b strings.Builder
+	kind := "channel"
+	if preview.IsPlaylist {
+		kind = "playlist"
+	}
+	fmt.Fprintf(&b, "<b>%s</b>\n%s %s\n", html.EscapeString(preview.Title), preview.ProviderName, kind)
+	if preview.AvatarURL != "" {
+		fmt.Fprintf(&b, "<a href=\"%s\">Avatar</a>\n", html.EscapeString(preview.AvatarURL))
+	}
+
+	if preview.WeeklyAudio != "" {
+		fmt.Fprintf(&b, "\nEstimated audio: about %s per week\n", preview.WeeklyAudio)
+	} else if preview.TotalAudio != "" {
+		fmt.Fprintf(&b, "\nRecent uploads add up to %s of audio\n", preview.TotalAudio)
+	}
+
+	if len(preview.Uploads) > 0 {
+		b.WriteString("\nRecent uploads:\n")
+	}
+	for _, upload := range preview.Uploads {
+		mark := "✅"
+		if !upload.Included {
+			mark = "⏭️"
+		}
+		details := []string{}
+		if upload.Duration != "" {
+			details = append(details, upload.Duration)
+		}
+		if upload.Published != "" {
+			details = append(details, upload.Published)
+		}
+		if !upload.Included {
+			details = append(details, "skipped: "+upload.Reason)
+		} else if upload.Reason != "" {
+			details = append(details, upload.Reason)
+		}
+		fmt.Fprintf(&b, "%s %s", mark, html.EscapeString(upload.Title))
+		if len(details) > 0 {
+			fmt.Fprintf(&b, " <i>(%s)</i>", strings.Join(details, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nSubscribe to this " + kind + "?")
+	return b.String()
+}
+
+// handleSubscriptionCallback subscribes or cancels when a preview's or search's inline keyboard is used
+func (h *Handlers) handleSubscriptionCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
+	// Stop the button's loading spinner
+	if _, err := bot.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+	if callback.Message == nil {
+		return
+	}
+
+	chatID := callback.Message.Chat.ID
+	reply := func(text string) {
+		bot.Send(tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, text))
+	}
+
+	var channelURL string
+	if channelID, ok := strings.CutPrefix(callback.Data, callbackChannelPrefix); ok {
+		// Search results carry the channel ID, which must still parse as one
+		ref, err := youtube.Parse(channelID)
+		if err != nil || ref.Kind != youtube.KindChannel {
+			reply("Could not extract channel info from URL")
 			return
 		}
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Internal server error")
-		bot.Send(msg)
+		channelURL = ref.Canonical()
+	} else {
+		value, ok := h.pendingSubscriptions.LoadAndDelete(pendingSubscriptionKey{chatID, callback.Message.MessageID})
+		if !ok || time.Since(value.(pendingSubscription).sentAt) > pendingSubscriptionTTL {
+			reply("This preview has expired. Please send the link again.")
+			return
+		}
+		if callback.Data != callbackSubscribe {
+			reply("Subscription cancelled.")
+			return
+		}
+		channelURL = value.(pendingSubscription).url
+	}
+
+	user, err := db.FindOrCreateUserByTelegramID(callback.From.ID, callback.From.UserName)
+	if err != nil {
+		log.Printf("Error finding or creating user: %v", err)
+		reply("Error creating user.")
 		return
 	}
 
-	task, err := tasks.NewCheckChannelTask(sub.ID)
+	provider, err := source.MatchSource(channelURL)
 	if err != nil {
-		log.Printf("Error creating task: %v", err)
-	} else {
-		_, err = h.asynqClient.Enqueue(task)
-		if err != nil {
-			log.Printf("Error enqueuing task: %v", err)
+		reply("Please provide a valid YouTube channel URL, playlist URL or @channel_name format.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), getChannelInfoTimeout())
+	defer cancel()
+
+	sub, err := h.addSubscriptionFromURL(ctx, user.ID, provider, channelURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSourceInfo):
+			reply("Could not extract channel info from URL")
+		case errors.Is(err, errAlreadySubscribed):
+			reply("You are already subscribed to this channel.")
+		default:
+			reply("Internal server error")
 		}
+		return
 	}
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, "Subscription added successfully!")
+	h.enqueueNewSubscriptionTasks(sub)
+
+	reply(fmt.Sprintf("Subscribed to %s!", sub.YoutubeChannelTitle))
+}
+
+func (h *Handlers) handleInboxVideo(bot *tgbotapi.BotAPI, message *tgbotapi.Message, user *models.User, provider source.Provider, videoID string) {
+	_, err := h.addVideoToInbox(user.ID, provider, videoID)
+	if err != nil {
+		reply := "Internal server error"
+		if errors.Is(err, errAlreadyInInbox) {
+			reply = "This video is already in your Listen Later feed."
+		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, reply)
+		bot.Send(msg)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Added to your Listen Later feed: %s", getInboxFeedURL(user)))
 	bot.Send(msg)
 }
 
@@ -162,22 +380,103 @@ func (h *Handlers) handleListCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Mes
 	}
 
 	if len(subscriptions) == 0 {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "You have no subscriptions.")
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("You have no subscriptions.\n\nListen Later: %s", getInboxFeedURL(user)))
 		bot.Send(msg)
 		return
 	}
 
 	var response string
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080"
-	}
+	baseURL := getBaseURL()
 
 	for _, sub := range subscriptions {
 		response += fmt.Sprintf("<b>%s</b>: %s/rss/%s\n", sub.YoutubeChannelTitle, baseURL, sub.RSSUUID)
 	}
+	response += fmt.Sprintf("\n<b>Listen Later</b>: %s\n", getInboxFeedURL(user))
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, response)
 	msg.ParseMode = "HTML"
 	bot.Send(msg)
 }
+
+// handleRotateCommand lists the user's subscriptions with buttons that give
+// their feeds new URLs, either after a grace period or at once
+func (h *Handlers) handleRotateCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	user, err := db.FindOrCreateUserByTelegramID(message.From.ID, message.From.UserName)
+	if err != nil {
+		log.Printf("Error finding or creating user: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Error creating user."))
+		return
+	}
+
+	subscriptions, err := db.GetSubscriptionsByUserID(user.ID)
+	if err != nil {
+		log.Printf("Error getting subscriptions: %v", err)
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "Internal server error"))
+		return
+	}
+	if len(subscriptions) == 0 {
+		bot.Send(tgbotapi.NewMessage(message.Chat.ID, "You have no subscriptions."))
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, sub := range subscriptions {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 "+sub.YoutubeChannelTitle, fmt.Sprintf("%s%d:%d", callbackRotatePrefix, sub.ID, defaultRotationGraceDays)),
+			tgbotapi.NewInlineKeyboardButtonData("⛔ Revoke now", fmt.Sprintf("%s%d:0", callbackRotatePrefix, sub.ID)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf(
+		"Pick a feed to give a new URL. With 🔄 the old URL keeps working for %d days and tells podcast apps where the feed moved; ⛔ stops it at once, which is what you want if the URL leaked.",
+		defaultRotationGraceDays,
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	bot.Send(msg)
+}
+
+// handleRotateCallback rotates the feed URL picked from the /rotate keyboard
+func (h *Handlers) handleRotateCallback(bot *tgbotapi.BotAPI, callback *tgbotapi.CallbackQuery) {
+	if _, err := bot.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+	if callback.Message == nil {
+		return
+	}
+	reply := func(text string) {
+		bot.Send(tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text))
+	}
+
+	var subscriptionID, graceDays int
+	data := strings.TrimPrefix(callback.Data, callbackRotatePrefix)
+	if _, err := fmt.Sscanf(data, "%d:%d", &subscriptionID, &graceDays); err != nil || graceDays < 0 || graceDays > maxRotationGraceDays {
+		reply("This button is no longer valid. Send /rotate again.")
+		return
+	}
+
+	user, err := db.FindOrCreateUserByTelegramID(callback.From.ID, callback.From.UserName)
+	if err != nil {
+		log.Printf("Error finding or creating user: %v", err)
+		reply("Error creating user.")
+		return
+	}
+
+	rssUUID, err := rotateFeedURL(context.Background(), user.ID, subscriptionID, graceDays)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			reply("Subscription not found.")
+			return
+		}
+		reply("Internal server error")
+		return
+	}
+
+	baseURL := getBaseURL()
+	text := fmt.Sprintf("New feed URL: %s/rss/%s\n\n", baseURL, rssUUID)
+	if graceDays > 0 {
+		text += fmt.Sprintf("The old URL keeps working for %d days and points podcast apps to the new one.", graceDays)
+	} else {
+		text += "The old URL no longer works. Add the new one to your podcast app."
+	}
+	reply(text)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedauth"
+
+	"github.com/google/uuid"
+)
+
+// FeedAuthMiddleware asks for the credentials of private feeds. feedUUID
+// returns the RSS UUID of the feed a request is for; requests for no known
+// feed pass through, so the handler answers them as it would for anyone.
+func FeedAuthMiddleware(feedUUID func(r *http.Request) (string, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rssUUID, err := feedUUID(r)
+			if err != nil {
+				log.Printf("FeedAuthMiddleware: Failed to find the feed of %s: %v", r.URL.Path, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if uuid.Validate(rssUUID) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			credentials, err := db.GetFeedCredentials(rssUUID)
+			if err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					log.Printf("FeedAuthMiddleware: Failed to get feed credentials: %v", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Shared caches must not hand a private feed to anyone else
+			w.Header().Set("Cache-Control", "private")
+			token, ok := feedauth.Authenticate(r, credentials)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Private feed", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if token != "" {
+				r = r.WithContext(feedauth.WithToken(r.Context(), token))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"yt-podcaster/internal/feedauth"
+	"yt-podcaster/internal/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedAuthMiddleware(t *testing.T) {
+	const feedUUID = "0b6f3f0e-8a43-4d5c-9c1f-2f5b8f6d9e01"
+	columns := []string{"rss_uuid", "user_id", "username", "password_hash", "created_at"}
+	feedHandler := func(t *testing.T, wantToken string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, wantToken, feedauth.Token(r.Context()))
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+	middleware := FeedAuthMiddleware(func(r *http.Request) (string, error) {
+		return strings.TrimPrefix(r.URL.Path, "/rss/"), nil
+	})
+
+	t.Run("public feed", func(t *testing.T) {
+		_, mock := test.NewMockDB(t)
+		mock.ExpectQuery(`SELECT (.+) FROM feed_credentials`).WithArgs(feedUUID).WillReturnError(sql.ErrNoRows)
+
+		rr := httptest.NewRecorder()
+		middleware(feedHandler(t, "")).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rss/"+feedUUID, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("Cache-Control"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not a feed UUID", func(t *testing.T) {
+		_, mock := test.NewMockDB(t)
+
+		rr := httptest.NewRecorder()
+		middleware(feedHandler(t, "")).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rss/unknown", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	for _, tc := range []struct {
+		name      string
+		url       string
+		basicAuth bool
+		wantCode  int
+		wantToken string
+	}{
+		{"private feed without credentials", "/rss/" + feedUUID, false, http.StatusUnauthorized, ""},
+		{"private feed with Basic auth", "/rss/" + feedUUID, true, http.StatusOK, ""},
+		{"private feed with token", "/rss/" + feedUUID + "?token=s3cret", false, http.StatusOK, "s3cret"},
+		{"private feed with wrong token", "/rss/" + feedUUID + "?token=guess", false, http.StatusUnauthorized, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, mock := test.NewMockDB(t)
+			rows := sqlmock.NewRows(columns).AddRow(feedUUID, 1, "podcast", feedauth.Hash("s3cret"), time.Now())
+			mock.ExpectQuery(`SELECT (.+) FROM feed_credentials`).WithArgs(feedUUID).WillReturnRows(rows)
+
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.basicAuth {
+				req.SetBasicAuth("podcast", "s3cret")
+			}
+			rr := httptest.NewRecorder()
+			middleware(feedHandler(t, tc.wantToken)).ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			assert.Equal(t, "private", rr.Header().Get("Cache-Control"))
+			if tc.wantCode == http.StatusUnauthorized {
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Basic")
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Kinds of fetch events
+const (
+	FetchKindFeed  = "feed"
+	FetchKindAudio = "audio"
+)
+
+// FetchEvent is one request for a feed or for audio in it, recorded for
+// analytics. IPHash changes daily, so listeners can't be followed across days.
+type FetchEvent struct {
+	Kind      string  `db:"kind"`
+	RSSUUID   string  `db:"rss_uuid"`
+	AudioUUID *string `db:"audio_uuid"`
+	IPHash    string  `db:"ip_hash"`
+	UserAgent string  `db:"user_agent"`
+	App       string  `db:"app"`
+	// ReportedSubscribers is the count aggregators like Overcast put in their user agent
+	ReportedSubscribers *int      `db:"reported_subscribers"`
+	RangeStart          *int64    `db:"range_start"`
+	RangeEnd            *int64    `db:"range_end"`
+	CreatedAt           time.Time `db:"created_at"`
+}
+
+// FeedAppStats are the downloads and subscribers of a feed in one podcast app.
+type FeedAppStats struct {
+	App         string `db:"app"`
+	Downloads   int    `db:"downloads"`
+	Subscribers int    `db:"subscribers"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Bundle is a user-named feed merging a chosen set of subscriptions.
+type Bundle struct {
+	ID        int       `db:"id"`
+	UserID    int64     `db:"user_id"`
+	Title     string    `db:"title"`
+	ImageURL  *string   `db:"image_url"`
+	RSSUUID   string    `db:"rss_uuid"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// SubscriptionIDs lists the active member subscriptions
+	SubscriptionIDs pq.Int64Array `db:"subscription_ids"`
+}
+
+// Includes reports whether a subscription is a member of the bundle.
+func (b Bundle) Includes(subscriptionID int) bool {
+	for _, id := range b.SubscriptionIDs {
+		if id == int64(subscriptionID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Channel holds the metadata of a channel that subscriptions point to.
+type Channel struct {
+	Provider         string     `db:"provider"`
+	YoutubeChannelID string     `db:"youtube_channel_id"`
+	Title            string     `db:"title"`
+	Handle           *string    `db:"handle"`
+	Description      *string    `db:"description"`
+	AvatarURL        *string    `db:"avatar_url"`
+	BannerURL        *string    `db:"banner_url"`
+	SubscriberCount  *int64     `db:"subscriber_count"`
+	Language         *string    `db:"language"`
+	Status           string     `db:"status"`
+	PreviousTitle    *string    `db:"previous_title"`
+	RefreshedAt      *time.Time `db:"refreshed_at"`
+	CreatedAt        time.Time  `db:"created_at"`
+}
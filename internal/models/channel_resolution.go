@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ChannelResolution is a cached resolution of a YouTube reference to a channel.
+type ChannelResolution struct {
+	RefKind          string    `db:"ref_kind"`
+	RefID            string    `db:"ref_id"`
+	YoutubeChannelID string    `db:"youtube_channel_id"`
+	Title            string    `db:"title"`
+	ResolvedAt       time.Time `db:"resolved_at"`
+}
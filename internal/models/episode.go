@@ -1,19 +1,49 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type Episode struct {
-	ID              int        `db:"id"`
-	SubscriptionID  int        `db:"subscription_id"`
-	YoutubeVideoID  string     `db:"youtube_video_id"`
-	Title           *string    `db:"title"`
-	Description     *string    `db:"description"`
-	PublishedAt     *time.Time `db:"published_at"`
-	AudioUUID       string     `db:"audio_uuid"`
-	AudioPath       *string    `db:"audio_path"`
-	AudioSizeBytes  *int64     `db:"audio_size_bytes"`
-	DurationSeconds *int       `db:"duration_seconds"`
-	Status          string     `db:"status"`
-	CreatedAt       time.Time  `db:"created_at"`
-	TaskID          *string    `db:"task_id"`
+	ID               int        `db:"id"`
+	SubscriptionID   *int       `db:"subscription_id"`
+	UserID           *int64     `db:"user_id"` // set for one-off inbox episodes
+	Provider         string     `db:"provider"`
+	YoutubeVideoID   string     `db:"youtube_video_id"` // provider's video ID for non-YouTube episodes
+	Title            *string    `db:"title"`
+	Description      *string    `db:"description"`
+	PublishedAt      *time.Time `db:"published_at"`
+	AudioUUID        string     `db:"audio_uuid"`
+	AudioPath        *string    `db:"audio_path"`
+	AudioSizeBytes   *int64     `db:"audio_size_bytes"`
+	DurationSeconds  *int       `db:"duration_seconds"`
+	Status           string     `db:"status"`
+	CreatedAt        time.Time  `db:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at"` // when the status last changed
+	TaskID           *string    `db:"task_id"`
+	PlaylistPosition *int       `db:"playlist_position"`
+	HLSReady         bool       `db:"hls_ready"`
+	// OnDemand episodes are listed in feeds before their audio is fetched
+	OnDemand bool `db:"on_demand"`
+}
+
+// SubscriptionEpisode is an episode together with the title of the subscription it came from.
+type SubscriptionEpisode struct {
+	Episode
+	SubscriptionTitle string `db:"subscription_title"`
+}
+
+// AudioAccess lists the RSS UUIDs of the feeds an episode's audio can currently
+// be served for: its subscription's current and retired-in-grace ones and the
+// combined, bundle and smart feeds merging it, or its owner's listen later
+// feed. It is empty once the subscription is removed.
+type AudioAccess struct {
+	EpisodeID      int    `db:"id"`
+	YoutubeVideoID string `db:"youtube_video_id"`
+	// Status is COMPLETED unless the audio of an on-demand episode is yet to be fetched
+	Status     string         `db:"status"`
+	AudioUUID  string         `db:"audio_uuid"`
+	FeedTokens pq.StringArray `db:"feed_tokens"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// FeedCredentials protect a private feed, and the audio in it, with a
+// username and password. The password is only stored hashed.
+type FeedCredentials struct {
+	RSSUUID      string    `db:"rss_uuid"`
+	UserID       int64     `db:"user_id"`
+	Username     string    `db:"username"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+}
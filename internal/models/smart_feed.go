@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"yt-podcaster/internal/smartfeed"
+)
+
+// SmartFeed is a user-named feed of the episodes matching a rule.
+type SmartFeed struct {
+	ID        int            `db:"id"`
+	UserID    int64          `db:"user_id"`
+	Title     string         `db:"title"`
+	Rule      smartfeed.Rule `db:"rule"`
+	RSSUUID   string         `db:"rss_uuid"`
+	CreatedAt time.Time      `db:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at"`
+}
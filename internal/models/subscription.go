@@ -1,14 +1,71 @@
 package models
 
-import "time"
+import (
+	"time"
 
-// Subscription represents a user's subscription to a YouTube channel.
+	"yt-podcaster/internal/rewrite"
+)
+
+// Subscription represents a user's subscription to a YouTube channel or playlist,
+// or to a source on another allowlisted provider.
 type Subscription struct {
-	ID                  int       `db:"id"`
-	UserID              int64     `db:"user_id"`
-	YoutubeChannelID    string    `db:"youtube_channel_id"`
-	YoutubeChannelTitle string    `db:"youtube_channel_title"`
-	RSSUUID             string    `db:"rss_uuid"`
-	Active              bool      `db:"active"`
-	CreatedAt           time.Time `db:"created_at"`
+	ID       int    `db:"id"`
+	UserID   int64  `db:"user_id"`
+	Provider string `db:"provider"`
+	// YoutubeChannelID holds the provider's source ID for non-YouTube subscriptions
+	YoutubeChannelID    string  `db:"youtube_channel_id"`
+	YoutubeChannelTitle string  `db:"youtube_channel_title"`
+	SourceType          string  `db:"source_type"`
+	YoutubePlaylistID   *string `db:"youtube_playlist_id"`
+	RSSUUID             string  `db:"rss_uuid"`
+	// OriginalRSSUUID is the RSS UUID before the first rotation, nil if never rotated
+	OriginalRSSUUID *string `db:"original_rss_uuid"`
+	Active          bool    `db:"active"`
+	InCombinedFeed  bool    `db:"in_combined_feed"`
+	// OnDemand subscriptions only list new videos, fetching their audio on first request
+	OnDemand  bool      `db:"on_demand"`
+	CreatedAt time.Time `db:"created_at"`
+	FeedSettings
+}
+
+// FirstRSSUUID is the RSS UUID the subscription's feed was first published at.
+// Its podcast:guid stays derived from it when the RSS UUID is rotated.
+func (s Subscription) FirstRSSUUID() string {
+	if s.OriginalRSSUUID != nil {
+		return *s.OriginalRSSUUID
+	}
+	return s.RSSUUID
+}
+
+// Feed types of itunes:type. Episodic feeds list newest first, serial ones oldest first.
+const (
+	FeedTypeEpisodic = "episodic"
+	FeedTypeSerial   = "serial"
+)
+
+// FeedSettings are a user's overrides of a subscription's feed metadata. Nil
+// fields keep what the channel or playlist provides.
+type FeedSettings struct {
+	Title       *string `db:"feed_title"`
+	Description *string `db:"feed_description"`
+	ImageURL    *string `db:"feed_image_url"`
+	Author      *string `db:"feed_author"`
+	Category    *string `db:"feed_category"`
+	Language    *string `db:"feed_language"`
+	Type        *string `db:"feed_type"`
+	Explicit    *bool   `db:"feed_explicit"`
+	// Rewrite cleans up episode titles and numbers episodes
+	Rewrite rewrite.Rules `db:"feed_rewrite"`
+}
+
+// FeedType is the itunes:type of the subscription's feed. Playlists are serial
+// unless overridden, since they are meant to be followed in order.
+func (s Subscription) FeedType() string {
+	if s.FeedSettings.Type != nil {
+		return *s.FeedSettings.Type
+	}
+	if s.SourceType == "playlist" {
+		return FeedTypeSerial
+	}
+	return FeedTypeEpisodic
 }
@@ -8,6 +8,7 @@ type User struct {
 	TelegramID       int64     `db:"telegram_id"`
 	TelegramUsername string    `db:"telegram_username"`
 	RSSUUID          string    `db:"rss_uuid"`
+	CombinedRSSUUID  string    `db:"combined_rss_uuid"`
 	CreatedAt        time.Time `db:"created_at"`
 	UpdatedAt        time.Time `db:"updated_at"`
 }
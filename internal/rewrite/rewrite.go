@@ -0,0 +1,181 @@
+// Package rewrite holds the rules that clean up a subscription's episode
+// titles before they reach its feed, such as dropping a channel name every
+// title starts with, and reads season and episode numbers from titles. Rules
+// are written one per line as "pattern => replacement" and stored as JSON.
+package rewrite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRules caps the number of title rules of a subscription.
+const MaxRules = 20
+
+// maxRuleLength caps patterns and replacements
+const maxRuleLength = 200
+
+// separator splits a rule into its pattern and replacement
+const separator = "=>"
+
+// Rule replaces every match of a regular expression in titles. Replacements
+// can refer to groups of the pattern as $1 or ${name}.
+type Rule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// Rules are the rewrite rules of a subscription's feed.
+type Rules struct {
+	Title []Rule `json:"title,omitempty"`
+	// NumberEpisodes reads season and episode numbers from titles
+	NumberEpisodes bool `json:"number_episodes,omitempty"`
+}
+
+// Parse reads title rules written one per line as "pattern => replacement". A
+// line without "=>" removes what its pattern matches. Spaces around the
+// pattern and replacement are ignored; match them with \s.
+func Parse(text string) ([]Rule, error) {
+	var rules []Rule
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		pattern, replacement, _ := strings.Cut(line, separator)
+		rules = append(rules, Rule{Pattern: strings.TrimSpace(pattern), Replacement: strings.TrimSpace(replacement)})
+	}
+	if err := validate(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate checks rules parsed from text or loaded from the database.
+func (r Rules) Validate() error {
+	return validate(r.Title)
+}
+
+func validate(rules []Rule) error {
+	if len(rules) > MaxRules {
+		return fmt.Errorf("at most %d title rules are allowed", MaxRules)
+	}
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			return errors.New("a title rule needs a pattern before =>")
+		}
+		if utf8.RuneCountInString(rule.Pattern) > maxRuleLength || utf8.RuneCountInString(rule.Replacement) > maxRuleLength {
+			return fmt.Errorf("patterns and replacements can have at most %d characters", maxRuleLength)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// String writes the title rules back in the syntax Parse reads, one per line.
+func (r Rules) String() string {
+	lines := make([]string, len(r.Title))
+	for i, rule := range r.Title {
+		lines[i] = rule.Pattern
+		if rule.Replacement != "" {
+			lines[i] += " " + separator + " " + rule.Replacement
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Result is a title after rewriting, with the numbers read from it. Numbers
+// are 0 when not found or not asked for.
+type Result struct {
+	Title   string
+	Season  int
+	Episode int
+}
+
+// Rewriter applies compiled rules to titles.
+type Rewriter struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+	numbers      bool
+}
+
+// Compile prepares the rules for rewriting many titles.
+func (r Rules) Compile() (*Rewriter, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	rewriter := &Rewriter{numbers: r.NumberEpisodes}
+	for _, rule := range r.Title {
+		rewriter.patterns = append(rewriter.patterns, regexp.MustCompile(rule.Pattern))
+		rewriter.replacements = append(rewriter.replacements, rule.Replacement)
+	}
+	return rewriter, nil
+}
+
+// Apply rewrites a title. Numbers are read from the original title, as rules
+// often remove the "#123" they come from. A title the rules empty is kept as is.
+func (w *Rewriter) Apply(title string) Result {
+	result := Result{Title: title}
+	if w.numbers {
+		result.Season, result.Episode = Numbers(title)
+	}
+	for i, pattern := range w.patterns {
+		result.Title = pattern.ReplaceAllString(result.Title, w.replacements[i])
+	}
+	// Replacements leave separators like " | " behind at the ends
+	result.Title = strings.TrimSpace(result.Title)
+	if result.Title == "" {
+		result.Title = title
+	}
+	return result
+}
+
+// numberPatterns find season and episode numbers, most specific first.
+// Patterns with one group only find the episode.
+var numberPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bS(\d{1,3})\s*E(\d{1,4})\b`),
+	regexp.MustCompile(`(?i)\bseason\s*(\d{1,3})\W+(?:episode|ep)\.?\s*(\d{1,4})\b`),
+	regexp.MustCompile(`(?i)(?:\bepisode|\bep\.?|#)\s*(\d{1,4})\b`),
+}
+
+// Numbers reads the season and episode numbers of a title such as "S2E5",
+// "Season 2, Episode 5", "Ep. 12" or "#123". Missing numbers are 0.
+func Numbers(title string) (season, episode int) {
+	for _, pattern := range numberPatterns {
+		match := pattern.FindStringSubmatch(title)
+		if match == nil {
+			continue
+		}
+		if len(match) == 3 {
+			season, _ = strconv.Atoi(match[1])
+		}
+		episode, _ = strconv.Atoi(match[len(match)-1])
+		return season, episode
+	}
+	return 0, 0
+}
+
+// Value stores the rules as JSON.
+func (r Rules) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan loads rules stored as JSON.
+func (r *Rules) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	default:
+		return fmt.Errorf("cannot scan %T into rewrite rules", src)
+	}
+}
@@ -0,0 +1,58 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse("^Veritasium:\\s*\n\n  \\| Full Episode #\\d+$ \n(?i)^(.+) - (interview)$ => $2: $1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Pattern: `^Veritasium:\s*`},
+		{Pattern: `\| Full Episode #\d+$`},
+		{Pattern: `(?i)^(.+) - (interview)$`, Replacement: "$2: $1"},
+	}, rules)
+	assert.Equal(t, "^Veritasium:\\s*\n\\| Full Episode #\\d+$\n(?i)^(.+) - (interview)$ => $2: $1", Rules{Title: rules}.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"=> nothing",
+		"(unclosed",
+		"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\np\nq\nr\ns\nt\nu",
+	} {
+		_, err := Parse(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules, err := Parse("^Lex Fridman Podcast:\\s*\n\\|\\s*Full Episode #\\d+$")
+	assert.NoError(t, err)
+	rewriter, err := Rules{Title: rules, NumberEpisodes: true}.Compile()
+	assert.NoError(t, err)
+
+	assert.Equal(t, Result{Title: "Physics of Time", Episode: 412}, rewriter.Apply("Lex Fridman Podcast: Physics of Time | Full Episode #412"))
+	// A rule removing everything leaves the title alone
+	everything, err := Rules{Title: []Rule{{Pattern: ".*"}}}.Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Title: "Untitled #3"}, everything.Apply("Untitled #3"))
+}
+
+func TestNumbers(t *testing.T) {
+	for title, want := range map[string][2]int{
+		"The Show S02E05 - Pilot":            {2, 5},
+		"Season 3, Episode 12: Finale":       {3, 12},
+		"Episode 7 - Getting Started":        {0, 7},
+		"Ep. 42 with a guest":                {0, 42},
+		"Weekly news #123":                   {0, 123},
+		"Top 10 physics mistakes":            {0, 0},
+		"Step 3: profit":                     {0, 0},
+		"Deep dive into episodes of history": {0, 0},
+	} {
+		season, episode := Numbers(title)
+		assert.Equal(t, want, [2]int{season, episode}, title)
+	}
+}
@@ -0,0 +1,210 @@
+// Package smartfeed holds the rules of smart feeds, which select a user's
+// episodes by query rather than by subscription. Rules are written one
+// condition per line, stored as JSON and compiled into an SQL condition over
+// episodes e joined with their subscriptions s.
+package smartfeed
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxConditions caps the size of a rule.
+const MaxConditions = 10
+
+// maxTextLength caps the text matched by title and channel conditions
+const maxTextLength = 100
+
+// Operators of conditions. Numeric fields take < and >, text fields take
+// ~ (contains, ignoring case) and !~ (does not contain).
+const (
+	OpLess        = "<"
+	OpGreater     = ">"
+	OpContains    = "~"
+	OpNotContains = "!~"
+)
+
+// field describes one condition field: the SQL it compiles from and its unit.
+type field struct {
+	numeric bool
+	// column is the compared expression; numeric values are scaled by factor first
+	column string
+	factor int
+	unit   string
+}
+
+// fields are the condition fields. Duration is in minutes and age in days.
+var fields = map[string]field{
+	"duration": {numeric: true, column: "e.duration_seconds", factor: 60, unit: "m"},
+	"age":      {numeric: true, unit: "d"},
+	"title":    {column: "COALESCE(e.title, '')"},
+	"channel":  {column: "COALESCE(s.youtube_channel_title, '')"},
+}
+
+// Condition is one test an episode must pass.
+type Condition struct {
+	Field  string `json:"field"`
+	Op     string `json:"op"`
+	Number int    `json:"number,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+// Rule matches episodes passing all of its conditions.
+type Rule struct {
+	Conditions []Condition `json:"conditions"`
+}
+
+// Parse reads a rule written one condition per line or separated by
+// semicolons, such as "duration < 20" or "title ~ interview".
+func Parse(text string) (Rule, error) {
+	var rule Rule
+	lines := strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ';' })
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		condition, err := parseCondition(line)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Conditions = append(rule.Conditions, condition)
+	}
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+func parseCondition(line string) (Condition, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 3 {
+		return Condition{}, fmt.Errorf("%q is not a condition like \"duration < 20\" or \"title ~ interview\"", line)
+	}
+
+	condition := Condition{Field: strings.ToLower(parts[0]), Op: parts[1]}
+	f, ok := fields[condition.Field]
+	if !ok {
+		return Condition{}, fmt.Errorf("unknown field %q, use duration, age, title or channel", parts[0])
+	}
+
+	// The value is the rest of the line, so text can contain spaces
+	value := strings.TrimSpace(strings.SplitN(line, condition.Op, 2)[1])
+	if f.numeric {
+		number, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(value), f.unit))
+		if err != nil {
+			return Condition{}, fmt.Errorf("%s needs a whole number, got %q", condition.Field, value)
+		}
+		condition.Number = number
+	} else {
+		condition.Text = value
+	}
+	return condition, nil
+}
+
+// Validate checks a rule parsed from text or loaded from the database.
+func (r Rule) Validate() error {
+	if len(r.Conditions) == 0 {
+		return errors.New("a rule needs at least one condition")
+	}
+	if len(r.Conditions) > MaxConditions {
+		return fmt.Errorf("a rule can have at most %d conditions", MaxConditions)
+	}
+	for _, c := range r.Conditions {
+		f, ok := fields[c.Field]
+		if !ok {
+			return fmt.Errorf("unknown field %q", c.Field)
+		}
+		if f.numeric {
+			if c.Op != OpLess && c.Op != OpGreater {
+				return fmt.Errorf("%s takes < or >", c.Field)
+			}
+			if c.Number < 0 {
+				return fmt.Errorf("%s can't be negative", c.Field)
+			}
+			continue
+		}
+		if c.Op != OpContains && c.Op != OpNotContains {
+			return fmt.Errorf("%s takes ~ or !~", c.Field)
+		}
+		if c.Text == "" || utf8.RuneCountInString(c.Text) > maxTextLength {
+			return fmt.Errorf("%s needs between 1 and %d characters of text", c.Field, maxTextLength)
+		}
+	}
+	return nil
+}
+
+// String writes the rule back in the syntax Parse reads, one condition per line.
+func (r Rule) String() string {
+	lines := make([]string, len(r.Conditions))
+	for i, c := range r.Conditions {
+		if fields[c.Field].numeric {
+			lines[i] = fmt.Sprintf("%s %s %d", c.Field, c.Op, c.Number)
+		} else {
+			lines[i] = fmt.Sprintf("%s %s %s", c.Field, c.Op, c.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compile returns the rule as an SQL condition with placeholders numbered from
+// firstArg, and the arguments to bind to them. Values are never written into
+// the SQL itself.
+func (r Rule) Compile(firstArg int) (string, []interface{}, error) {
+	if err := r.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	clauses := make([]string, len(r.Conditions))
+	args := make([]interface{}, len(r.Conditions))
+	for i, c := range r.Conditions {
+		placeholder := fmt.Sprintf("$%d", firstArg+i)
+		f := fields[c.Field]
+		switch {
+		case c.Field == "age" && c.Op == OpLess:
+			clauses[i] = "e.published_at >= NOW() - make_interval(days => " + placeholder + ")"
+			args[i] = c.Number
+		case c.Field == "age":
+			clauses[i] = "e.published_at < NOW() - make_interval(days => " + placeholder + ")"
+			args[i] = c.Number
+		case f.numeric:
+			clauses[i] = f.column + " " + c.Op + " " + placeholder
+			args[i] = c.Number * f.factor
+		case c.Op == OpContains:
+			clauses[i] = f.column + " ILIKE " + placeholder
+			args[i] = likePattern(c.Text)
+		default:
+			clauses[i] = f.column + " NOT ILIKE " + placeholder
+			args[i] = likePattern(c.Text)
+		}
+	}
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+// likePattern matches text anywhere, with LIKE wildcards in it taken literally
+func likePattern(text string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(text) + "%"
+}
+
+// Value stores the rule as JSON.
+func (r Rule) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan loads a rule stored as JSON.
+func (r *Rule) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	default:
+		return fmt.Errorf("cannot scan %T into a smart feed rule", src)
+	}
+}
@@ -0,0 +1,54 @@
+package smartfeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	rule, err := Parse("duration < 20m\nAGE < 3d; title ~ late night interview\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []Condition{
+		{Field: "duration", Op: OpLess, Number: 20},
+		{Field: "age", Op: OpLess, Number: 3},
+		{Field: "title", Op: OpContains, Text: "late night interview"},
+	}, rule.Conditions)
+	assert.Equal(t, "duration < 20\nage < 3\ntitle ~ late night interview", rule.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"duration",
+		"length < 20",
+		"duration ~ 20",
+		"duration < twenty",
+		"title < 20",
+		"channel !~ ",
+	} {
+		_, err := Parse(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	rule, err := Parse("duration > 5; age > 7; title ~ 100%_sure; channel !~ shorts")
+	assert.NoError(t, err)
+
+	sql, args, err := rule.Compile(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "e.duration_seconds > $3"+
+		" AND e.published_at < NOW() - make_interval(days => $4)"+
+		" AND COALESCE(e.title, '') ILIKE $5"+
+		" AND COALESCE(s.youtube_channel_title, '') NOT ILIKE $6", sql)
+	assert.Equal(t, []interface{}{300, 7, `%100\%\_sure%`, "%shorts%"}, args)
+}
+
+func TestCompileRejectsStoredGarbage(t *testing.T) {
+	var rule Rule
+	assert.NoError(t, rule.Scan([]byte(`{"conditions":[{"field":"e.id; DROP TABLE episodes","op":"<","number":1}]}`)))
+
+	_, _, err := rule.Compile(1)
+	assert.Error(t, err)
+}
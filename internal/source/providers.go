@@ -0,0 +1,138 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"yt-podcaster/internal/models"
+)
+
+// matchID returns the first capture group of the first matching pattern
+func matchID(patterns []*regexp.Regexp, rawURL string) string {
+	for _, pattern := range patterns {
+		if matches := pattern.FindStringSubmatch(rawURL); len(matches) > 1 {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// Vimeo users, channels and showcases; numeric paths are videos
+var (
+	vimeoSourcePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.)?vimeo\.com/((?:channels/|showcase/)?[a-zA-Z][a-zA-Z0-9_-]*)(?:/videos)?/?$`),
+	}
+	vimeoVideoPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.)?vimeo\.com/([0-9]+)(?:[/?#].*)?$`),
+		regexp.MustCompile(`^https://player\.vimeo\.com/video/([0-9]+)(?:[/?#].*)?$`),
+	}
+)
+
+type vimeoProvider struct{}
+
+func (vimeoProvider) Name() string        { return ProviderVimeo }
+func (vimeoProvider) DisplayName() string { return "Vimeo" }
+
+func (p vimeoProvider) MatchSource(rawURL string) bool { return p.SourceID(rawURL) != "" }
+func (vimeoProvider) SourceID(rawURL string) string    { return matchID(vimeoSourcePatterns, rawURL) }
+func (vimeoProvider) VideoID(rawURL string) string     { return matchID(vimeoVideoPatterns, rawURL) }
+
+func (vimeoProvider) ListURL(sub *models.Subscription) string {
+	return fmt.Sprintf("https://vimeo.com/%s", sub.YoutubeChannelID)
+}
+
+func (vimeoProvider) VideoURL(videoID string) string {
+	return fmt.Sprintf("https://vimeo.com/%s", videoID)
+}
+
+// SoundCloud users and sets; two path segments are a single track
+var (
+	soundCloudSourcePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.|m\.)?soundcloud\.com/([a-z0-9_-]+(?:/sets/[a-z0-9_-]+)?)(?:/tracks)?/?$`),
+	}
+	soundCloudVideoPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.|m\.)?soundcloud\.com/([a-z0-9_-]+/[a-z0-9_-]+)/?(?:\?.*)?$`),
+	}
+	// soundCloudReservedPaths are second path segments that aren't tracks
+	soundCloudReservedPaths = map[string]bool{
+		"tracks": true, "sets": true, "albums": true, "likes": true, "reposts": true,
+		"followers": true, "following": true, "popular-tracks": true,
+	}
+)
+
+type soundCloudProvider struct{}
+
+func (soundCloudProvider) Name() string        { return ProviderSoundCloud }
+func (soundCloudProvider) DisplayName() string { return "SoundCloud" }
+
+func (p soundCloudProvider) MatchSource(rawURL string) bool { return p.SourceID(rawURL) != "" }
+
+func (soundCloudProvider) SourceID(rawURL string) string {
+	return matchID(soundCloudSourcePatterns, rawURL)
+}
+
+func (soundCloudProvider) VideoID(rawURL string) string {
+	id := matchID(soundCloudVideoPatterns, rawURL)
+	if id == "" || soundCloudReservedPaths[id[strings.Index(id, "/")+1:]] {
+		return ""
+	}
+	return id
+}
+
+func (soundCloudProvider) ListURL(sub *models.Subscription) string {
+	if strings.Contains(sub.YoutubeChannelID, "/sets/") {
+		return fmt.Sprintf("https://soundcloud.com/%s", sub.YoutubeChannelID)
+	}
+	return fmt.Sprintf("https://soundcloud.com/%s/tracks", sub.YoutubeChannelID)
+}
+
+// VideoURL accepts both the numeric track IDs yt-dlp lists and user/slug paths from pasted links
+func (soundCloudProvider) VideoURL(videoID string) string {
+	if strings.Contains(videoID, "/") {
+		return fmt.Sprintf("https://soundcloud.com/%s", videoID)
+	}
+	return fmt.Sprintf("https://api.soundcloud.com/tracks/%s", videoID)
+}
+
+// Twitch channels (their past broadcasts) and individual VODs
+var (
+	twitchSourcePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.|m\.)?twitch\.tv/([a-zA-Z0-9_]{3,25})(?:/videos)?/?(?:\?.*)?$`),
+	}
+	twitchVideoPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^https://(?:www\.|m\.)?twitch\.tv/(?:[a-zA-Z0-9_]+/v(?:ideo)?|videos)/([0-9]+)(?:[/?#].*)?$`),
+	}
+	twitchReservedPaths = map[string]bool{"videos": true, "directory": true, "downloads": true, "settings": true}
+)
+
+type twitchProvider struct{}
+
+func (twitchProvider) Name() string        { return ProviderTwitch }
+func (twitchProvider) DisplayName() string { return "Twitch" }
+
+func (p twitchProvider) MatchSource(rawURL string) bool { return p.SourceID(rawURL) != "" }
+
+func (twitchProvider) SourceID(rawURL string) string {
+	id := matchID(twitchSourcePatterns, rawURL)
+	if twitchReservedPaths[strings.ToLower(id)] {
+		return ""
+	}
+	return strings.ToLower(id)
+}
+
+// VideoID uses yt-dlp's "v" prefixed form so pasted links and listed VODs share IDs
+func (twitchProvider) VideoID(rawURL string) string {
+	if id := matchID(twitchVideoPatterns, rawURL); id != "" {
+		return "v" + id
+	}
+	return ""
+}
+
+func (twitchProvider) ListURL(sub *models.Subscription) string {
+	return fmt.Sprintf("https://www.twitch.tv/%s/videos?filter=archives&sort=time", sub.YoutubeChannelID)
+}
+
+func (twitchProvider) VideoURL(videoID string) string {
+	return fmt.Sprintf("https://www.twitch.tv/videos/%s", strings.TrimPrefix(videoID, "v"))
+}
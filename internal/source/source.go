@@ -0,0 +1,134 @@
+// Package source describes the sites subscriptions and one-off episodes can come from.
+//
+// Every provider only accepts https URLs on its own hosts, so user input can never make
+// the service (or yt-dlp) fetch arbitrary addresses. Which providers are usable is
+// controlled by the ALLOWED_PROVIDERS environment variable.
+package source
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"yt-podcaster/internal/models"
+)
+
+const (
+	ProviderYouTube    = "youtube"
+	ProviderVimeo      = "vimeo"
+	ProviderSoundCloud = "soundcloud"
+	ProviderTwitch     = "twitch"
+)
+
+var (
+	ErrUnsupportedURL     = errors.New("unsupported URL")
+	ErrProviderNotAllowed = errors.New("provider is not allowed")
+)
+
+// Provider knows how to recognise a site's URLs and build the URLs yt-dlp needs.
+type Provider interface {
+	// Name is the identifier stored in the provider column.
+	Name() string
+	// DisplayName is shown to users, e.g. "SoundCloud".
+	DisplayName() string
+	// MatchSource reports whether rawURL is a subscribable page (channel, user, playlist...).
+	MatchSource(rawURL string) bool
+	// SourceID returns the ID stored for a subscription created from rawURL,
+	// or an empty string if it has to be resolved another way.
+	SourceID(rawURL string) string
+	// VideoID returns the ID of a single video URL, or an empty string if rawURL isn't one.
+	VideoID(rawURL string) string
+	// ListURL is the URL yt-dlp lists to find a subscription's new videos.
+	ListURL(sub *models.Subscription) string
+	// VideoURL is the URL yt-dlp downloads a video from.
+	VideoURL(videoID string) string
+}
+
+var providers = map[string]Provider{
+	ProviderYouTube:    youtubeProvider{},
+	ProviderVimeo:      vimeoProvider{},
+	ProviderSoundCloud: soundCloudProvider{},
+	ProviderTwitch:     twitchProvider{},
+}
+
+// providerOrder keeps URL matching deterministic
+var providerOrder = []string{ProviderYouTube, ProviderVimeo, ProviderSoundCloud, ProviderTwitch}
+
+// allowedProviders returns the providers enabled by ALLOWED_PROVIDERS (default: youtube only)
+func allowedProviders() map[string]bool {
+	allowed := map[string]bool{}
+	env := os.Getenv("ALLOWED_PROVIDERS")
+	if env == "" {
+		env = ProviderYouTube
+	}
+	for _, name := range strings.Split(env, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := providers[name]; ok {
+			allowed[name] = true
+		}
+	}
+	return allowed
+}
+
+// Get returns an allowed provider by name.
+func Get(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	if !allowedProviders()[name] {
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotAllowed, name)
+	}
+	return p, nil
+}
+
+// MatchSource finds the allowed provider a subscription URL belongs to.
+func MatchSource(rawURL string) (Provider, error) {
+	return match(rawURL, func(p Provider) bool { return p.MatchSource(rawURL) })
+}
+
+// MatchVideo finds the allowed provider a single video URL belongs to and returns its video ID.
+func MatchVideo(rawURL string) (Provider, string, error) {
+	var videoID string
+	p, err := match(rawURL, func(p Provider) bool {
+		videoID = p.VideoID(rawURL)
+		return videoID != ""
+	})
+	return p, videoID, err
+}
+
+func match(rawURL string, matches func(Provider) bool) (Provider, error) {
+	allowed := allowedProviders()
+	for _, name := range providerOrder {
+		p := providers[name]
+		if !matches(p) {
+			continue
+		}
+		if !allowed[name] {
+			return nil, fmt.Errorf("%w: %s", ErrProviderNotAllowed, name)
+		}
+		return p, nil
+	}
+	return nil, ErrUnsupportedURL
+}
+
+// DisplayName returns the user-facing name of a provider, falling back to the raw name.
+func DisplayName(name string) string {
+	if p, ok := providers[name]; ok {
+		return p.DisplayName()
+	}
+	return name
+}
+
+// AllowedDisplayNames lists the enabled providers for help messages.
+func AllowedDisplayNames() []string {
+	allowed := allowedProviders()
+	var names []string
+	for _, name := range providerOrder {
+		if allowed[name] {
+			names = append(names, providers[name].DisplayName())
+		}
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package source
+
+import (
+	"testing"
+
+	"yt-podcaster/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchSource(t *testing.T) {
+	t.Setenv("ALLOWED_PROVIDERS", "youtube,vimeo,soundcloud,twitch")
+
+	tests := []struct {
+		url      string
+		provider string
+		sourceID string
+	}{
+		{"https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", ProviderYouTube, "UC-lHJZR3Gqxm24_Vd_AJ5Yw"},
+		{"https://www.youtube.com/@veritasium", ProviderYouTube, ""},
+		{"https://www.youtube.com/playlist?list=PL1234567890", ProviderYouTube, ""},
+		{"https://vimeo.com/staffpicks", ProviderVimeo, "staffpicks"},
+		{"https://vimeo.com/channels/documentaries/videos", ProviderVimeo, "channels/documentaries"},
+		{"https://soundcloud.com/some-artist", ProviderSoundCloud, "some-artist"},
+		{"https://soundcloud.com/some-artist/sets/live-shows", ProviderSoundCloud, "some-artist/sets/live-shows"},
+		{"https://www.twitch.tv/SomeStreamer/videos", ProviderTwitch, "somestreamer"},
+	}
+
+	for _, tt := range tests {
+		p, err := MatchSource(tt.url)
+		if assert.NoError(t, err, tt.url) {
+			assert.Equal(t, tt.provider, p.Name(), tt.url)
+			assert.Equal(t, tt.sourceID, p.SourceID(tt.url), tt.url)
+		}
+	}
+}
+
+func TestMatchSourceRejectsForeignHosts(t *testing.T) {
+	t.Setenv("ALLOWED_PROVIDERS", "youtube,vimeo,soundcloud,twitch")
+
+	for _, url := range []string{
+		"http://vimeo.com/staffpicks",
+		"https://youtube.com.evil.example/@veritasium",
+		"https://evil.example/vimeo.com/staffpicks",
+		"https://169.254.169.254/latest/meta-data",
+		"https://vimeo.com/123456",
+		"https://www.twitch.tv/directory",
+	} {
+		_, err := MatchSource(url)
+		assert.ErrorIs(t, err, ErrUnsupportedURL, url)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	t.Setenv("ALLOWED_PROVIDERS", "")
+
+	_, err := MatchSource("https://vimeo.com/staffpicks")
+	assert.ErrorIs(t, err, ErrProviderNotAllowed)
+
+	_, err = Get(ProviderSoundCloud)
+	assert.ErrorIs(t, err, ErrProviderNotAllowed)
+
+	p, err := Get(ProviderYouTube)
+	assert.NoError(t, err)
+	assert.Equal(t, ProviderYouTube, p.Name())
+	assert.Equal(t, []string{"YouTube"}, AllowedDisplayNames())
+}
+
+func TestMatchVideo(t *testing.T) {
+	t.Setenv("ALLOWED_PROVIDERS", "youtube,vimeo,soundcloud,twitch")
+
+	tests := []struct {
+		url      string
+		provider string
+		videoID  string
+		videoURL string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42", ProviderYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", ProviderYouTube, "dQw4w9WgXcQ", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://vimeo.com/76979871", ProviderVimeo, "76979871", "https://vimeo.com/76979871"},
+		{"https://soundcloud.com/some-artist/a-track", ProviderSoundCloud, "some-artist/a-track", "https://soundcloud.com/some-artist/a-track"},
+		{"https://www.twitch.tv/videos/123456789", ProviderTwitch, "v123456789", "https://www.twitch.tv/videos/123456789"},
+	}
+
+	for _, tt := range tests {
+		p, videoID, err := MatchVideo(tt.url)
+		if assert.NoError(t, err, tt.url) {
+			assert.Equal(t, tt.provider, p.Name(), tt.url)
+			assert.Equal(t, tt.videoID, videoID, tt.url)
+			assert.Equal(t, tt.videoURL, p.VideoURL(videoID), tt.url)
+		}
+	}
+
+	_, _, err := MatchVideo("https://soundcloud.com/some-artist/tracks")
+	assert.ErrorIs(t, err, ErrUnsupportedURL)
+}
+
+func TestListURL(t *testing.T) {
+	playlistID := "PL123"
+	assert.Equal(t, "https://www.youtube.com/channel/UC123/videos", providers[ProviderYouTube].ListURL(&models.Subscription{YoutubeChannelID: "UC123"}))
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL123", providers[ProviderYouTube].ListURL(&models.Subscription{SourceType: "playlist", YoutubePlaylistID: &playlistID}))
+	assert.Equal(t, "https://soundcloud.com/artist/tracks", providers[ProviderSoundCloud].ListURL(&models.Subscription{YoutubeChannelID: "artist"}))
+	assert.Equal(t, "https://soundcloud.com/artist/sets/live", providers[ProviderSoundCloud].ListURL(&models.Subscription{YoutubeChannelID: "artist/sets/live"}))
+	assert.Equal(t, "https://www.twitch.tv/streamer/videos?filter=archives&sort=time", providers[ProviderTwitch].ListURL(&models.Subscription{YoutubeChannelID: "streamer"}))
+}
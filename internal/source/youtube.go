@@ -0,0 +1,43 @@
+package source
+
+import (
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/youtube"
+)
+
+type youtubeProvider struct{}
+
+func (youtubeProvider) Name() string        { return ProviderYouTube }
+func (youtubeProvider) DisplayName() string { return "YouTube" }
+
+func (youtubeProvider) MatchSource(rawURL string) bool {
+	ref, err := youtube.Parse(rawURL)
+	return err == nil && ref.IsSource()
+}
+
+// SourceID only knows the channel ID of /channel/ URLs; handles, users and custom URLs
+// have to be resolved by fetching the channel page.
+func (youtubeProvider) SourceID(rawURL string) string {
+	if ref, err := youtube.Parse(rawURL); err == nil && ref.Kind == youtube.KindChannel {
+		return ref.ID
+	}
+	return ""
+}
+
+func (youtubeProvider) VideoID(rawURL string) string {
+	if ref, err := youtube.Parse(rawURL); err == nil && ref.Kind == youtube.KindVideo {
+		return ref.ID
+	}
+	return ""
+}
+
+func (youtubeProvider) ListURL(sub *models.Subscription) string {
+	if sub.SourceType == "playlist" && sub.YoutubePlaylistID != nil {
+		return youtube.Ref{Kind: youtube.KindPlaylist, ID: *sub.YoutubePlaylistID}.Canonical()
+	}
+	return youtube.Ref{Kind: youtube.KindChannel, ID: sub.YoutubeChannelID}.Canonical() + "/videos"
+}
+
+func (youtubeProvider) VideoURL(videoID string) string {
+	return youtube.Ref{Kind: youtube.KindVideo, ID: videoID}.Canonical()
+}
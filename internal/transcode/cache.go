@@ -0,0 +1,292 @@
+package transcode
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcodeTimeout caps a single ffmpeg run, even for hours-long episodes
+const transcodeTimeout = 30 * time.Minute
+
+// Encoder writes the audio of src in a profile to w.
+type Encoder func(ctx context.Context, src string, profile Profile, w io.Writer) error
+
+// FFmpeg encodes audio with the ffmpeg binary.
+func FFmpeg(ctx context.Context, src string, profile Profile, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", profile.ffmpegArgs(src)...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Cache keeps transcoded variants in a directory, evicting the least recently
+// served ones once they take up more than maxBytes.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	encode   Encoder
+	// encodes holds a token per ffmpeg run, capping how many run at once
+	encodes chan struct{}
+
+	mu    sync.Mutex
+	files map[string]*list.Element
+	// lru holds *cachedFile, the most recently served first
+	lru  *list.List
+	size int64
+	// encoding holds the variants being made
+	encoding map[string]bool
+}
+
+type cachedFile struct {
+	name string
+	size int64
+}
+
+// NewCache returns a cache in dir that makes up to maxEncodes variants at once,
+// indexing the variants already there by their modification time. Partial
+// files of interrupted runs are removed.
+func NewCache(dir string, maxBytes int64, maxEncodes int, encode Encoder) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		encode:   encode,
+		encodes:  make(chan struct{}, max(maxEncodes, 1)),
+		files:    make(map[string]*list.Element),
+		lru:      list.New(),
+		encoding: make(map[string]bool),
+	}
+	var existing []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			existing = append(existing, info)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].ModTime().Before(existing[j].ModTime()) })
+	for _, info := range existing {
+		c.add(info.Name(), info.Size())
+	}
+	c.evict()
+	return c, nil
+}
+
+// Serve writes the audio at src in a profile. A cached variant is served like
+// any file; otherwise it is made and streamed, without Range support, while
+// it is written to the cache. Requests that would have to wait, for the same
+// variant being made or for a free encoder, get the original audio at once,
+// as do those whose variant fails before anything was sent.
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request, src string, audioUUID string, profile Profile) {
+	name := audioUUID + "." + profile.Name + ".m4a"
+	w.Header().Set("Content-Type", "audio/mp4")
+
+	c.mu.Lock()
+	if element, ok := c.files[name]; ok {
+		c.lru.MoveToFront(element)
+		// Opened under the lock, so evicting the variant meanwhile can't pull it from under the response
+		file, err := os.Open(filepath.Join(c.dir, name))
+		c.mu.Unlock()
+		if err != nil {
+			log.Printf("Error opening cached variant %s: %v", name, err)
+			http.ServeFile(w, r, src)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			log.Printf("Error reading cached variant %s: %v", name, err)
+			http.ServeFile(w, r, src)
+			return
+		}
+		http.ServeContent(w, r, name, info.ModTime(), file)
+		return
+	}
+	if c.encoding[name] {
+		c.mu.Unlock()
+		http.ServeFile(w, r, src)
+		return
+	}
+	select {
+	case c.encodes <- struct{}{}:
+	default:
+		c.mu.Unlock()
+		http.ServeFile(w, r, src)
+		return
+	}
+	c.encoding[name] = true
+	c.mu.Unlock()
+
+	client := &clientWriter{w: w}
+	err := c.fill(name, src, profile, client)
+
+	c.mu.Lock()
+	delete(c.encoding, name)
+	c.mu.Unlock()
+	<-c.encodes
+
+	if err != nil {
+		log.Printf("Error transcoding %s to %s: %v", audioUUID, profile.Name, err)
+		if !client.written {
+			http.ServeFile(w, r, src)
+		}
+	}
+}
+
+// fill makes a variant, writing it to the client and to a temporary file that
+// becomes the cached copy once complete. A client going away doesn't stop it.
+func (c *Cache) fill(name string, src string, profile Profile, client io.Writer) error {
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcodeTimeout)
+	defer cancel()
+	if err := c.encode(ctx, src, profile, io.MultiWriter(tmp, client)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(name, info.Size())
+	c.evict()
+	return nil
+}
+
+// add indexes a cached file as the most recently served; c.mu must be held
+func (c *Cache) add(name string, size int64) {
+	if element, ok := c.files[name]; ok {
+		c.size -= element.Value.(*cachedFile).size
+		c.lru.Remove(element)
+	}
+	c.files[name] = c.lru.PushFront(&cachedFile{name: name, size: size})
+	c.size += size
+}
+
+// evict removes the least recently served files until the cache fits, always
+// keeping the newest one; c.mu must be held
+func (c *Cache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		file := c.lru.Remove(c.lru.Back()).(*cachedFile)
+		delete(c.files, file.name)
+		c.size -= file.size
+		// Requests still reading it keep their open file
+		if err := os.Remove(filepath.Join(c.dir, file.name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error evicting transcoded audio %s: %v", file.name, err)
+		}
+	}
+}
+
+// clientWriter streams to a client, ignoring write errors so that a listener
+// going away doesn't stop the cached copy from being written
+type clientWriter struct {
+	w       io.Writer
+	written bool
+	failed  bool
+}
+
+func (c *clientWriter) Write(p []byte) (int, error) {
+	if !c.failed {
+		c.written = true
+		if _, err := c.w.Write(p); err != nil {
+			c.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+var cache *Cache
+
+// getMaxEncodes returns how many variants may be made at once
+func getMaxEncodes() int {
+	maxEncodes := 2
+	if env := os.Getenv("TRANSCODE_MAX_ENCODES"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val > 0 {
+			maxEncodes = val
+		}
+	}
+	return maxEncodes
+}
+
+func getCacheMaxBytes() int64 {
+	maxMB := int64(2048)
+	if env := os.Getenv("TRANSCODE_CACHE_MAX_MB"); env != "" {
+		if val, err := strconv.ParseInt(env, 10, 64); err == nil {
+			maxMB = val
+		}
+	}
+	return maxMB << 20
+}
+
+// Init enables variants, cached in TRANSCODE_CACHE_PATH or else in a variants
+// directory under audioStoragePath, making up to TRANSCODE_MAX_ENCODES at a
+// time. A TRANSCODE_CACHE_MAX_MB of 0 disables them. Until Init is called the
+// original audio is served for every profile.
+func Init(audioStoragePath string) {
+	maxBytes := getCacheMaxBytes()
+	if maxBytes <= 0 {
+		return
+	}
+	dir := os.Getenv("TRANSCODE_CACHE_PATH")
+	if dir == "" {
+		dir = filepath.Join(audioStoragePath, "variants")
+	}
+	c, err := NewCache(dir, maxBytes, getMaxEncodes(), FFmpeg)
+	if err != nil {
+		log.Printf("Error opening transcode cache in %s, variants disabled: %v", dir, err)
+		return
+	}
+	cache = c
+}
+
+// Serve writes the audio at src in a profile through the cache Init opened,
+// or the original audio when variants are disabled.
+func Serve(w http.ResponseWriter, r *http.Request, src string, audioUUID string, profile Profile) {
+	if cache == nil {
+		http.ServeFile(w, r, src)
+		return
+	}
+	cache.Serve(w, r, src, audioUUID, profile)
+}
@@ -0,0 +1,193 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEncoder "transcodes" by prefixing the source with the profile name
+func fakeEncoder(runs *int32) Encoder {
+	return func(ctx context.Context, src string, profile Profile, w io.Writer) error {
+		atomic.AddInt32(runs, 1)
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append([]byte(profile.Name+":"), data...))
+		return err
+	}
+}
+
+func writeSource(t *testing.T, dir string, content string) string {
+	src := filepath.Join(dir, "original.m4a")
+	assert.NoError(t, os.WriteFile(src, []byte(content), 0644))
+	return src
+}
+
+func TestCacheServeTranscodesOnce(t *testing.T) {
+	dir := t.TempDir()
+	src := writeSource(t, dir, "original audio")
+	var runs int32
+	cache, err := NewCache(filepath.Join(dir, "variants"), 1<<20, 1, fakeEncoder(&runs))
+	assert.NoError(t, err)
+	profile, _ := Lookup("voice48")
+
+	// The first request streams the variant while it is made, ignoring Range
+	req := httptest.NewRequest("GET", "/audio/a.m4a?profile=voice48", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	rr := httptest.NewRecorder()
+	cache.Serve(rr, req, src, "a", profile)
+	assert.Equal(t, 200, rr.Code)
+	assert.Equal(t, "voice48:original audio", rr.Body.String())
+	assert.Equal(t, "audio/mp4", rr.Header().Get("Content-Type"))
+
+	// Later ones are served from the cache, with Range support
+	rr = httptest.NewRecorder()
+	cache.Serve(rr, req, src, "a", profile)
+	assert.Equal(t, 206, rr.Code)
+	assert.Equal(t, "voic", rr.Body.String())
+	assert.Equal(t, int32(1), runs)
+}
+
+func TestCacheServeFallsBackToOriginal(t *testing.T) {
+	dir := t.TempDir()
+	src := writeSource(t, dir, "original audio")
+	cache, err := NewCache(filepath.Join(dir, "variants"), 1<<20, 1, func(ctx context.Context, src string, profile Profile, w io.Writer) error {
+		return errors.New("no ffmpeg")
+	})
+	assert.NoError(t, err)
+	profile, _ := Lookup("voice32")
+
+	rr := httptest.NewRecorder()
+	cache.Serve(rr, httptest.NewRequest("GET", "/audio/a.m4a?profile=voice32", nil), src, "a", profile)
+	assert.Equal(t, 200, rr.Code)
+	assert.Equal(t, "original audio", rr.Body.String())
+
+	// Nothing half-made is left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "variants"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCacheServesOriginalForMissingVariant(t *testing.T) {
+	dir := t.TempDir()
+	src := writeSource(t, dir, "original audio")
+	var runs int32
+	cache, err := NewCache(filepath.Join(dir, "variants"), 1<<20, 1, fakeEncoder(&runs))
+	assert.NoError(t, err)
+	profile, _ := Lookup("voice48")
+	cache.Serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/audio/a.m4a", nil), src, "a", profile)
+
+	// The variant is listed but was removed before it could be opened
+	assert.NoError(t, os.Remove(filepath.Join(dir, "variants", "a.voice48.m4a")))
+	rr := httptest.NewRecorder()
+	cache.Serve(rr, httptest.NewRequest("GET", "/audio/a.m4a", nil), src, "a", profile)
+	assert.Equal(t, 200, rr.Code)
+	assert.Equal(t, "original audio", rr.Body.String())
+}
+
+func TestCacheServesOriginalInsteadOfWaiting(t *testing.T) {
+	dir := t.TempDir()
+	src := writeSource(t, dir, "original audio")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cache, err := NewCache(filepath.Join(dir, "variants"), 1<<20, 1, func(ctx context.Context, src string, profile Profile, w io.Writer) error {
+		close(started)
+		<-release
+		_, err := w.Write([]byte(profile.Name))
+		return err
+	})
+	assert.NoError(t, err)
+	voice32, _ := Lookup("voice32")
+	voice48, _ := Lookup("voice48")
+
+	done := make(chan struct{})
+	go func() {
+		cache.Serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/audio/a.m4a", nil), src, "a", voice32)
+		close(done)
+	}()
+	<-started
+
+	// The same variant is being made
+	rr := httptest.NewRecorder()
+	cache.Serve(rr, httptest.NewRequest("GET", "/audio/a.m4a", nil), src, "a", voice32)
+	assert.Equal(t, "original audio", rr.Body.String())
+	// Every encoder is busy
+	rr = httptest.NewRecorder()
+	cache.Serve(rr, httptest.NewRequest("GET", "/audio/b.m4a", nil), src, "b", voice48)
+	assert.Equal(t, "original audio", rr.Body.String())
+
+	close(release)
+	<-done
+	rr = httptest.NewRecorder()
+	cache.Serve(rr, httptest.NewRequest("GET", "/audio/a.m4a", nil), src, "a", voice32)
+	assert.Equal(t, "voice32", rr.Body.String())
+}
+
+func TestCacheEvictsLeastRecentlyServed(t *testing.T) {
+	dir := t.TempDir()
+	src := writeSource(t, dir, strings.Repeat("x", 100))
+	var runs int32
+	variants := filepath.Join(dir, "variants")
+	// Room for two variants of about 108 bytes
+	cache, err := NewCache(variants, 250, 1, fakeEncoder(&runs))
+	assert.NoError(t, err)
+	profile, _ := Lookup("voice32")
+
+	serve := func(audioUUID string) {
+		cache.Serve(httptest.NewRecorder(), httptest.NewRequest("GET", "/audio/x.m4a", nil), src, audioUUID, profile)
+	}
+	serve("a")
+	serve("b")
+	serve("a")
+	serve("c")
+
+	_, err = os.Stat(filepath.Join(variants, "a.voice32.m4a"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(variants, "b.voice32.m4a"))
+	assert.True(t, os.IsNotExist(err), "b was served least recently")
+	_, err = os.Stat(filepath.Join(variants, "c.voice32.m4a"))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), runs)
+}
+
+func TestNewCacheIndexesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.voice32.m4a")
+	recent := filepath.Join(dir, "recent.voice32.m4a")
+	assert.NoError(t, os.WriteFile(old, make([]byte, 100), 0644))
+	assert.NoError(t, os.WriteFile(recent, make([]byte, 100), 0644))
+	assert.NoError(t, os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("partial"), 0644))
+
+	_, err := NewCache(dir, 150, 1, nil)
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "recent.voice32.m4a", entries[0].Name())
+	}
+}
+
+func TestLookup(t *testing.T) {
+	profile, ok := Lookup("voice48")
+	assert.True(t, ok)
+	assert.Equal(t, 48, profile.BitrateKbps)
+	assert.Contains(t, profile.ffmpegArgs("in.m4a"), "48k")
+
+	_, ok = Lookup("")
+	assert.False(t, ok)
+	_, ok = Lookup("../../etc")
+	assert.False(t, ok)
+}
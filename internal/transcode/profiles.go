@@ -0,0 +1,70 @@
+// Package transcode serves episodes' audio in smaller variants for listeners
+// on slow or metered connections. A variant is made with ffmpeg the first time
+// it is asked for, streamed to that listener while it is written to a cache,
+// and served from the cache with Range support afterwards.
+package transcode
+
+import (
+	"context"
+	"strconv"
+)
+
+// ProfileParam is the audio URL query parameter selecting a variant.
+const ProfileParam = "profile"
+
+// Profile is an audio variant podcast apps can ask for.
+type Profile struct {
+	Name        string
+	Label       string
+	BitrateKbps int
+	Channels    int
+	SampleRate  int
+}
+
+// Profiles are the variants users can pick for a feed, smallest first.
+var Profiles = []Profile{
+	{Name: "voice32", Label: "Voice, 32 kbps mono", BitrateKbps: 32, Channels: 1, SampleRate: 22050},
+	{Name: "voice48", Label: "Voice, 48 kbps mono", BitrateKbps: 48, Channels: 1, SampleRate: 32000},
+	{Name: "standard64", Label: "Standard, 64 kbps stereo", BitrateKbps: 64, Channels: 2, SampleRate: 44100},
+}
+
+// Lookup returns the profile with a name; "" and unknown names select the
+// original audio.
+func Lookup(name string) (Profile, bool) {
+	for _, profile := range Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ffmpegArgs encode src to the profile as fragmented MP4, which can be
+// written to a pipe as it is encoded
+func (p Profile) ffmpegArgs(src string) []string {
+	return []string{
+		"-nostdin", "-loglevel", "error",
+		"-i", src,
+		"-vn",
+		"-c:a", "aac",
+		"-b:a", strconv.Itoa(p.BitrateKbps) + "k",
+		"-ac", strconv.Itoa(p.Channels),
+		"-ar", strconv.Itoa(p.SampleRate),
+		"-movflags", "+frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"pipe:1",
+	}
+}
+
+type contextKey struct{}
+
+// WithFeedProfile returns a context of a feed request whose audio URLs select a profile.
+func WithFeedProfile(ctx context.Context, profile Profile) context.Context {
+	return context.WithValue(ctx, contextKey{}, profile)
+}
+
+// FeedProfile returns the profile a feed's audio URLs select, if any.
+func FeedProfile(ctx context.Context) (Profile, bool) {
+	profile, ok := ctx.Value(contextKey{}).(Profile)
+	return profile, ok
+}
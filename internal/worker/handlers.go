@@ -2,10 +2,10 @@ package worker
 
 import (
 	"context"
-	"encoding/base64"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
 	"os"
@@ -15,6 +15,11 @@ import (
 	"strings"
 	"time"
 	"yt-podcaster/internal/db"
+	"yt-podcaster/internal/feedcache"
+	"yt-podcaster/internal/filter"
+	"yt-podcaster/internal/models"
+	"yt-podcaster/internal/source"
+	"yt-podcaster/internal/ytdlp"
 	"yt-podcaster/pkg/tasks"
 
 	"github.com/hibiken/asynq"
@@ -23,43 +28,6 @@ import (
 var execCommand = exec.Command
 var execCommandContext = exec.CommandContext
 
-// setupCookieFile creates a temporary cookie file from base64 encoded environment variable
-func setupCookieFile() (string, func(), error) {
-	cookieBase64 := os.Getenv("YOUTUBE_COOKIES_BASE64")
-	if cookieBase64 == "" {
-		// No cookies provided, return empty string to indicate no cookie file
-		return "", func() {}, nil
-	}
-
-	// Decode base64 cookie data
-	cookieData, err := base64.StdEncoding.DecodeString(cookieBase64)
-	if err != nil {
-		return "", func() {}, fmt.Errorf("failed to decode base64 cookies: %w", err)
-	}
-
-	// Create temporary cookie file
-	tmpFile, err := ioutil.TempFile("", "youtube_cookies_*.txt")
-	if err != nil {
-		return "", func() {}, fmt.Errorf("failed to create temporary cookie file: %w", err)
-	}
-
-	// Write cookie data to file
-	if _, err := tmpFile.Write(cookieData); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpFile.Name())
-		return "", func() {}, fmt.Errorf("failed to write cookie data: %w", err)
-	}
-
-	tmpFile.Close()
-
-	// Return cleanup function
-	cleanup := func() {
-		os.Remove(tmpFile.Name())
-	}
-
-	return tmpFile.Name(), cleanup, nil
-}
-
 // getYouTubeRequestDelay returns delay between YouTube requests to be gentle
 func getYouTubeRequestDelay() time.Duration {
 	delay := 30 * time.Second // default gentle delay
@@ -160,6 +128,29 @@ func getCheckChannelTimeout() time.Duration {
 	return timeout
 }
 
+// getChannelRefreshBatchSize limits how many channels one scheduled refresh touches
+func getChannelRefreshBatchSize() int {
+	size := 50
+	if env := os.Getenv("CHANNEL_REFRESH_BATCH_SIZE"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil && val > 0 {
+			size = val
+		}
+	}
+	return size
+}
+
+// getAnalyticsRetentionDays returns how long recorded requests are kept after
+// their day was rolled up; at least 2, as yesterday is rolled up again
+func getAnalyticsRetentionDays() int {
+	days := 7
+	if env := os.Getenv("ANALYTICS_RETENTION_DAYS"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			days = max(val, 2)
+		}
+	}
+	return days
+}
+
 type YtDlpOutput struct {
 	ID          string  `json:"id"`
 	Title       string  `json:"title"`
@@ -167,6 +158,8 @@ type YtDlpOutput struct {
 	Duration    float64 `json:"duration"`
 	Filename    string  `json:"_filename"`
 	UploadDate  string  `json:"upload_date"`
+	// PlaylistIndex is the 1-based position of the entry when listing a playlist
+	PlaylistIndex int `json:"playlist_index"`
 }
 
 type TaskHandler struct {
@@ -185,11 +178,25 @@ func (h *TaskHandler) HandleProcessVideoTask(ctx context.Context, t *asynq.Task)
 
 	log.Printf("Processing video: %s", p.YoutubeVideoID)
 
-	episode, err := db.GetEpisodeByYoutubeID(p.YoutubeVideoID)
+	var episode models.Episode
+	var err error
+	if p.EpisodeID != 0 {
+		episode, err = db.GetEpisodeByID(p.EpisodeID)
+	} else {
+		episode, err = db.GetEpisodeByYoutubeID(p.SubscriptionID, p.YoutubeVideoID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get episode by youtube id: %w", err)
 	}
 
+	provider, err := source.Get(episode.Provider)
+	if err != nil {
+		// The provider was removed from the allowlist, don't download from it anymore
+		log.Printf("Refusing to process video %s: %v", p.YoutubeVideoID, err)
+		db.UpdateEpisodeProcessingFailed(episode.ID)
+		return fmt.Errorf("permanent error: %w", err)
+	}
+
 	err = db.UpdateEpisodeStatus(episode.ID, db.StatusProcessing)
 	if err != nil {
 		return fmt.Errorf("failed to update episode status to processing: %w", err)
@@ -199,12 +206,23 @@ func (h *TaskHandler) HandleProcessVideoTask(ctx context.Context, t *asynq.Task)
 	audioFilename := fmt.Sprintf("%s.m4a", episode.AudioUUID)
 	audioPath := filepath.Join("audio", audioFilename)
 
+	// The video may already be stored for another subscription or inbox, so
+	// its audio is shared instead of fetched and stored again
+	if stored, ok := linkStoredAudio(episode, audioPath); ok {
+		if err := db.CompleteEpisodeFromStored(episode.ID, stored.ID, audioPath); err != nil {
+			return fmt.Errorf("failed to complete episode from stored audio: %w", err)
+		}
+		log.Printf("Reused the stored audio of episode %d for video %s", stored.ID, p.YoutubeVideoID)
+		finishEpisode(ctx, episode, audioPath)
+		return nil
+	}
+
 	// Create a context with a timeout
 	ctx, cancel := context.WithTimeout(ctx, getProcessVideoTimeout())
 	defer cancel()
 
 	// Setup cookie file if available
-	cookieFile, cleanupCookie, err := setupCookieFile()
+	cookieFile, cleanupCookie, err := ytdlp.SetupCookieFile()
 	if err != nil {
 		log.Printf("Warning: failed to setup cookie file: %v", err)
 	}
@@ -228,12 +246,15 @@ func (h *TaskHandler) HandleProcessVideoTask(ctx context.Context, t *asynq.Task)
 	}
 
 	// Add the video URL
-	args = append(args, fmt.Sprintf("https://www.youtube.com/watch?v=%s", p.YoutubeVideoID))
+	args = append(args, provider.VideoURL(episode.YoutubeVideoID))
 
 	cmd := execCommandContext(ctx, "yt-dlp", args...)
 
-	// Add gentle delay before making YouTube request
-	time.Sleep(getYouTubeRequestDelay())
+	// Add gentle delay before making YouTube request; a listener is waiting for on-demand episodes,
+	// which are fetched one at a time as they are played
+	if !p.OnDemand {
+		time.Sleep(getYouTubeRequestDelay())
+	}
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -301,11 +322,45 @@ func (h *TaskHandler) HandleProcessVideoTask(ctx context.Context, t *asynq.Task)
 		return fmt.Errorf("failed to update episode processing success: %w", err)
 	}
 
+	finishEpisode(ctx, episode, audioPath)
 	log.Printf("Successfully processed video: %s", p.YoutubeVideoID)
 
 	return nil
 }
 
+// linkStoredAudio hard links the audio of a completed episode of the same
+// video to audioPath. It returns false when there is none or linking fails,
+// and the audio has to be fetched.
+func linkStoredAudio(episode models.Episode, audioPath string) (models.Episode, bool) {
+	stored, err := db.GetStoredEpisodeByVideoID(episode.Provider, episode.YoutubeVideoID, episode.ID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Warning: failed to look up stored audio of video %s: %v", episode.YoutubeVideoID, err)
+		}
+		return models.Episode{}, false
+	}
+	if err := os.Link(*stored.AudioPath, audioPath); err != nil && !os.IsExist(err) {
+		log.Printf("Warning: failed to link stored audio of video %s: %v", episode.YoutubeVideoID, err)
+		return models.Episode{}, false
+	}
+	return stored, true
+}
+
+// finishEpisode packages a completed episode's audio as HLS when enabled and
+// refreshes the feeds listing it.
+func finishEpisode(ctx context.Context, episode models.Episode, audioPath string) {
+	// The feeds' enclosures stay progressive, so the episode is usable without HLS
+	if getHLSEnabled() {
+		if err := packageHLS(ctx, audioPath, hlsDir(episode.AudioUUID)); err != nil {
+			log.Printf("Warning: failed to package video %s as HLS: %v", episode.YoutubeVideoID, err)
+		} else if err := db.SetEpisodeHLSReady(episode.ID); err != nil {
+			log.Printf("Warning: failed to mark HLS of video %s ready: %v", episode.YoutubeVideoID, err)
+		}
+	}
+
+	invalidateEpisodeFeeds(ctx, episode)
+}
+
 func (h *TaskHandler) HandleRetryFailedEpisodesTask(ctx context.Context, t *asynq.Task) error {
 	log.Println("Retrying failed episodes...")
 
@@ -320,6 +375,16 @@ func (h *TaskHandler) HandleRetryFailedEpisodesTask(ctx context.Context, t *asyn
 		// Check if this looks like a temporary error worth retrying
 		// For now, we'll retry all failed episodes that are old enough
 
+		// On-demand episodes are listed again and fetched when next requested
+		if episode.OnDemand {
+			if err := db.UpdateEpisodeStatus(episode.ID, db.StatusOnDemand); err != nil {
+				log.Printf("Failed to relist on-demand episode %s: %v", episode.YoutubeVideoID, err)
+				continue
+			}
+			invalidateEpisodeFeeds(ctx, episode)
+			continue
+		}
+
 		log.Printf("Retrying failed episode: %s", episode.YoutubeVideoID)
 
 		// Reset episode status to pending so it can be processed again
@@ -330,7 +395,12 @@ func (h *TaskHandler) HandleRetryFailedEpisodesTask(ctx context.Context, t *asyn
 		}
 
 		// Enqueue a new process video task with delay to spread out the load
-		task, err := tasks.NewProcessVideoTask(episode.YoutubeVideoID, episode.SubscriptionID)
+		var task *asynq.Task
+		if episode.SubscriptionID != nil {
+			task, err = tasks.NewProcessVideoTask(episode.YoutubeVideoID, *episode.SubscriptionID)
+		} else {
+			task, err = tasks.NewProcessEpisodeTask(episode.ID, episode.YoutubeVideoID)
+		}
 		if err != nil {
 			log.Printf("Failed to create process video task for %s: %v", episode.YoutubeVideoID, err)
 			continue
@@ -403,29 +473,40 @@ func (h *TaskHandler) HandleCheckChannelTask(ctx context.Context, t *asynq.Task)
 	defer cancel()
 
 	// Setup cookie file if available
-	cookieFile, cleanupCookie, err := setupCookieFile()
+	cookieFile, cleanupCookie, err := ytdlp.SetupCookieFile()
 	if err != nil {
 		log.Printf("Warning: failed to setup cookie file: %v", err)
 	}
 	defer cleanupCookie()
 
-	// Try multiple URL formats for better compatibility
-	channelURL := fmt.Sprintf("https://www.youtube.com/channel/%s/videos", subscription.YoutubeChannelID)
+	provider, err := source.Get(subscription.Provider)
+	if err != nil {
+		log.Printf("Skipping subscription %d: %v", subscription.ID, err)
+		return nil
+	}
+
+	isPlaylist := subscription.SourceType == db.SourceTypePlaylist && subscription.YoutubePlaylistID != nil
+	channelURL := provider.ListURL(&subscription)
 
 	// Build yt-dlp command arguments
-	playlistEnd := "20"
-	if isNewChannel {
-		playlistEnd = "50"
-	}
 	args := []string{
 		"--flat-playlist",
 		"-j",
-		"--playlist-end", playlistEnd,
 		"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
 		"--add-header", "Accept-Language:en-US,en;q=0.9",
 		"--extractor-args", "youtube:player_client=android",
 	}
 
+	// Channel uploads are listed newest first, so only the head of the list matters.
+	// Playlists are usually in episode order with new entries appended, so list them fully.
+	if !isPlaylist {
+		playlistEnd := "20"
+		if isNewChannel {
+			playlistEnd = "50"
+		}
+		args = append(args, "--playlist-end", playlistEnd)
+	}
+
 	// Add cookie file if available
 	if cookieFile != "" {
 		args = append(args, "--cookies", cookieFile)
@@ -467,47 +548,69 @@ func (h *TaskHandler) HandleCheckChannelTask(ctx context.Context, t *asynq.Task)
 		videos = append(videos, videoInfo)
 	}
 
-	// Get the upload date of the newest video
-	var newestVideoDate time.Time
+	// Only videos up to a year older than the newest video are included
+	rules := filter.Rules{Playlist: isPlaylist}
+	var cutoffDate time.Time
 	if len(videos) > 0 {
-		if t, err := time.Parse("20060102", videos[0].UploadDate); err == nil {
-			newestVideoDate = t
-		}
+		cutoffDate = rules.Cutoff(videos[0].UploadDate)
 	}
 
-	// Calculate the cutoff date (1 year before the newest video)
-	cutoffDate := newestVideoDate.AddDate(-1, 0, 0)
-
 	processedCount := 0
+	listedOnDemand := false
 	for i, videoInfo := range videos {
 		// Check if we already have this video
-		_, err := db.GetEpisodeByYoutubeID(videoInfo.ID)
+		existing, err := db.GetEpisodeByYoutubeID(subscription.ID, videoInfo.ID)
 		if err == nil {
-			// We already have this video, so we can skip it
+			// We already have this video; just follow playlist reordering
+			if isPlaylist && videoInfo.PlaylistIndex > 0 &&
+				(existing.PlaylistPosition == nil || *existing.PlaylistPosition != videoInfo.PlaylistIndex) {
+				if err := db.UpdateEpisodePlaylistPosition(existing.ID, videoInfo.PlaylistIndex); err != nil {
+					log.Printf("failed to update playlist position for video %s: %v", videoInfo.ID, err)
+				} else {
+					feedcache.InvalidateUser(ctx, subscription.UserID)
+				}
+			}
 			continue
 		}
 
-		// If it's a new channel, limit to 50 videos
-		if isNewChannel && processedCount >= 50 {
+		// If it's a new channel, limit the number of imported videos
+		if isNewChannel && processedCount >= filter.MaxNewChannelEpisodes {
 			break
 		}
+		// Playlists are listed in full; the rest of a long one is imported by later checks
+		if isPlaylist && processedCount >= filter.MaxPlaylistEpisodesPerCheck {
+			break
+		}
+
+		if rules.TooOld(videoInfo.UploadDate, cutoffDate) {
+			continue
+		}
 
-		// Check if the video is older than 1 year from the newest video
-		if uploadDate, err := time.Parse("20060102", videoInfo.UploadDate); err == nil {
-			if uploadDate.Before(cutoffDate) {
+		// On-demand subscriptions only list the video; its audio is fetched once requested
+		if subscription.OnDemand {
+			if err := createOnDemandEpisode(subscription, videoInfo, isPlaylist, i); err != nil {
+				log.Printf("failed to create on-demand episode: %v", err)
 				continue
 			}
+			listedOnDemand = true
+			processedCount++
+			continue
 		}
 
 		// If we don't have this video, create a new episode and enqueue a task to process it
-		episode, err := db.CreateEpisode(subscription.ID, videoInfo.ID)
+		var episode models.Episode
+		if isPlaylist {
+			episode, err = db.CreatePlaylistEpisode(subscription.ID, videoInfo.ID, videoInfo.PlaylistIndex)
+		} else {
+			episode, err = db.CreateEpisode(subscription.ID, videoInfo.ID)
+		}
 		if err != nil {
 			log.Printf("failed to create episode: %v", err)
 			continue
 		}
 
 		// Enqueue a task to process the video with enhanced retry options
-		task, err := tasks.NewProcessVideoTask(episode.YoutubeVideoID, episode.SubscriptionID)
+		task, err := tasks.NewProcessVideoTask(episode.YoutubeVideoID, subscription.ID)
 		if err != nil {
 			log.Printf("failed to create process video task: %v", err)
 			continue
@@ -527,5 +630,190 @@ func (h *TaskHandler) HandleCheckChannelTask(ctx context.Context, t *asynq.Task)
 		processedCount++
 	}
 
+	// Processed episodes invalidate the feeds themselves, on-demand ones are listed right away
+	if listedOnDemand {
+		feedcache.InvalidateUser(ctx, subscription.UserID)
+	}
+
+	return nil
+}
+
+// createOnDemandEpisode lists a video of an on-demand subscription from its
+// entry in the listing, index being its place there
+func createOnDemandEpisode(subscription models.Subscription, video YtDlpOutput, isPlaylist bool, index int) error {
+	var position *int
+	if isPlaylist && video.PlaylistIndex > 0 {
+		position = &video.PlaylistIndex
+	}
+	// Flat listings often lack upload dates. Channels list newest first, so
+	// dating such videos back by their place keeps them in order until fetched.
+	publishedAt := time.Now().Add(-time.Duration(index) * time.Minute)
+	if t, err := time.Parse("20060102", video.UploadDate); err == nil {
+		publishedAt = t
+	}
+	_, err := db.CreateOnDemandEpisode(subscription.ID, video.ID, position, video.Title, video.Description, int(video.Duration), publishedAt)
+	return err
+}
+
+func (h *TaskHandler) HandleRefreshAllChannelsTask(ctx context.Context, t *asynq.Task) error {
+	log.Println("Refreshing channel metadata...")
+
+	channels, err := db.GetChannelsToRefresh(getChannelRefreshBatchSize())
+	if err != nil {
+		return fmt.Errorf("failed to get channels to refresh: %w", err)
+	}
+
+	for _, channel := range channels {
+		task, err := tasks.NewRefreshChannelTask(channel.Provider, channel.YoutubeChannelID)
+		if err != nil {
+			log.Printf("failed to create refresh channel task for %s: %v", channel.YoutubeChannelID, err)
+			continue
+		}
+
+		_, err = h.asynqClient.Enqueue(task)
+		if err != nil {
+			log.Printf("failed to enqueue refresh channel task for %s: %v", channel.YoutubeChannelID, err)
+			continue
+		}
+	}
+
+	log.Printf("Queued metadata refresh for %d channels.", len(channels))
+	return nil
+}
+
+func (h *TaskHandler) HandleRefreshChannelTask(ctx context.Context, t *asynq.Task) error {
+	var p tasks.RefreshChannelTaskPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal task payload: %w", err)
+	}
+	log.Printf("Refreshing metadata for %s channel: %s", p.Provider, p.ChannelID)
+
+	provider, err := source.Get(p.Provider)
+	if err != nil {
+		log.Printf("Skipping channel %s: %v", p.ChannelID, err)
+		return nil
+	}
+
+	// Add delay to be gentle with YouTube
+	delay := getYouTubeRequestDelay()
+	log.Printf("Waiting %v before refreshing channel to be gentle with YouTube", delay)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(ctx, getCheckChannelTimeout())
+	defer cancel()
+
+	listURL := provider.ListURL(&models.Subscription{Provider: p.Provider, YoutubeChannelID: p.ChannelID, SourceType: db.SourceTypeChannel})
+	meta, err := ytdlp.FetchChannel(ctx, listURL)
+	if errors.Is(err, ytdlp.ErrUnavailable) {
+		log.Printf("Channel %s is no longer available, flagging as terminated: %v", p.ChannelID, err)
+		if err := db.MarkChannelTerminated(p.Provider, p.ChannelID); err != nil {
+			return fmt.Errorf("failed to flag channel as terminated: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch channel metadata: %w", err)
+	}
+
+	channel := models.Channel{
+		Provider:         p.Provider,
+		YoutubeChannelID: p.ChannelID,
+		Title:            meta.Title,
+		Handle:           optionalString(meta.Handle),
+		Description:      optionalString(meta.Description),
+		AvatarURL:        optionalString(meta.AvatarURL),
+		BannerURL:        optionalString(meta.BannerURL),
+		Language:         optionalString(meta.Language),
+		Status:           db.ChannelStatusActive,
+	}
+	if meta.SubscriberCount > 0 {
+		channel.SubscriberCount = &meta.SubscriberCount
+	}
+
+	previous, err := db.GetChannel(p.Provider, p.ChannelID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get channel: %w", err)
+	}
+	switch {
+	case previous.Title != "" && previous.Title != meta.Title:
+		log.Printf("Channel %s was renamed from %q to %q", p.ChannelID, previous.Title, meta.Title)
+		channel.Status = db.ChannelStatusRenamed
+		channel.PreviousTitle = &previous.Title
+	case previous.Status == db.ChannelStatusRenamed:
+		// Keep the rename visible until the next one
+		channel.Status = db.ChannelStatusRenamed
+		channel.PreviousTitle = previous.PreviousTitle
+	}
+
+	if err := db.UpsertChannel(channel); err != nil {
+		return fmt.Errorf("failed to store channel metadata: %w", err)
+	}
+
+	// Subscriptions captured the title at subscribe time; keep them in step with rebrands
+	if previous.Title != meta.Title {
+		if err := db.RenameChannelSubscriptions(p.Provider, p.ChannelID, meta.Title); err != nil {
+			return fmt.Errorf("failed to update subscription titles: %w", err)
+		}
+	}
+
+	// Feeds show the channel's description and artwork
+	if feedcache.Enabled() {
+		userIDs, err := db.GetChannelSubscriberIDs(p.Provider, p.ChannelID)
+		if err != nil {
+			log.Printf("failed to get subscribers of channel %s: %v", p.ChannelID, err)
+		}
+		for _, userID := range userIDs {
+			feedcache.InvalidateUser(ctx, userID)
+		}
+	}
+
+	return nil
+}
+
+// invalidateEpisodeFeeds drops the cached feeds of the user an episode belongs to
+func invalidateEpisodeFeeds(ctx context.Context, episode models.Episode) {
+	if !feedcache.Enabled() {
+		return
+	}
+	if episode.UserID != nil {
+		feedcache.InvalidateUser(ctx, *episode.UserID)
+		return
+	}
+	if episode.SubscriptionID == nil {
+		return
+	}
+	subscription, err := db.GetSubscriptionByID(*episode.SubscriptionID)
+	if err != nil {
+		log.Printf("failed to get subscription %d to invalidate its feeds: %v", *episode.SubscriptionID, err)
+		return
+	}
+	feedcache.InvalidateUser(ctx, subscription.UserID)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// HandleRollupAnalyticsTask rolls recorded feed and audio requests up into
+// daily feed stats. Yesterday is recomputed as well, so requests from just
+// before midnight are counted.
+func (h *TaskHandler) HandleRollupAnalyticsTask(ctx context.Context, t *asynq.Task) error {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if err := db.RollupFeedStats(today.AddDate(0, 0, -1)); err != nil {
+		return fmt.Errorf("failed to roll up feed stats: %w", err)
+	}
+
+	deleted, err := db.DeleteFetchEventsBefore(today.AddDate(0, 0, -getAnalyticsRetentionDays()))
+	if err != nil {
+		return fmt.Errorf("failed to delete old fetch events: %w", err)
+	}
+	// Without their salt, the stored address hashes of past days can't be reversed
+	if err := db.DeleteAnalyticsSaltsBefore(today.AddDate(0, 0, -1)); err != nil {
+		return fmt.Errorf("failed to delete old analytics salts: %w", err)
+	}
+	log.Printf("Rolled up feed stats and deleted %d old fetch events.", deleted)
 	return nil
 }
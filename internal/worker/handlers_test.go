@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -74,19 +75,19 @@ func TestHandleCheckChannelTask(t *testing.T) {
 
 	// 6. Define mock expectations
 	sub := models.Subscription{ID: 1, UserID: 1, YoutubeChannelID: "test-channel", YoutubeChannelTitle: "Test Channel", CreatedAt: time.Now()}
-	subRows := sqlmock.NewRows([]string{"id", "user_id", "youtube_channel_id", "youtube_channel_title", "created_at"}).AddRow(sub.ID, sub.UserID, sub.YoutubeChannelID, sub.YoutubeChannelTitle, sub.CreatedAt)
+	subRows := sqlmock.NewRows([]string{"id", "user_id", "provider", "youtube_channel_id", "youtube_channel_title", "created_at"}).AddRow(sub.ID, sub.UserID, "youtube", sub.YoutubeChannelID, sub.YoutubeChannelTitle, sub.CreatedAt)
 	mock.ExpectQuery(`SELECT \* FROM subscriptions WHERE id = \$1`).WithArgs(1).WillReturnRows(subRows)
 
 	// Mock db call for IsNewChannel
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM episodes WHERE subscription_id = \$1`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
 	// Mock db call for checking if video exists and creating a new episode
-	mock.ExpectQuery(`SELECT \* FROM episodes WHERE youtube_video_id = \$1`).WithArgs("video1").WillReturnError(sql.ErrNoRows)
-	newEpisode := models.Episode{ID: 2, SubscriptionID: 1, YoutubeVideoID: "video1"}
-	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id"}).AddRow(newEpisode.ID, newEpisode.SubscriptionID, newEpisode.YoutubeVideoID)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video1").WillReturnError(sql.ErrNoRows)
+	newEpisode := models.Episode{ID: 2, SubscriptionID: intPtr(1), YoutubeVideoID: "video1"}
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id"}).AddRow(newEpisode.ID, *newEpisode.SubscriptionID, newEpisode.YoutubeVideoID)
 	mock.ExpectQuery(`INSERT INTO episodes`).WithArgs(1, "video1").WillReturnRows(epRows)
 
-	mock.ExpectQuery(`SELECT \* FROM episodes WHERE youtube_video_id = \$1`).WithArgs("video2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1)) // video2 already exists
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1)) // video2 already exists
 
 	// 7. Call the handler
 	err = handler.HandleCheckChannelTask(context.Background(), task)
@@ -106,6 +107,162 @@ func TestHandleCheckChannelTask(t *testing.T) {
 	}
 }
 
+func TestHandleCheckChannelTaskPlaylist(t *testing.T) {
+	t.Setenv("YOUTUBE_REQUEST_DELAY_SECONDS", "0")
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	sqlxDB := sqlx.NewDb(mockDb, "sqlmock")
+	originalDB := db.DB
+	db.DB = sqlxDB
+	defer func() { db.DB = originalDB }()
+
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	var ytDlpArgs []string
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		ytDlpArgs = arg
+		cs := append([]string{"-test.run=TestHelperProcess", "--", name}, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "YT_DLP_ARGS=" + strings.Join(arg, " ")}
+		return cmd
+	}
+
+	mockEnqueuer := &mockTaskEnqueuer{}
+	handler := NewTaskHandler(mockEnqueuer)
+	task := asynq.NewTask(tasks.TypeCheckChannel, mustMarshal(t, tasks.CheckChannelTaskPayload{SubscriptionID: 1}))
+
+	subRows := sqlmock.NewRows([]string{"id", "user_id", "provider", "youtube_channel_id", "youtube_channel_title", "source_type", "youtube_playlist_id", "created_at"}).
+		AddRow(1, 1, "youtube", "test-channel", "Test Playlist", db.SourceTypePlaylist, "PLtest", time.Now())
+	mock.ExpectQuery(`SELECT \* FROM subscriptions WHERE id = \$1`).WithArgs(1).WillReturnRows(subRows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM episodes WHERE subscription_id = \$1`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	// video1 is known but moved in the playlist
+	existingRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "playlist_position"}).AddRow(5, 1, "video1", 4)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video1").WillReturnRows(existingRows)
+	mock.ExpectExec(`UPDATE episodes SET playlist_position = \$1 WHERE id = \$2`).WithArgs(1, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// video2 is old, but playlists keep every entry
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video2").WillReturnError(sql.ErrNoRows)
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "playlist_position"}).AddRow(6, 1, "video2", 2)
+	mock.ExpectQuery(`INSERT INTO episodes \(subscription_id, youtube_video_id, playlist_position\)`).WithArgs(1, "video2", 2).WillReturnRows(epRows)
+
+	err = handler.HandleCheckChannelTask(context.Background(), task)
+
+	assert.NoError(t, err)
+	assert.Contains(t, ytDlpArgs, "https://www.youtube.com/playlist?list=PLtest")
+	assert.NotContains(t, ytDlpArgs, "--playlist-end")
+	assert.Len(t, mockEnqueuer.enqueuedTasks, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleCheckChannelTaskLongPlaylist(t *testing.T) {
+	t.Setenv("YOUTUBE_REQUEST_DELAY_SECONDS", "0")
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	sqlxDB := sqlx.NewDb(mockDb, "sqlmock")
+	originalDB := db.DB
+	db.DB = sqlxDB
+	defer func() { db.DB = originalDB }()
+
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cs := append([]string{"-test.run=TestHelperProcess", "--", name}, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "YT_DLP_ARGS=" + strings.Join(arg, " ")}
+		return cmd
+	}
+
+	mockEnqueuer := &mockTaskEnqueuer{}
+	handler := NewTaskHandler(mockEnqueuer)
+	task := asynq.NewTask(tasks.TypeCheckChannel, mustMarshal(t, tasks.CheckChannelTaskPayload{SubscriptionID: 1}))
+
+	subRows := sqlmock.NewRows([]string{"id", "user_id", "provider", "youtube_channel_id", "youtube_channel_title", "source_type", "youtube_playlist_id", "created_at"}).
+		AddRow(1, 1, "youtube", "test-channel", "Long Playlist", db.SourceTypePlaylist, "PLlong", time.Now())
+	mock.ExpectQuery(`SELECT \* FROM subscriptions WHERE id = \$1`).WithArgs(1).WillReturnRows(subRows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM episodes WHERE subscription_id = \$1`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(50))
+
+	// The first check imported entries 1-50; this one imports the next 50
+	for i := 1; i <= 100; i++ {
+		videoID := fmt.Sprintf("video%d", i)
+		query := mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, videoID)
+		if i <= 50 {
+			query.WillReturnRows(sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "playlist_position"}).AddRow(i, 1, videoID, i))
+			continue
+		}
+		query.WillReturnError(sql.ErrNoRows)
+		epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "playlist_position"}).AddRow(i, 1, videoID, i)
+		mock.ExpectQuery(`INSERT INTO episodes \(subscription_id, youtube_video_id, playlist_position\)`).WithArgs(1, videoID, i).WillReturnRows(epRows)
+	}
+
+	err = handler.HandleCheckChannelTask(context.Background(), task)
+
+	assert.NoError(t, err)
+	assert.Len(t, mockEnqueuer.enqueuedTasks, 50)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleCheckChannelTaskOnDemand(t *testing.T) {
+	t.Setenv("YOUTUBE_REQUEST_DELAY_SECONDS", "0")
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	sqlxDB := sqlx.NewDb(mockDb, "sqlmock")
+	originalDB := db.DB
+	db.DB = sqlxDB
+	defer func() { db.DB = originalDB }()
+
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cs := append([]string{"-test.run=TestHelperProcess", "--", name}, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "YT_DLP_ARGS=" + strings.Join(arg, " ")}
+		return cmd
+	}
+
+	mockEnqueuer := &mockTaskEnqueuer{}
+	handler := NewTaskHandler(mockEnqueuer)
+	task := asynq.NewTask(tasks.TypeCheckChannel, mustMarshal(t, tasks.CheckChannelTaskPayload{SubscriptionID: 1}))
+
+	subRows := sqlmock.NewRows([]string{"id", "user_id", "provider", "youtube_channel_id", "youtube_channel_title", "on_demand", "created_at"}).
+		AddRow(1, 1, "youtube", "test-channel", "Test Channel", true, time.Now())
+	mock.ExpectQuery(`SELECT \* FROM subscriptions WHERE id = \$1`).WithArgs(1).WillReturnRows(subRows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM episodes WHERE subscription_id = \$1`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	// video1 is only listed, with what the channel listing says about it
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video1").WillReturnError(sql.ErrNoRows)
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "status", "on_demand"}).AddRow(6, 1, "video1", db.StatusOnDemand, true)
+	mock.ExpectQuery(`INSERT INTO episodes (.+) 'ON_DEMAND', TRUE FROM subscriptions`).
+		WithArgs(1, "video1", nil, "Video 1", "", 0, sqlmock.AnyArg()).WillReturnRows(epRows)
+
+	// video2 is too old for the feed
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video2").WillReturnError(sql.ErrNoRows)
+
+	err = handler.HandleCheckChannelTask(context.Background(), task)
+
+	assert.NoError(t, err)
+	assert.Empty(t, mockEnqueuer.enqueuedTasks)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestHandleProcessVideoTask(t *testing.T) {
 	// 1. Setup mock database
 	mockDb, mock, err := sqlmock.New()
@@ -155,12 +312,13 @@ func TestHandleProcessVideoTask(t *testing.T) {
 	task := asynq.NewTask(tasks.TypeProcessVideo, mustMarshal(t, taskPayload))
 
 	// 5. Define mock expectations
-	episode := models.Episode{ID: 1, SubscriptionID: 1, YoutubeVideoID: "video1", AudioUUID: "test-uuid"}
-	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "audio_uuid"}).AddRow(episode.ID, episode.SubscriptionID, episode.YoutubeVideoID, episode.AudioUUID)
-	mock.ExpectQuery(`SELECT \* FROM episodes WHERE youtube_video_id = \$1`).WithArgs("video1").WillReturnRows(epRows)
+	episode := models.Episode{ID: 1, SubscriptionID: intPtr(1), YoutubeVideoID: "video1", AudioUUID: "test-uuid"}
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "provider", "youtube_video_id", "audio_uuid"}).AddRow(episode.ID, *episode.SubscriptionID, "youtube", episode.YoutubeVideoID, episode.AudioUUID)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(1, "video1").WillReturnRows(epRows)
 
-	mock.ExpectExec(`UPDATE episodes SET status = \$1 WHERE id = \$2`).WithArgs(db.StatusProcessing, episode.ID).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(`UPDATE episodes SET status = 'COMPLETED', title = \$1, description = \$2, audio_path = \$3, audio_size_bytes = \$4, duration_seconds = \$5, published_at = \$6 WHERE id = \$7`).WithArgs("Test Title", "Test Description", "audio/test-uuid.m4a", int64(16), 123, sqlmock.AnyArg(), episode.ID).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE episodes SET status = \$1, updated_at = NOW\(\) WHERE id = \$2`).WithArgs(db.StatusProcessing, episode.ID).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE provider = \$1 AND youtube_video_id = \$2 AND id <> \$3`).WithArgs("youtube", "video1", episode.ID).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`UPDATE episodes SET status = 'COMPLETED', title = \$1, description = \$2, audio_path = \$3, audio_size_bytes = \$4, duration_seconds = \$5, published_at = \$6, updated_at = NOW\(\) WHERE id = \$7`).WithArgs("Test Title", "Test Description", "audio/test-uuid.m4a", int64(16), 123, sqlmock.AnyArg(), episode.ID).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// 6. Call the handler
 	err = handler.HandleProcessVideoTask(context.Background(), task)
@@ -173,6 +331,193 @@ func TestHandleProcessVideoTask(t *testing.T) {
 	}
 }
 
+func TestHandleProcessVideoTaskOnDemandSkipsDelay(t *testing.T) {
+	// A listener waits for on-demand fetches, which can't sit out the request delay
+	t.Setenv("YOUTUBE_REQUEST_DELAY_SECONDS", "30")
+
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	originalDB := db.DB
+	db.DB = sqlx.NewDb(mockDb, "sqlmock")
+	defer func() { db.DB = originalDB }()
+
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cs := append([]string{"-test.run=TestHelperProcess", "--", name}, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "YT_DLP_ARGS=" + strings.Join(arg, " ")}
+		return cmd
+	}
+
+	assert.NoError(t, os.MkdirAll("audio", 0755))
+	assert.NoError(t, os.WriteFile("audio/on-demand-uuid.m4a", []byte("dummy audio data"), 0644))
+	defer os.Remove("audio/on-demand-uuid.m4a")
+
+	handler := NewTaskHandler(nil)
+	task, err := tasks.NewOnDemandEpisodeTask(7, "video1")
+	assert.NoError(t, err)
+
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "provider", "youtube_video_id", "audio_uuid", "status", "on_demand"}).
+		AddRow(7, 1, "youtube", "video1", "on-demand-uuid", db.StatusPending, true)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE id = \$1`).WithArgs(7).WillReturnRows(epRows)
+	mock.ExpectExec(`UPDATE episodes SET status = \$1, updated_at = NOW\(\) WHERE id = \$2`).WithArgs(db.StatusProcessing, 7).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE provider = \$1 AND youtube_video_id = \$2 AND id <> \$3`).WithArgs("youtube", "video1", 7).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`UPDATE episodes SET status = 'COMPLETED'`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	start := time.Now()
+	err = handler.HandleProcessVideoTask(context.Background(), task)
+
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleProcessVideoTaskReusesStoredAudio(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	originalDB := db.DB
+	db.DB = sqlx.NewDb(mockDb, "sqlmock")
+	defer func() { db.DB = originalDB }()
+
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		t.Errorf("unexpected %s call for a video that is already stored", name)
+		return exec.Command("false")
+	}
+
+	// video1 was already fetched for the channel subscription when its playlist lists it
+	assert.NoError(t, os.MkdirAll("audio", 0755))
+	assert.NoError(t, os.WriteFile("audio/channel-uuid.m4a", []byte("dummy audio data"), 0644))
+	defer os.Remove("audio/channel-uuid.m4a")
+	defer os.Remove("audio/playlist-uuid.m4a")
+
+	handler := NewTaskHandler(nil)
+	task := asynq.NewTask(tasks.TypeProcessVideo, mustMarshal(t, tasks.ProcessVideoTaskPayload{YoutubeVideoID: "video1", SubscriptionID: 2}))
+
+	epRows := sqlmock.NewRows([]string{"id", "subscription_id", "provider", "youtube_video_id", "audio_uuid"}).AddRow(2, 2, "youtube", "video1", "playlist-uuid")
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE subscription_id = \$1 AND youtube_video_id = \$2`).WithArgs(2, "video1").WillReturnRows(epRows)
+	mock.ExpectExec(`UPDATE episodes SET status = \$1, updated_at = NOW\(\) WHERE id = \$2`).WithArgs(db.StatusProcessing, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	storedRows := sqlmock.NewRows([]string{"id", "subscription_id", "provider", "youtube_video_id", "audio_uuid", "audio_path", "status"}).
+		AddRow(1, 1, "youtube", "video1", "channel-uuid", "audio/channel-uuid.m4a", db.StatusCompleted)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE provider = \$1 AND youtube_video_id = \$2 AND id <> \$3`).WithArgs("youtube", "video1", 2).WillReturnRows(storedRows)
+	mock.ExpectExec(`UPDATE episodes e SET status = 'COMPLETED', title = s.title`).WithArgs(2, 1, "audio/playlist-uuid.m4a").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = handler.HandleProcessVideoTask(context.Background(), task)
+
+	assert.NoError(t, err)
+	data, err := os.ReadFile("audio/playlist-uuid.m4a")
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy audio data", string(data))
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPackageHLS(t *testing.T) {
+	originalExecCommandContext := execCommandContext
+	defer func() { execCommandContext = originalExecCommandContext }()
+	var ranName string
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		ranName = name
+		cs := append([]string{"-test.run=TestHelperProcess", "--", name}, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "YT_DLP_ARGS=" + strings.Join(arg, " ")}
+		return cmd
+	}
+
+	dir := filepath.Join(t.TempDir(), "hls", "test-uuid")
+	// A rendition left from an earlier run is replaced
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "seg00099.m4s"), []byte("stale"), 0644))
+
+	err := packageHLS(context.Background(), "audio/test-uuid.m4a", dir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ffmpeg", ranName)
+	playlist, err := os.ReadFile(filepath.Join(dir, "index.m3u8"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n", string(playlist))
+	_, err = os.Stat(filepath.Join(dir, "seg00099.m4s"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dir + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHandleRetryFailedEpisodesTask(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	originalDB := db.DB
+	db.DB = sqlx.NewDb(mockDb, "sqlmock")
+	defer func() { db.DB = originalDB }()
+
+	mockEnqueuer := &mockTaskEnqueuer{}
+	handler := NewTaskHandler(mockEnqueuer)
+
+	// Episode 1 failed to download, episode 2 failed to fetch on demand
+	failedAt := time.Now().Add(-2 * time.Hour)
+	rows := sqlmock.NewRows([]string{"id", "subscription_id", "youtube_video_id", "status", "on_demand", "updated_at"}).
+		AddRow(1, 1, "video1", db.StatusFailed, false, failedAt).
+		AddRow(2, 1, "video2", db.StatusFailed, true, failedAt)
+	mock.ExpectQuery(`SELECT \* FROM episodes WHERE status = 'FAILED' AND updated_at < \$1 ORDER BY updated_at ASC LIMIT 50`).
+		WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE episodes SET status = \$1, updated_at = NOW\(\) WHERE id = \$2`).WithArgs(db.StatusPending, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE episodes SET status = \$1, updated_at = NOW\(\) WHERE id = \$2`).WithArgs(db.StatusOnDemand, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = handler.HandleRetryFailedEpisodesTask(context.Background(), asynq.NewTask(tasks.TypeRetryFailedEpisodes, nil))
+
+	assert.NoError(t, err)
+	// The on-demand episode waits for its next request instead of being fetched now
+	assert.Len(t, mockEnqueuer.enqueuedTasks, 1)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleRefreshAllChannelsTask(t *testing.T) {
+	mockDb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mockDb.Close()
+	originalDB := db.DB
+	db.DB = sqlx.NewDb(mockDb, "sqlmock")
+	defer func() { db.DB = originalDB }()
+
+	channelRows := sqlmock.NewRows([]string{"provider", "youtube_channel_id", "title", "status", "refreshed_at"}).
+		AddRow("youtube", "UC-new", "", "active", nil).
+		AddRow("youtube", "UC-old", "Old Channel", "renamed", time.Now().Add(-48*time.Hour))
+	mock.ExpectQuery(`SELECT (.+) FROM \((.+)WHERE c.status IS DISTINCT FROM 'terminated' OR c.refreshed_at < \$2`).WithArgs(50, sqlmock.AnyArg()).WillReturnRows(channelRows)
+
+	mockEnqueuer := &mockTaskEnqueuer{}
+	handler := NewTaskHandler(mockEnqueuer)
+
+	err = handler.HandleRefreshAllChannelsTask(context.Background(), asynq.NewTask(tasks.TypeRefreshAllChannels, nil))
+
+	assert.NoError(t, err)
+	if assert.Len(t, mockEnqueuer.enqueuedTasks, 2) {
+		var p tasks.RefreshChannelTaskPayload
+		assert.Equal(t, tasks.TypeRefreshChannel, mockEnqueuer.enqueuedTasks[0].Type())
+		assert.NoError(t, json.Unmarshal(mockEnqueuer.enqueuedTasks[0].Payload(), &p))
+		assert.Equal(t, tasks.RefreshChannelTaskPayload{Provider: "youtube", ChannelID: "UC-new"}, p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 // TestHelperProcess isn't a real test. It's used as a helper for tests that
 // need to mock exec.Command.
 func TestHelperProcess(t *testing.T) {
@@ -181,10 +526,23 @@ func TestHelperProcess(t *testing.T) {
 	}
 	args := strings.Split(os.Getenv("YT_DLP_ARGS"), " ")
 
+	if contains(args, "https://www.youtube.com/playlist?list=PLlong") {
+		for i := 1; i <= 120; i++ {
+			fmt.Println(fmt.Sprintf(`{"id": "video%d", "title": "Video %d", "upload_date": "20200101", "playlist_index": %d}`, i, i, i))
+		}
+		os.Exit(0)
+	}
+
 	if contains(args, "--flat-playlist") {
 		today := time.Now().Format("20060102")
-		fmt.Println(fmt.Sprintf(`{"id": "video1", "title": "Video 1", "upload_date": "%s"}`, today))
-		fmt.Println(`{"id": "video2", "title": "Video 2", "upload_date": "20200101"}`)
+		fmt.Println(fmt.Sprintf(`{"id": "video1", "title": "Video 1", "upload_date": "%s", "playlist_index": 1}`, today))
+		fmt.Println(`{"id": "video2", "title": "Video 2", "upload_date": "20200101", "playlist_index": 2}`)
+		os.Exit(0)
+	}
+
+	if contains(args, "hls") { // HLS packaging command writes its playlist last
+		playlist := args[len(args)-1]
+		os.WriteFile(playlist, []byte("#EXTM3U\n"), 0644)
 		os.Exit(0)
 	}
 
@@ -213,6 +571,10 @@ func mustMarshal(t *testing.T, v interface{}) []byte {
 	return b
 }
 
+func intPtr(i int) *int {
+	return &i
+}
+
 func contains(s []string, str string) bool {
 	for _, v := range s {
 		if v == str {
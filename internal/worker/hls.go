@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hlsSegmentSeconds is the target length of HLS segments
+const hlsSegmentSeconds = 6
+
+// getHLSEnabled reports whether episodes are also packaged as HLS for the Mini App player
+func getHLSEnabled() bool {
+	enabled := false
+	if env := os.Getenv("HLS_ENABLED"); env != "" {
+		if val, err := strconv.ParseBool(env); err == nil {
+			enabled = val
+		}
+	}
+	return enabled
+}
+
+// hlsDir is where the HLS rendition of an episode is stored, next to its audio
+func hlsDir(audioUUID string) string {
+	return filepath.Join("audio", "hls", audioUUID)
+}
+
+// packageHLS splits an m4a file into fMP4 segments and an index.m3u8 playlist
+// in dir without re-encoding. The rendition is made in a temporary directory
+// and moved into place, so a failed run leaves no partial playlist behind.
+func packageHLS(ctx context.Context, audioPath string, dir string) error {
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-nostdin", "-loglevel", "error",
+		"-i", audioPath,
+		"-vn", "-c:a", "copy",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(tmp, "seg%05d.m4s"),
+		filepath.Join(tmp, "index.m3u8"),
+	}
+	output, err := execCommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
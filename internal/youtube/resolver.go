@@ -0,0 +1,370 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"yt-podcaster/internal/ytdlp"
+)
+
+var ErrUnresolved = errors.New("could not resolve YouTube reference")
+
+// ChannelInfo is what resolving a channel or playlist reference yields. For
+// playlists Title is the playlist title and ChannelID its owner, which may be
+// empty for ownerless playlists such as mixes.
+type ChannelInfo struct {
+	ChannelID string
+	Title     string
+}
+
+// ChannelResolver turns a channel or playlist reference into a channel ID and title.
+type ChannelResolver interface {
+	Resolve(ctx context.Context, ref Ref) (ChannelInfo, error)
+}
+
+// Strategy is one way of learning about a reference. It fills in whatever it
+// can on top of what earlier strategies in a chain already found.
+type Strategy interface {
+	Name() string
+	Apply(ctx context.Context, ref Ref, info *ChannelInfo) error
+}
+
+// Chain runs strategies in order until the reference is fully resolved.
+type Chain []Strategy
+
+// NewDefaultResolver returns the production chain: the ID embedded in the URL,
+// the Atom feed, page metadata and finally yt-dlp.
+func NewDefaultResolver(client *http.Client) Chain {
+	return Chain{
+		EmbeddedID{},
+		AtomFeed{Client: client, Budget: ytdlp.WaitForBudget},
+		PageMetadata{Client: client, Budget: ytdlp.WaitForBudget},
+		YtDlp{},
+	}
+}
+
+func (c Chain) Resolve(ctx context.Context, ref Ref) (ChannelInfo, error) {
+	if !ref.IsSource() {
+		return ChannelInfo{}, fmt.Errorf("%w: %s is not a channel or playlist", ErrUnresolved, ref)
+	}
+
+	var info ChannelInfo
+	var lastErr error
+	for _, strategy := range c {
+		if err := strategy.Apply(ctx, ref, &info); err != nil {
+			log.Printf("Resolver strategy %s failed for %s: %v", strategy.Name(), ref, err)
+			lastErr = err
+		}
+		if info.complete() {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// Playlists without an owner are still usable
+	if ref.Kind == KindPlaylist && info.Title != "" {
+		return info, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("channel ID found: %v, title found: %v", info.ChannelID != "", info.Title != "")
+	}
+	return ChannelInfo{}, fmt.Errorf("%w %s: %v", ErrUnresolved, ref, lastErr)
+}
+
+func (i ChannelInfo) complete() bool {
+	return i.ChannelID != "" && i.Title != ""
+}
+
+// setChannelID only accepts well-formed channel IDs and never overwrites an earlier find
+func (i *ChannelInfo) setChannelID(id string) {
+	if i.ChannelID == "" && channelIDPattern.MatchString(id) {
+		i.ChannelID = id
+	}
+}
+
+func (i *ChannelInfo) setTitle(title string) {
+	title = strings.TrimSpace(title)
+	if i.Title == "" && title != "" && title != "YouTube" && title != "NA" {
+		i.Title = title
+	}
+}
+
+// EmbeddedID takes the channel ID straight from /channel/UC... references.
+type EmbeddedID struct{}
+
+func (EmbeddedID) Name() string { return "embedded-id" }
+
+func (EmbeddedID) Apply(ctx context.Context, ref Ref, info *ChannelInfo) error {
+	if ref.Kind == KindChannel {
+		info.setChannelID(ref.ID)
+	}
+	return nil
+}
+
+// AtomFeed reads the public videos.xml feed, which exists for channel IDs,
+// legacy user names and playlists and carries both the channel ID and title.
+type AtomFeed struct {
+	Client *http.Client
+	// BaseURL overrides https://www.youtube.com in tests
+	BaseURL string
+	// Budget, if set, is waited on before each request
+	Budget func(ctx context.Context) error
+}
+
+type atomFeed struct {
+	ChannelID string `xml:"http://www.youtube.com/xml/schemas/2015 channelId"`
+	Title     string `xml:"title"`
+	Author    string `xml:"author>name"`
+}
+
+func (AtomFeed) Name() string { return "atom-feed" }
+
+func (s AtomFeed) Apply(ctx context.Context, ref Ref, info *ChannelInfo) error {
+	query := url.Values{}
+	switch {
+	case ref.Kind == KindPlaylist:
+		query.Set("playlist_id", ref.ID)
+	case info.ChannelID != "":
+		query.Set("channel_id", info.ChannelID)
+	case ref.Kind == KindUser:
+		query.Set("user", ref.ID)
+	default:
+		// Handles and custom URLs have no feed until their channel ID is known
+		return nil
+	}
+
+	body, err := fetch(ctx, s.Client, s.Budget, baseURL(s.BaseURL)+"/feeds/videos.xml?"+query.Encode(), "application/atom+xml")
+	if err != nil {
+		return err
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	info.setChannelID(feed.ChannelID)
+	info.setTitle(feed.Title)
+	return nil
+}
+
+// PageMetadata reads the canonical link and Open Graph tags of the YouTube
+// page. Unlike the JSON blobs embedded in the page these are stable.
+type PageMetadata struct {
+	Client *http.Client
+	// BaseURL overrides https://www.youtube.com in tests
+	BaseURL string
+	// Budget, if set, is waited on before each request
+	Budget func(ctx context.Context) error
+}
+
+var (
+	pageTagPattern  = regexp.MustCompile(`(?is)<(?:meta|link)\s[^>]*>`)
+	pageAttrPattern = regexp.MustCompile(`(?s)([a-zA-Z:-]+)\s*=\s*"([^"]*)"`)
+)
+
+func (PageMetadata) Name() string { return "page-metadata" }
+
+func (s PageMetadata) Apply(ctx context.Context, ref Ref, info *ChannelInfo) error {
+	pageURL := strings.Replace(ref.Canonical(), "https://www.youtube.com", baseURL(s.BaseURL), 1)
+	separator := "?"
+	if strings.Contains(pageURL, "?") {
+		separator = "&"
+	}
+	// Forcing the locale keeps EU visitors off the cookie consent page
+	body, err := fetch(ctx, s.Client, s.Budget, pageURL+separator+"hl=en&gl=US", "text/html")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(body), "consent.youtube.com") {
+		return errors.New("got cookie consent page")
+	}
+
+	tags := parsePageTags(string(body))
+	if ref.Kind != KindPlaylist {
+		info.setChannelID(channelIDFromURL(tags["canonical"]))
+		info.setChannelID(channelIDFromURL(tags["og:url"]))
+		info.setChannelID(tags["identifier"])
+		info.setChannelID(tags["channelId"])
+	}
+	info.setTitle(tags["og:title"])
+	info.setTitle(tags["title"])
+	return nil
+}
+
+// parsePageTags maps meta names, properties and itemprops and link rels to their values
+func parsePageTags(page string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range pageTagPattern.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, match := range pageAttrPattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(match[1])] = html.UnescapeString(match[2])
+		}
+		value := attrs["content"]
+		if href, ok := attrs["href"]; ok {
+			value = href
+		}
+		for _, key := range []string{attrs["property"], attrs["name"], attrs["itemprop"], attrs["rel"]} {
+			if _, seen := tags[key]; key != "" && !seen {
+				tags[key] = value
+			}
+		}
+	}
+	return tags
+}
+
+// channelIDFromURL returns the channel ID of a /channel/UC... URL
+func channelIDFromURL(channelURL string) string {
+	ref, err := Parse(channelURL)
+	if err != nil || ref.Kind != KindChannel {
+		return ""
+	}
+	return ref.ID
+}
+
+// YtDlp asks yt-dlp for the reference's metadata. It is the slowest strategy
+// but survives page markup changes.
+type YtDlp struct {
+	// Run overrides ytdlp.DumpSingleJSON in tests
+	Run func(ctx context.Context, url string, extraArgs ...string) ([]byte, error)
+}
+
+type ytDlpInfo struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Channel   string `json:"channel"`
+	ChannelID string `json:"channel_id"`
+	Uploader  string `json:"uploader"`
+}
+
+func (YtDlp) Name() string { return "yt-dlp" }
+
+func (s YtDlp) Apply(ctx context.Context, ref Ref, info *ChannelInfo) error {
+	run := s.Run
+	if run == nil {
+		run = ytdlp.DumpSingleJSON
+	}
+	output, err := run(ctx, ref.Canonical(), "--playlist-items", "0")
+	if err != nil {
+		return err
+	}
+
+	var meta ytDlpInfo
+	if err := json.Unmarshal(output, &meta); err != nil {
+		return fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+
+	info.setChannelID(meta.ChannelID)
+	if ref.Kind == KindPlaylist {
+		info.setTitle(meta.Title)
+		return nil
+	}
+	info.setChannelID(meta.ID)
+	info.setTitle(meta.Channel)
+	info.setTitle(meta.Uploader)
+	return nil
+}
+
+func baseURL(override string) string {
+	if override != "" {
+		return strings.TrimSuffix(override, "/")
+	}
+	return "https://www.youtube.com"
+}
+
+// fetch GETs a YouTube URL with browser-like headers and returns the body
+func fetch(ctx context.Context, client *http.Client, budget func(context.Context) error, fetchURL, accept string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if budget != nil {
+		if err := budget(ctx); err != nil {
+			return nil, fmt.Errorf("YouTube request budget: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d for %s", resp.StatusCode, fetchURL)
+	}
+
+	// Channel pages are large but the head with the metadata comes first
+	return io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+}
+
+// Cache persists resolutions between calls.
+type Cache interface {
+	// Get returns nil without error when ref was never resolved
+	Get(ref Ref) (*CacheEntry, error)
+	Put(ref Ref, info ChannelInfo) error
+}
+
+type CacheEntry struct {
+	Info       ChannelInfo
+	ResolvedAt time.Time
+}
+
+// CachedResolver answers from Cache while entries are younger than TTL and
+// stores fresh resolutions from Next.
+type CachedResolver struct {
+	Next  ChannelResolver
+	Cache Cache
+	TTL   time.Duration
+	// now can be replaced in tests
+	now func() time.Time
+}
+
+func NewCachedResolver(next ChannelResolver, cache Cache, ttl time.Duration) *CachedResolver {
+	return &CachedResolver{Next: next, Cache: cache, TTL: ttl, now: time.Now}
+}
+
+func (c *CachedResolver) Resolve(ctx context.Context, ref Ref) (ChannelInfo, error) {
+	entry, err := c.Cache.Get(ref)
+	if err != nil {
+		log.Printf("Error reading channel resolution cache for %s: %v", ref, err)
+	}
+	if entry != nil && c.now().Sub(entry.ResolvedAt) < c.TTL {
+		return entry.Info, nil
+	}
+
+	info, err := c.Next.Resolve(ctx, ref)
+	if err != nil {
+		// A stale answer beats none when YouTube is unreachable
+		if entry != nil {
+			log.Printf("Using stale channel resolution for %s: %v", ref, err)
+			return entry.Info, nil
+		}
+		return ChannelInfo{}, err
+	}
+
+	if err := c.Cache.Put(ref, info); err != nil {
+		log.Printf("Error writing channel resolution cache for %s: %v", ref, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,153 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureServer serves recorded YouTube responses from testdata by path
+func fixtureServer(t *testing.T, routes map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := routes[r.URL.Path+"?"+r.URL.RawQuery]
+		if !ok {
+			fixture, ok = routes[r.URL.Path]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile("testdata/" + fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func noYtDlp(ctx context.Context, url string, extraArgs ...string) ([]byte, error) {
+	return nil, errors.New("yt-dlp should not be called")
+}
+
+func TestChainResolvesChannelIDFromFeed(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/feeds/videos.xml?channel_id=UCHnyfMqiRRG1u-2MsSQLbXA": "channel_feed.xml",
+	})
+	chain := Chain{EmbeddedID{}, AtomFeed{BaseURL: srv.URL}, PageMetadata{BaseURL: srv.URL}, YtDlp{Run: noYtDlp}}
+
+	info, err := chain.Resolve(context.Background(), Ref{KindChannel, "UCHnyfMqiRRG1u-2MsSQLbXA"})
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelInfo{ChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA", Title: "Veritasium"}, info)
+}
+
+func TestChainResolvesHandleFromPageMetadata(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/@veritasium": "handle_page.html",
+	})
+	chain := Chain{EmbeddedID{}, AtomFeed{BaseURL: srv.URL}, PageMetadata{BaseURL: srv.URL}, YtDlp{Run: noYtDlp}}
+
+	info, err := chain.Resolve(context.Background(), Ref{KindHandle, "veritasium"})
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelInfo{ChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA", Title: "Veritasium"}, info)
+}
+
+func TestChainResolvesPlaylistFromFeed(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/feeds/videos.xml?playlist_id=PLkahZjV5wKe_ELLpeNbvyOqo2b6-2vVsj": "playlist_feed.xml",
+	})
+	chain := Chain{EmbeddedID{}, AtomFeed{BaseURL: srv.URL}, PageMetadata{BaseURL: srv.URL}, YtDlp{Run: noYtDlp}}
+
+	info, err := chain.Resolve(context.Background(), Ref{KindPlaylist, "PLkahZjV5wKe_ELLpeNbvyOqo2b6-2vVsj"})
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelInfo{ChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA", Title: "Physics & Engineering"}, info)
+}
+
+func TestChainFallsBackToYtDlp(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{
+		"/@veritasium": "consent_page.html",
+	})
+	output, err := os.ReadFile("testdata/ytdlp_channel.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calledWith string
+	run := func(ctx context.Context, url string, extraArgs ...string) ([]byte, error) {
+		calledWith = url
+		return output, nil
+	}
+	chain := Chain{EmbeddedID{}, AtomFeed{BaseURL: srv.URL}, PageMetadata{BaseURL: srv.URL}, YtDlp{Run: run}}
+
+	info, err := chain.Resolve(context.Background(), Ref{KindHandle, "veritasium"})
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelInfo{ChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA", Title: "Veritasium"}, info)
+	assert.Equal(t, "https://www.youtube.com/@veritasium", calledWith)
+}
+
+func TestChainUnresolved(t *testing.T) {
+	srv := fixtureServer(t, map[string]string{})
+	chain := Chain{EmbeddedID{}, AtomFeed{BaseURL: srv.URL}, PageMetadata{BaseURL: srv.URL}, YtDlp{Run: noYtDlp}}
+
+	_, err := chain.Resolve(context.Background(), Ref{KindHandle, "doesnotexist"})
+	assert.ErrorIs(t, err, ErrUnresolved)
+
+	_, err = chain.Resolve(context.Background(), Ref{KindVideo, "dQw4w9WgXcQ"})
+	assert.ErrorIs(t, err, ErrUnresolved)
+}
+
+type memoryCache map[Ref]*CacheEntry
+
+func (m memoryCache) Get(ref Ref) (*CacheEntry, error) { return m[ref], nil }
+
+func (m memoryCache) Put(ref Ref, info ChannelInfo) error {
+	m[ref] = &CacheEntry{Info: info, ResolvedAt: time.Now()}
+	return nil
+}
+
+type countingResolver struct {
+	calls int
+	info  ChannelInfo
+	err   error
+}
+
+func (c *countingResolver) Resolve(ctx context.Context, ref Ref) (ChannelInfo, error) {
+	c.calls++
+	return c.info, c.err
+}
+
+func TestCachedResolver(t *testing.T) {
+	ref := Ref{KindHandle, "veritasium"}
+	next := &countingResolver{info: ChannelInfo{ChannelID: "UCHnyfMqiRRG1u-2MsSQLbXA", Title: "Veritasium"}}
+	cache := memoryCache{}
+	resolver := NewCachedResolver(next, cache, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		info, err := resolver.Resolve(context.Background(), ref)
+		assert.NoError(t, err)
+		assert.Equal(t, next.info, info)
+	}
+	assert.Equal(t, 1, next.calls)
+
+	// Expired entries are resolved again
+	resolver.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err := resolver.Resolve(context.Background(), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, next.calls)
+
+	// and served stale when resolving fails
+	next.err = ErrUnresolved
+	info, err := resolver.Resolve(context.Background(), ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "Veritasium", info.Title)
+
+	_, err = resolver.Resolve(context.Background(), Ref{KindHandle, "other"})
+	assert.ErrorIs(t, err, ErrUnresolved)
+}
@@ -0,0 +1,162 @@
+// Package youtube parses the many shapes of YouTube links users paste into typed references.
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Kind is the type of YouTube resource a reference points to.
+type Kind string
+
+const (
+	KindChannel  Kind = "channel"
+	KindHandle   Kind = "handle"
+	KindUser     Kind = "user"
+	KindCustom   Kind = "custom"
+	KindPlaylist Kind = "playlist"
+	KindVideo    Kind = "video"
+)
+
+var ErrInvalid = errors.New("not a valid YouTube reference")
+
+// Ref is a parsed YouTube reference. ID is the channel ID, handle (without @),
+// user name, custom URL name, playlist ID or video ID depending on Kind.
+type Ref struct {
+	Kind Kind
+	ID   string
+}
+
+// allowedHosts are the only hosts accepted; everything is rewritten to www.youtube.com
+var allowedHosts = map[string]bool{
+	"youtube.com":       true,
+	"www.youtube.com":   true,
+	"m.youtube.com":     true,
+	"music.youtube.com": true,
+	"youtu.be":          true,
+}
+
+var (
+	channelIDPattern  = regexp.MustCompile(`^UC[a-zA-Z0-9_-]{22}$`)
+	handlePattern     = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,30}$`)
+	namePattern       = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,100}$`)
+	playlistIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{2,64}$`)
+	videoIDPattern    = regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
+)
+
+// Parse turns user input into a Ref. It accepts full URLs with or without scheme,
+// mobile, music and short (youtu.be) hosts, trailing tabs like /featured or /videos,
+// tracking parameters, bare @handles and bare channel IDs.
+func Parse(input string) (Ref, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return Ref{}, ErrInvalid
+	}
+
+	if strings.HasPrefix(input, "@") {
+		return newRef(KindHandle, strings.TrimPrefix(input, "@"))
+	}
+	if channelIDPattern.MatchString(input) {
+		return Ref{Kind: KindChannel, ID: input}, nil
+	}
+
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return Ref{}, ErrInvalid
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.User != nil || u.Port() != "" {
+		return Ref{}, ErrInvalid
+	}
+	host := strings.ToLower(u.Hostname())
+	if !allowedHosts[host] {
+		return Ref{}, fmt.Errorf("%w: host %q is not allowed", ErrInvalid, host)
+	}
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	query := u.Query()
+
+	if host == "youtu.be" {
+		if len(segments) != 1 {
+			return Ref{}, ErrInvalid
+		}
+		return newRef(KindVideo, segments[0])
+	}
+
+	if len(segments) == 0 {
+		return Ref{}, ErrInvalid
+	}
+
+	switch first := segments[0]; {
+	case strings.HasPrefix(first, "@"):
+		return newRef(KindHandle, strings.TrimPrefix(first, "@"))
+	case first == "channel" && len(segments) > 1:
+		return newRef(KindChannel, segments[1])
+	case first == "user" && len(segments) > 1:
+		return newRef(KindUser, segments[1])
+	case first == "c" && len(segments) > 1:
+		return newRef(KindCustom, segments[1])
+	case first == "playlist" && len(segments) == 1:
+		return newRef(KindPlaylist, query.Get("list"))
+	case first == "watch" && len(segments) == 1:
+		return newRef(KindVideo, query.Get("v"))
+	case (first == "shorts" || first == "live" || first == "embed" || first == "v") && len(segments) > 1:
+		return newRef(KindVideo, segments[1])
+	}
+
+	return Ref{}, ErrInvalid
+}
+
+// newRef validates id for the given kind
+func newRef(kind Kind, id string) (Ref, error) {
+	var pattern *regexp.Regexp
+	switch kind {
+	case KindChannel:
+		pattern = channelIDPattern
+	case KindHandle:
+		pattern = handlePattern
+	case KindUser, KindCustom:
+		pattern = namePattern
+	case KindPlaylist:
+		pattern = playlistIDPattern
+	case KindVideo:
+		pattern = videoIDPattern
+	}
+	if pattern == nil || !pattern.MatchString(id) {
+		return Ref{}, fmt.Errorf("%w: bad %s %q", ErrInvalid, kind, id)
+	}
+	return Ref{Kind: kind, ID: id}, nil
+}
+
+// IsSource reports whether the reference can be subscribed to.
+func (r Ref) IsSource() bool {
+	return r.Kind != KindVideo && r.Kind != ""
+}
+
+// Canonical returns the canonical https://www.youtube.com URL of the reference.
+func (r Ref) Canonical() string {
+	switch r.Kind {
+	case KindChannel:
+		return "https://www.youtube.com/channel/" + r.ID
+	case KindHandle:
+		return "https://www.youtube.com/@" + r.ID
+	case KindUser:
+		return "https://www.youtube.com/user/" + r.ID
+	case KindCustom:
+		return "https://www.youtube.com/c/" + r.ID
+	case KindPlaylist:
+		return "https://www.youtube.com/playlist?list=" + r.ID
+	case KindVideo:
+		return "https://www.youtube.com/watch?v=" + r.ID
+	}
+	return ""
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%s:%s", r.Kind, r.ID)
+}
@@ -0,0 +1,109 @@
+package youtube
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Ref
+	}{
+		{"https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", Ref{KindChannel, "UC-lHJZR3Gqxm24_Vd_AJ5Yw"}},
+		{"https://music.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", Ref{KindChannel, "UC-lHJZR3Gqxm24_Vd_AJ5Yw"}},
+		{"UC-lHJZR3Gqxm24_Vd_AJ5Yw", Ref{KindChannel, "UC-lHJZR3Gqxm24_Vd_AJ5Yw"}},
+		{"youtube.com/@veritasium", Ref{KindHandle, "veritasium"}},
+		{"http://youtube.com/@veritasium", Ref{KindHandle, "veritasium"}},
+		{"https://m.youtube.com/@veritasium/featured", Ref{KindHandle, "veritasium"}},
+		{"https://www.youtube.com/@veritasium/videos?si=tracking&feature=share", Ref{KindHandle, "veritasium"}},
+		{"  @veritasium  ", Ref{KindHandle, "veritasium"}},
+		{"https://www.youtube.com/user/LinusTechTips", Ref{KindUser, "LinusTechTips"}},
+		{"https://www.youtube.com/c/LinusTechTips/about", Ref{KindCustom, "LinusTechTips"}},
+		{"https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf&si=abc", Ref{KindPlaylist, "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&t=42s", Ref{KindVideo, "dQw4w9WgXcQ"}},
+		{"https://youtu.be/dQw4w9WgXcQ?si=tracking", Ref{KindVideo, "dQw4w9WgXcQ"}},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", Ref{KindVideo, "dQw4w9WgXcQ"}},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ?feature=share", Ref{KindVideo, "dQw4w9WgXcQ"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if assert.NoError(t, err, tt.input) {
+			assert.Equal(t, tt.want, got, tt.input)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"@",
+		"@a b",
+		"ftp://www.youtube.com/@veritasium",
+		"https://youtube.com.evil.example/@veritasium",
+		"https://evil.example/youtube.com/@veritasium",
+		"https://user@www.youtube.com/@veritasium",
+		"https://www.youtube.com:8443/@veritasium",
+		"https://www.youtube.com/",
+		"https://www.youtube.com/feed/subscriptions",
+		"https://www.youtube.com/channel/not-a-channel-id",
+		"https://www.youtube.com/watch?v=short",
+		"https://youtu.be/",
+		"https://www.youtube.com/playlist",
+	} {
+		_, err := Parse(input)
+		assert.ErrorIs(t, err, ErrInvalid, input)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	assert.Equal(t, "https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw", Ref{KindChannel, "UC-lHJZR3Gqxm24_Vd_AJ5Yw"}.Canonical())
+	assert.Equal(t, "https://www.youtube.com/@veritasium", Ref{KindHandle, "veritasium"}.Canonical())
+	assert.Equal(t, "https://www.youtube.com/user/name", Ref{KindUser, "name"}.Canonical())
+	assert.Equal(t, "https://www.youtube.com/c/name", Ref{KindCustom, "name"}.Canonical())
+	assert.Equal(t, "https://www.youtube.com/playlist?list=PL123", Ref{KindPlaylist, "PL123"}.Canonical())
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Ref{KindVideo, "dQw4w9WgXcQ"}.Canonical())
+	assert.True(t, Ref{KindPlaylist, "PL123"}.IsSource())
+	assert.False(t, Ref{KindVideo, "dQw4w9WgXcQ"}.IsSource())
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"https://www.youtube.com/channel/UC-lHJZR3Gqxm24_Vd_AJ5Yw",
+		"youtube.com/@veritasium/featured",
+		"https://youtu.be/dQw4w9WgXcQ?si=x",
+		"https://www.youtube.com/playlist?list=PL123&index=2",
+		"https://m.youtube.com/watch?v=dQw4w9WgXcQ",
+		"@handle",
+		"https://evil.example/@x",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ref, err := Parse(input)
+		if err != nil {
+			return
+		}
+
+		// Canonical URLs must only ever point at www.youtube.com over https
+		canonical := ref.Canonical()
+		u, err := url.Parse(canonical)
+		if err != nil || u.Scheme != "https" || u.Host != "www.youtube.com" {
+			t.Fatalf("Parse(%q) produced non-canonical URL %q", input, canonical)
+		}
+		if strings.ContainsAny(ref.ID, "/?#&@ ") {
+			t.Fatalf("Parse(%q) produced unsafe ID %q", input, ref.ID)
+		}
+
+		// Parsing a canonical URL must give the same reference back
+		again, err := Parse(canonical)
+		if err != nil || again != ref {
+			t.Fatalf("Parse(%q) = %v, but its canonical form %q parses to %v, %v", input, ref, canonical, again, err)
+		}
+	})
+}
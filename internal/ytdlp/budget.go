@@ -0,0 +1,38 @@
+package ytdlp
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	budget     *rate.Limiter
+	budgetOnce sync.Once
+)
+
+// getRequestsPerMinute returns how many YouTube requests this process may make per minute
+func getRequestsPerMinute() float64 {
+	perMinute := 20.0 // default gentle budget
+	if env := os.Getenv("YOUTUBE_REQUESTS_PER_MINUTE"); env != "" {
+		if val, err := strconv.ParseFloat(env, 64); err == nil && val > 0 {
+			perMinute = val
+		}
+	}
+	return perMinute
+}
+
+// WaitForBudget blocks until this process's YouTube request budget allows
+// another request, or ctx is done. It covers the metadata requests made
+// through this package and the channel resolver: searches, resolution,
+// previews and channel refreshes. The worker's channel checks and downloads
+// run yt-dlp directly and are paced by YOUTUBE_REQUEST_DELAY_SECONDS instead.
+func WaitForBudget(ctx context.Context) error {
+	budgetOnce.Do(func() {
+		budget = rate.NewLimiter(rate.Limit(getRequestsPerMinute()/60.0), 5)
+	})
+	return budget.Wait(ctx)
+}
@@ -0,0 +1,113 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChannelMetadata is what yt-dlp reports about a channel's videos tab.
+type ChannelMetadata struct {
+	ID              string
+	Title           string
+	Handle          string
+	Description     string
+	AvatarURL       string
+	BannerURL       string
+	SubscriberCount int64
+	Language        string
+	// ListTitle is the title of the listing itself, e.g. the playlist title
+	ListTitle string
+	Entries   []Entry
+}
+
+// Entry is a flat-listed upload of a channel or playlist.
+type Entry struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Duration   float64 `json:"duration"`
+	UploadDate string  `json:"upload_date"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+type channelJSON struct {
+	ID                   string  `json:"id"`
+	ChannelID            string  `json:"channel_id"`
+	Channel              string  `json:"channel"`
+	Uploader             string  `json:"uploader"`
+	UploaderID           string  `json:"uploader_id"`
+	Description          string  `json:"description"`
+	ChannelFollowerCount int64   `json:"channel_follower_count"`
+	Language             string  `json:"language"`
+	Title                string  `json:"title"`
+	Entries              []Entry `json:"entries"`
+	Thumbnails           []struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	} `json:"thumbnails"`
+}
+
+// FetchChannel returns the metadata of the channel listed at channelURL.
+// It returns an error wrapping ErrUnavailable for terminated or removed channels.
+func FetchChannel(ctx context.Context, channelURL string) (*ChannelMetadata, error) {
+	output, err := DumpSingleJSON(ctx, channelURL, "--playlist-items", "0")
+	if err != nil {
+		return nil, err
+	}
+	return ParseChannel(output)
+}
+
+// ListChannel returns the metadata of the channel or playlist at listURL
+// together with its first limit entries.
+func ListChannel(ctx context.Context, listURL string, limit int) (*ChannelMetadata, error) {
+	output, err := DumpSingleJSON(ctx, listURL, "--playlist-end", strconv.Itoa(limit))
+	if err != nil {
+		return nil, err
+	}
+	return ParseChannel(output)
+}
+
+// ParseChannel parses yt-dlp --dump-single-json output of a channel.
+func ParseChannel(output []byte) (*ChannelMetadata, error) {
+	var raw channelJSON
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+
+	meta := &ChannelMetadata{
+		ID:              firstNonEmpty(raw.ChannelID, raw.ID),
+		Title:           firstNonEmpty(raw.Channel, raw.Uploader),
+		Description:     strings.TrimSpace(raw.Description),
+		SubscriberCount: raw.ChannelFollowerCount,
+		Language:        raw.Language,
+		ListTitle:       strings.TrimSpace(raw.Title),
+		Entries:         raw.Entries,
+	}
+	if strings.HasPrefix(raw.UploaderID, "@") {
+		meta.Handle = raw.UploaderID
+	}
+	for _, thumb := range raw.Thumbnails {
+		switch thumb.ID {
+		case "avatar_uncropped":
+			meta.AvatarURL = thumb.URL
+		case "banner_uncropped":
+			meta.BannerURL = thumb.URL
+		}
+	}
+
+	if meta.ID == "" || meta.Title == "" {
+		return nil, fmt.Errorf("yt-dlp output has no channel ID or title")
+	}
+	return meta, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && v != "NA" {
+			return v
+		}
+	}
+	return ""
+}
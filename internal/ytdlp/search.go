@@ -0,0 +1,152 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// channelSearchFilter is YouTube's "Type: Channel" search filter. A plain
+// ytsearch returns videos; with the filter the same search returns channels.
+const channelSearchFilter = "EgIQAg=="
+
+// maxSearchCacheEntries bounds the memory used by cached searches
+const maxSearchCacheEntries = 500
+
+// ChannelCandidate is a channel found by a search.
+type ChannelCandidate struct {
+	ID              string
+	Title           string
+	Handle          string
+	AvatarURL       string
+	SubscriberCount int64
+}
+
+type searchJSON struct {
+	Entries []struct {
+		ID                   string `json:"id"`
+		Title                string `json:"title"`
+		Channel              string `json:"channel"`
+		UploaderID           string `json:"uploader_id"`
+		ChannelFollowerCount int64  `json:"channel_follower_count"`
+		Thumbnails           []struct {
+			URL   string `json:"url"`
+			Width int    `json:"width"`
+		} `json:"thumbnails"`
+	} `json:"entries"`
+}
+
+type searchCacheEntry struct {
+	results []ChannelCandidate
+	expires time.Time
+}
+
+var searchCache = struct {
+	sync.Mutex
+	entries map[string]searchCacheEntry
+}{entries: make(map[string]searchCacheEntry)}
+
+func getSearchCacheTTL() time.Duration {
+	ttl := time.Hour
+	if env := os.Getenv("SEARCH_CACHE_TTL_MINUTES"); env != "" {
+		if val, err := strconv.Atoi(env); err == nil {
+			ttl = time.Duration(val) * time.Minute
+		}
+	}
+	return ttl
+}
+
+// SearchChannels returns up to limit YouTube channels matching query. Results are
+// cached, and only cache misses count against the request budget.
+func SearchChannels(ctx context.Context, query string, limit int) ([]ChannelCandidate, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return nil, nil
+	}
+	key := fmt.Sprintf("%d:%s", limit, strings.ToLower(query))
+
+	searchCache.Lock()
+	cached, ok := searchCache.entries[key]
+	searchCache.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.results, nil
+	}
+
+	searchURL := "https://www.youtube.com/results?" + url.Values{
+		"search_query": {query},
+		"sp":           {channelSearchFilter},
+	}.Encode()
+	output, err := DumpSingleJSON(ctx, searchURL, "--playlist-end", strconv.Itoa(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := ParseChannelSearch(output)
+	if err != nil {
+		return nil, err
+	}
+
+	searchCache.Lock()
+	defer searchCache.Unlock()
+	if len(searchCache.entries) >= maxSearchCacheEntries {
+		now := time.Now()
+		for k, entry := range searchCache.entries {
+			if now.After(entry.expires) {
+				delete(searchCache.entries, k)
+			}
+		}
+		if len(searchCache.entries) >= maxSearchCacheEntries {
+			searchCache.entries = make(map[string]searchCacheEntry)
+		}
+	}
+	searchCache.entries[key] = searchCacheEntry{results: results, expires: time.Now().Add(getSearchCacheTTL())}
+
+	return results, nil
+}
+
+// ParseChannelSearch parses yt-dlp --dump-single-json output of a channel search.
+// Entries that aren't channels are skipped.
+func ParseChannelSearch(output []byte) ([]ChannelCandidate, error) {
+	var raw searchJSON
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output: %w", err)
+	}
+
+	var results []ChannelCandidate
+	seen := make(map[string]bool)
+	for _, entry := range raw.Entries {
+		// Videos mixed into the results carry a channel_id too, but their own ID is a video ID
+		id := entry.ID
+		if !strings.HasPrefix(id, "UC") || len(id) != 24 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		candidate := ChannelCandidate{
+			ID:              id,
+			Title:           firstNonEmpty(entry.Channel, entry.Title),
+			SubscriberCount: entry.ChannelFollowerCount,
+		}
+		if strings.HasPrefix(entry.UploaderID, "@") {
+			candidate.Handle = entry.UploaderID
+		}
+		// Use the largest thumbnail; search results use protocol-relative URLs
+		width := -1
+		for _, thumb := range entry.Thumbnails {
+			if thumb.Width > width {
+				width = thumb.Width
+				candidate.AvatarURL = thumb.URL
+			}
+		}
+		if strings.HasPrefix(candidate.AvatarURL, "//") {
+			candidate.AvatarURL = "https:" + candidate.AvatarURL
+		}
+		results = append(results, candidate)
+	}
+	return results, nil
+}
@@ -0,0 +1,113 @@
+// Package ytdlp runs yt-dlp for metadata lookups with the service's common options.
+package ytdlp
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnavailable means the channel, playlist or video was terminated, removed or never existed
+var ErrUnavailable = errors.New("no longer available")
+
+// unavailableMessages are yt-dlp errors that won't go away by retrying. A bare
+// HTTP 404 isn't one of them, YouTube answers it for passing outages as well.
+var unavailableMessages = []string{
+	"has been terminated",
+	"does not exist",
+	"has been removed",
+	"no longer available",
+}
+
+// execCommandContext can be mocked in tests
+var execCommandContext = exec.CommandContext
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+
+// CommonArgs are passed to every yt-dlp call to look like a regular browser
+func CommonArgs() []string {
+	return []string{
+		"--user-agent", userAgent,
+		"--add-header", "Accept-Language:en-US,en;q=0.9",
+		"--extractor-args", "youtube:player_client=android",
+	}
+}
+
+// SetupCookieFile creates a temporary cookie file from base64 encoded environment variable
+func SetupCookieFile() (string, func(), error) {
+	cookieBase64 := os.Getenv("YOUTUBE_COOKIES_BASE64")
+	if cookieBase64 == "" {
+		// No cookies provided, return empty string to indicate no cookie file
+		return "", func() {}, nil
+	}
+
+	// Decode base64 cookie data
+	cookieData, err := base64.StdEncoding.DecodeString(cookieBase64)
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to decode base64 cookies: %w", err)
+	}
+
+	// Create temporary cookie file
+	tmpFile, err := os.CreateTemp("", "youtube_cookies_*.txt")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create temporary cookie file: %w", err)
+	}
+
+	// Write cookie data to file
+	if _, err := tmpFile.Write(cookieData); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", func() {}, fmt.Errorf("failed to write cookie data: %w", err)
+	}
+
+	tmpFile.Close()
+
+	// Return cleanup function
+	cleanup := func() {
+		os.Remove(tmpFile.Name())
+	}
+
+	return tmpFile.Name(), cleanup, nil
+}
+
+// DumpSingleJSON returns yt-dlp's --dump-single-json metadata for url without
+// downloading any media. Playlist entries are listed flat.
+func DumpSingleJSON(ctx context.Context, url string, extraArgs ...string) ([]byte, error) {
+	if err := WaitForBudget(ctx); err != nil {
+		return nil, fmt.Errorf("YouTube request budget: %w", err)
+	}
+
+	args := append([]string{"--dump-single-json", "--flat-playlist"}, CommonArgs()...)
+	args = append(args, extraArgs...)
+
+	cookieFile, cleanupCookie, err := SetupCookieFile()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupCookie()
+	if cookieFile != "" {
+		args = append(args, "--cookies", cookieFile)
+	}
+
+	args = append(args, url)
+
+	cmd := execCommandContext(ctx, "yt-dlp", args...)
+	output, err := cmd.Output()
+	if err != nil {
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		for _, msg := range unavailableMessages {
+			if strings.Contains(stderr, msg) {
+				return nil, fmt.Errorf("%s: %w: %s", url, ErrUnavailable, stderr)
+			}
+		}
+		return nil, fmt.Errorf("yt-dlp failed for %s: %w: %s", url, err, stderr)
+	}
+	return output, nil
+}
@@ -0,0 +1,144 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockYtDlp(t *testing.T, stdout, stderr string, exitCode int) {
+	original := execCommandContext
+	t.Cleanup(func() { execCommandContext = original })
+
+	execCommandContext = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+		cmd.Env = []string{
+			"GO_WANT_HELPER_PROCESS=1",
+			"HELPER_STDOUT=" + stdout,
+			"HELPER_STDERR=" + stderr,
+			fmt.Sprintf("HELPER_EXIT=%d", exitCode),
+		}
+		return cmd
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	output, err := os.ReadFile("testdata/channel.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := ParseChannel(output)
+	assert.NoError(t, err)
+	assert.Equal(t, &ChannelMetadata{
+		ID:              "UCHnyfMqiRRG1u-2MsSQLbXA",
+		Title:           "Veritasium",
+		Handle:          "@veritasium",
+		Description:     "An element of truth - videos about science, education, and anything else I find interesting.",
+		AvatarURL:       "https://yt3.googleusercontent.com/ytc/avatar=s0",
+		BannerURL:       "https://yt3.googleusercontent.com/banner=s0",
+		SubscriberCount: 16800000,
+		ListTitle:       "Veritasium - Videos",
+		Entries:         []Entry{},
+	}, meta)
+}
+
+func TestParsePlaylistListing(t *testing.T) {
+	output, err := os.ReadFile("testdata/playlist.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := ParseChannel(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "UCHnyfMqiRRG1u-2MsSQLbXA", meta.ID)
+	assert.Equal(t, "Physics & Engineering", meta.ListTitle)
+	assert.Equal(t, []Entry{
+		{ID: "Z8qEb5OvSBo", Title: "The Most Misunderstood Concept in Physics", Duration: 1667},
+		{ID: "cUzklzVXJwo", Title: "The Longest-Standing Mystery in Physics", Duration: 1423},
+	}, meta.Entries)
+}
+
+func TestFetchChannelTerminated(t *testing.T) {
+	mockYtDlp(t, "", "ERROR: [youtube:tab] UC0000000000000000000000: This account has been terminated for a violation of YouTube's Terms of Service.", 1)
+
+	_, err := FetchChannel(context.Background(), "https://www.youtube.com/channel/UC0000000000000000000000/videos")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestFetchChannelTemporaryError(t *testing.T) {
+	mockYtDlp(t, "", "ERROR: [youtube:tab] Unable to download API page: HTTP Error 429: Too Many Requests", 1)
+
+	_, err := FetchChannel(context.Background(), "https://www.youtube.com/@veritasium/videos")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnavailable)
+}
+
+func TestFetchChannelNotFoundIsTemporary(t *testing.T) {
+	mockYtDlp(t, "", "ERROR: [youtube:tab] Unable to download API page: HTTP Error 404: Not Found", 1)
+
+	_, err := FetchChannel(context.Background(), "https://www.youtube.com/@veritasium/videos")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnavailable)
+}
+
+// TestHelperProcess isn't a real test. It stands in for yt-dlp.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprint(os.Stdout, os.Getenv("HELPER_STDOUT"))
+	fmt.Fprint(os.Stderr, os.Getenv("HELPER_STDERR"))
+	if os.Getenv("HELPER_EXIT") != "0" {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestParseChannelSearch(t *testing.T) {
+	output, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ParseChannelSearch(output)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChannelCandidate{
+		{
+			ID:              "UCHnyfMqiRRG1u-2MsSQLbXA",
+			Title:           "Veritasium",
+			Handle:          "@veritasium",
+			AvatarURL:       "https://yt3.googleusercontent.com/ytc/veritasium=s176-c-k-c0x00ffffff-no-rj-mo",
+			SubscriberCount: 16800000,
+		},
+		{
+			ID:              "UCRlICXvO4XR4HMeEB9JjDlA",
+			Title:           "Veritasium en español",
+			Handle:          "@VeritasiumES",
+			AvatarURL:       "https://yt3.googleusercontent.com/ytc/es=s88-c-k-c0x00ffffff-no-rj-mo",
+			SubscriberCount: 1200000,
+		},
+	}, results)
+}
+
+func TestSearchChannelsIsCached(t *testing.T) {
+	output, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockYtDlp(t, string(output), "", 0)
+
+	first, err := SearchChannels(context.Background(), "  Veritasium ", 5)
+	assert.NoError(t, err)
+	assert.Len(t, first, 2)
+
+	// A failing yt-dlp proves the second search never reaches it
+	mockYtDlp(t, "", "ERROR: should not run", 1)
+	second, err := SearchChannels(context.Background(), "veritasium", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+}
@@ -0,0 +1,12 @@
+ALTER TABLE episodes DROP COLUMN playlist_position;
+
+ALTER TABLE episodes DROP CONSTRAINT episodes_subscription_id_youtube_video_id_key;
+-- Keep only the first episode of videos that belong to several subscriptions
+DELETE FROM episodes e USING episodes d WHERE e.youtube_video_id = d.youtube_video_id AND e.id > d.id;
+ALTER TABLE episodes ADD CONSTRAINT episodes_youtube_video_id_key UNIQUE (youtube_video_id);
+
+DROP INDEX subscriptions_user_id_source_key;
+ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_user_id_youtube_channel_id_key UNIQUE (user_id, youtube_channel_id);
+
+ALTER TABLE subscriptions DROP COLUMN youtube_playlist_id;
+ALTER TABLE subscriptions DROP COLUMN source_type;
@@ -0,0 +1,14 @@
+-- Allow subscribing to a single playlist instead of a whole channel
+ALTER TABLE subscriptions ADD COLUMN source_type VARCHAR(20) NOT NULL DEFAULT 'channel';
+ALTER TABLE subscriptions ADD COLUMN youtube_playlist_id VARCHAR(255);
+
+-- A user may follow a channel and one or more of its playlists at the same time
+ALTER TABLE subscriptions DROP CONSTRAINT subscriptions_user_id_youtube_channel_id_key;
+CREATE UNIQUE INDEX subscriptions_user_id_source_key ON subscriptions (user_id, youtube_channel_id, COALESCE(youtube_playlist_id, ''));
+
+-- The same video can now belong to several subscriptions (channel and playlist)
+ALTER TABLE episodes DROP CONSTRAINT episodes_youtube_video_id_key;
+ALTER TABLE episodes ADD CONSTRAINT episodes_subscription_id_youtube_video_id_key UNIQUE (subscription_id, youtube_video_id);
+
+-- Position of the video inside the playlist, used to order serial shows
+ALTER TABLE episodes ADD COLUMN playlist_position INTEGER;
@@ -0,0 +1,4 @@
+DROP INDEX episodes_user_id_youtube_video_id_inbox_key;
+DELETE FROM episodes WHERE subscription_id IS NULL AND user_id IS NOT NULL;
+ALTER TABLE episodes DROP COLUMN user_id;
+ALTER TABLE episodes ALTER COLUMN subscription_id SET NOT NULL;
@@ -0,0 +1,6 @@
+-- One-off "listen later" episodes belong to a user instead of a subscription
+ALTER TABLE episodes ALTER COLUMN subscription_id DROP NOT NULL;
+ALTER TABLE episodes ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+-- A video can only be queued once per inbox
+CREATE UNIQUE INDEX episodes_user_id_youtube_video_id_inbox_key ON episodes (user_id, youtube_video_id) WHERE subscription_id IS NULL;
@@ -0,0 +1,11 @@
+DELETE FROM episodes WHERE provider <> 'youtube';
+DELETE FROM subscriptions WHERE provider <> 'youtube';
+
+DROP INDEX episodes_user_id_youtube_video_id_inbox_key;
+CREATE UNIQUE INDEX episodes_user_id_youtube_video_id_inbox_key ON episodes (user_id, youtube_video_id) WHERE subscription_id IS NULL;
+
+DROP INDEX subscriptions_user_id_source_key;
+CREATE UNIQUE INDEX subscriptions_user_id_source_key ON subscriptions (user_id, youtube_channel_id, COALESCE(youtube_playlist_id, ''));
+
+ALTER TABLE episodes DROP COLUMN provider;
+ALTER TABLE subscriptions DROP COLUMN provider;
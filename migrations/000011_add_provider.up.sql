@@ -0,0 +1,11 @@
+-- Subscriptions and episodes can come from any allowlisted yt-dlp provider.
+-- For non-YouTube providers youtube_channel_id holds the provider's source ID
+-- (user, channel or set path) and youtube_video_id the provider's video ID.
+ALTER TABLE subscriptions ADD COLUMN provider VARCHAR(32) NOT NULL DEFAULT 'youtube';
+ALTER TABLE episodes ADD COLUMN provider VARCHAR(32) NOT NULL DEFAULT 'youtube';
+
+DROP INDEX subscriptions_user_id_source_key;
+CREATE UNIQUE INDEX subscriptions_user_id_source_key ON subscriptions (user_id, provider, youtube_channel_id, COALESCE(youtube_playlist_id, ''));
+
+DROP INDEX episodes_user_id_youtube_video_id_inbox_key;
+CREATE UNIQUE INDEX episodes_user_id_youtube_video_id_inbox_key ON episodes (user_id, provider, youtube_video_id) WHERE subscription_id IS NULL;
@@ -0,0 +1,11 @@
+-- Cache of YouTube references (handles, user and custom URLs, channel and
+-- playlist IDs) resolved to a channel ID and title. Rows older than the
+-- resolver TTL are resolved again.
+CREATE TABLE channel_resolutions (
+    ref_kind VARCHAR(20) NOT NULL,
+    ref_id VARCHAR(255) NOT NULL,
+    youtube_channel_id VARCHAR(255) NOT NULL DEFAULT '',
+    title VARCHAR(255) NOT NULL,
+    resolved_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (ref_kind, ref_id)
+);
@@ -0,0 +1,19 @@
+-- Channel metadata shared by every subscription to the same channel,
+-- refreshed periodically so rebrands and terminations are picked up.
+CREATE TABLE channels (
+    provider VARCHAR(32) NOT NULL DEFAULT 'youtube',
+    youtube_channel_id VARCHAR(255) NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    handle VARCHAR(255),
+    description TEXT,
+    avatar_url TEXT,
+    banner_url TEXT,
+    subscriber_count BIGINT,
+    language VARCHAR(35),
+    -- active, renamed or terminated
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    previous_title VARCHAR(255),
+    refreshed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, youtube_channel_id)
+);
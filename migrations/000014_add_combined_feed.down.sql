@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions DROP COLUMN in_combined_feed;
+ALTER TABLE users DROP COLUMN combined_rss_uuid;
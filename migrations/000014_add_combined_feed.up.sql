@@ -0,0 +1,5 @@
+-- The combined feed merges all of a user's subscriptions at its own UUID
+ALTER TABLE users ADD COLUMN combined_rss_uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+
+-- Subscriptions can stay out of the combined feed and keep only their own
+ALTER TABLE subscriptions ADD COLUMN in_combined_feed BOOLEAN NOT NULL DEFAULT TRUE;
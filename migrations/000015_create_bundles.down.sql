@@ -0,0 +1,2 @@
+DROP TABLE bundle_subscriptions;
+DROP TABLE bundles;
@@ -0,0 +1,18 @@
+-- Bundles are user-named feeds merging a chosen set of subscriptions
+CREATE TABLE bundles (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    image_url TEXT,
+    rss_uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX bundles_user_id_idx ON bundles (user_id);
+
+CREATE TABLE bundle_subscriptions (
+    bundle_id INTEGER NOT NULL REFERENCES bundles(id) ON DELETE CASCADE,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    PRIMARY KEY (bundle_id, subscription_id)
+);
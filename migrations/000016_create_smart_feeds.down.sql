@@ -0,0 +1 @@
+DROP TABLE smart_feeds;
@@ -0,0 +1,12 @@
+-- Smart feeds select a user's episodes by a rule instead of by subscription
+CREATE TABLE smart_feeds (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    rule JSONB NOT NULL,
+    rss_uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX smart_feeds_user_id_idx ON smart_feeds (user_id);
@@ -0,0 +1,9 @@
+ALTER TABLE subscriptions
+    DROP COLUMN feed_title,
+    DROP COLUMN feed_description,
+    DROP COLUMN feed_image_url,
+    DROP COLUMN feed_author,
+    DROP COLUMN feed_category,
+    DROP COLUMN feed_language,
+    DROP COLUMN feed_type,
+    DROP COLUMN feed_explicit;
@@ -0,0 +1,10 @@
+-- Users can override the metadata of a subscription's feed; NULL keeps the default
+ALTER TABLE subscriptions
+    ADD COLUMN feed_title VARCHAR(255),
+    ADD COLUMN feed_description TEXT,
+    ADD COLUMN feed_image_url TEXT,
+    ADD COLUMN feed_author VARCHAR(255),
+    ADD COLUMN feed_category VARCHAR(255),
+    ADD COLUMN feed_language VARCHAR(35),
+    ADD COLUMN feed_type VARCHAR(10) CHECK (feed_type IN ('episodic', 'serial')),
+    ADD COLUMN feed_explicit BOOLEAN;
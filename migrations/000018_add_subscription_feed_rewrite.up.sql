@@ -0,0 +1,3 @@
+-- Title rewrite rules and episode numbering of a subscription's feed, as JSON
+ALTER TABLE subscriptions
+    ADD COLUMN feed_rewrite JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS retired_feed_tokens;
+
+ALTER TABLE subscriptions DROP COLUMN original_rss_uuid;
@@ -0,0 +1,14 @@
+-- The podcast:guid of a subscription's feed stays derived from its first
+-- RSS UUID; NULL until the UUID is first rotated
+ALTER TABLE subscriptions ADD COLUMN original_rss_uuid UUID;
+
+-- Rotated-out RSS UUIDs that still serve the feed, pointing at the new URL,
+-- until their grace period ends
+CREATE TABLE retired_feed_tokens (
+    rss_uuid UUID PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX retired_feed_tokens_subscription_id_idx ON retired_feed_tokens (subscription_id);
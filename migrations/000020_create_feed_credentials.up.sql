@@ -0,0 +1,11 @@
+-- Optional credentials of private feeds, keyed by the RSS UUID of any kind of
+-- feed. Passwords are generated, so an unsalted SHA-256 hash is enough.
+CREATE TABLE feed_credentials (
+    rss_uuid UUID PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(64) NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX feed_credentials_user_id_idx ON feed_credentials (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS feed_daily_stats;
+
+DROP TABLE IF EXISTS fetch_events;
@@ -0,0 +1,29 @@
+-- Feed and audio requests, kept for a few days until rolled up into
+-- feed_daily_stats. rss_uuid is the feed fetched, or the feed an audio URL is
+-- signed for. A range covers COALESCE(range_end + 1, size) - COALESCE(range_start, 0)
+-- bytes, so suffix ranges of the last n bytes are stored as 0 to n - 1.
+CREATE TABLE fetch_events (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(10) NOT NULL,
+    rss_uuid UUID NOT NULL,
+    audio_uuid UUID,
+    ip_hash VARCHAR(32) NOT NULL,
+    user_agent TEXT NOT NULL,
+    app VARCHAR(64) NOT NULL,
+    reported_subscribers INTEGER,
+    range_start BIGINT,
+    range_end BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX fetch_events_created_at_idx ON fetch_events (created_at);
+
+-- Deduplicated downloads and subscribers per feed, UTC day and podcast app
+CREATE TABLE feed_daily_stats (
+    rss_uuid UUID NOT NULL,
+    day DATE NOT NULL,
+    app VARCHAR(64) NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    subscribers INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (rss_uuid, day, app)
+);
@@ -0,0 +1,10 @@
+-- The audio variant a feed's enclosures select, keyed by the RSS UUID of any
+-- kind of feed. Feeds without a row link to the original audio.
+CREATE TABLE feed_audio_profiles (
+    rss_uuid UUID PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    profile VARCHAR(32) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX feed_audio_profiles_user_id_idx ON feed_audio_profiles (user_id);
@@ -0,0 +1 @@
+ALTER TABLE episodes DROP COLUMN IF EXISTS hls_ready;
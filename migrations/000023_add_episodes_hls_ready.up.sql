@@ -0,0 +1,2 @@
+-- Set once an episode's audio was also packaged as HLS for the Mini App player
+ALTER TABLE episodes ADD COLUMN hls_ready BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE episodes DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE episodes DROP COLUMN IF EXISTS on_demand;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS on_demand;
@@ -0,0 +1,8 @@
+-- On-demand subscriptions only list their videos; an episode's audio is
+-- fetched when a podcast app first requests its enclosure
+ALTER TABLE subscriptions ADD COLUMN on_demand BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE episodes ADD COLUMN on_demand BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- When an episode's status last changed; failed on-demand episodes are listed
+-- again once they have been failed for a while
+ALTER TABLE episodes ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
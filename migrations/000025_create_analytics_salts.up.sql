@@ -0,0 +1,7 @@
+-- A random salt per UTC day for hashing listener addresses. Salts are deleted
+-- once their day is over, after which the hashes can't be traced back to
+-- addresses by trying them all.
+CREATE TABLE analytics_salts (
+    day DATE PRIMARY KEY,
+    salt BYTEA NOT NULL
+);
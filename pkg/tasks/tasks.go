@@ -12,6 +12,9 @@ const (
 	TypeProcessVideo          = "video:process"
 	TypeCheckAllSubscriptions = "subscriptions:check"
 	TypeRetryFailedEpisodes   = "episodes:retry"
+	TypeRefreshChannel        = "channel:refresh"
+	TypeRefreshAllChannels    = "channels:refresh"
+	TypeRollupAnalytics       = "analytics:rollup"
 )
 
 type CheckChannelTaskPayload struct {
@@ -29,8 +32,16 @@ func NewCheckChannelTask(subscriptionID int) (*asynq.Task, error) {
 type ProcessVideoTaskPayload struct {
 	YoutubeVideoID string
 	SubscriptionID int
+	// EpisodeID identifies the episode directly; used for inbox episodes that have no subscription
+	EpisodeID int `json:",omitempty"`
+	// OnDemand marks a fetch a podcast app is waiting for, which skips the request delay
+	OnDemand bool `json:",omitempty"`
 }
 
+// QueueOnDemand is worked by its own worker, so fetches a podcast app is
+// waiting for don't queue up behind channel backlogs
+const QueueOnDemand = "ondemand"
+
 func NewProcessVideoTask(youtubeVideoID string, subscriptionID int) (*asynq.Task, error) {
 	payload, err := json.Marshal(ProcessVideoTaskPayload{
 		YoutubeVideoID: youtubeVideoID,
@@ -42,6 +53,32 @@ func NewProcessVideoTask(youtubeVideoID string, subscriptionID int) (*asynq.Task
 	return asynq.NewTask(TypeProcessVideo, payload), nil
 }
 
+// NewProcessEpisodeTask creates a process video task for a specific episode
+func NewProcessEpisodeTask(episodeID int, youtubeVideoID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(ProcessVideoTaskPayload{
+		YoutubeVideoID: youtubeVideoID,
+		EpisodeID:      episodeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeProcessVideo, payload), nil
+}
+
+// NewOnDemandEpisodeTask creates a process video task for an on-demand episode
+// whose audio was just requested
+func NewOnDemandEpisodeTask(episodeID int, youtubeVideoID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(ProcessVideoTaskPayload{
+		YoutubeVideoID: youtubeVideoID,
+		EpisodeID:      episodeID,
+		OnDemand:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeProcessVideo, payload), nil
+}
+
 // GetProcessVideoTaskOptions returns options for video processing tasks with higher retry limits
 func GetProcessVideoTaskOptions() []asynq.Option {
 	return []asynq.Option{
@@ -57,3 +94,25 @@ func NewCheckAllSubscriptionsTask() (*asynq.Task, error) {
 func NewRetryFailedEpisodesTask() (*asynq.Task, error) {
 	return asynq.NewTask(TypeRetryFailedEpisodes, nil), nil
 }
+
+type RefreshChannelTaskPayload struct {
+	Provider  string
+	ChannelID string
+}
+
+// NewRefreshChannelTask creates a task that refetches a channel's metadata
+func NewRefreshChannelTask(provider string, channelID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(RefreshChannelTaskPayload{Provider: provider, ChannelID: channelID})
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(TypeRefreshChannel, payload), nil
+}
+
+func NewRefreshAllChannelsTask() (*asynq.Task, error) {
+	return asynq.NewTask(TypeRefreshAllChannels, nil), nil
+}
+
+func NewRollupAnalyticsTask() (*asynq.Task, error) {
+	return asynq.NewTask(TypeRollupAnalytics, nil), nil
+}